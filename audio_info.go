@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// AudioInfo holds the stream properties and identifying tags of a music file
+type AudioInfo struct {
+	DurationMs int64 `json:"duration_ms,omitempty" bson:"duration_ms,omitempty"`
+	// Bitrate is the average bitrate in kbit/s
+	Bitrate    int    `json:"bitrate,omitempty" bson:"bitrate,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty" bson:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty" bson:"channels,omitempty"`
+	Codec      string `json:"codec,omitempty" bson:"codec,omitempty"`
+	// BitDepth is only known for lossless codecs
+	BitDepth int `json:"bit_depth,omitempty" bson:"bit_depth,omitempty"`
+
+	TrackNumber int    `json:"track_number,omitempty" bson:"track_number,omitempty"`
+	DiscNumber  int    `json:"disc_number,omitempty" bson:"disc_number,omitempty"`
+	Year        int    `json:"year,omitempty" bson:"year,omitempty"`
+	ISRC        string `json:"isrc,omitempty" bson:"isrc,omitempty"`
+
+	MusicBrainzTrackID  string `json:"musicbrainz_track_id,omitempty" bson:"musicbrainz_track_id,omitempty"`
+	MusicBrainzAlbumID  string `json:"musicbrainz_album_id,omitempty" bson:"musicbrainz_album_id,omitempty"`
+	MusicBrainzArtistID string `json:"musicbrainz_artist_id,omitempty" bson:"musicbrainz_artist_id,omitempty"`
+}
+
+// Duration returns DurationMs as a time.Duration
+func (a AudioInfo) Duration() time.Duration {
+	return time.Duration(a.DurationMs) * time.Millisecond
+}
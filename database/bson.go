@@ -0,0 +1,12 @@
+package database
+
+import "gopkg.in/mgo.v2/bson"
+
+// orderedDoc is a bson.D the mongo driver can encode. The driver writes a
+// plain mgo bson.D as an array of name/value documents, so sorts, index keys
+// and other documents whose key order matters are wrapped in orderedDoc.
+type orderedDoc bson.D
+
+func (d orderedDoc) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(bson.D(d))
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"testing"
+
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestOrderedDocMarshal(t *testing.T) {
+	doc := bson.M{"$sort": orderedDoc{{Name: "created_at", Value: -1}, {Name: "_id", Value: -1}}}
+	data, err := driverbson.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded driverbson.D
+	if err := driverbson.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	sort, ok := decoded[0].Value.(driverbson.D)
+	if !ok {
+		t.Fatalf("$sort decoded as %T, want a document", decoded[0].Value)
+	}
+	if len(sort) != 2 || sort[0].Key != "created_at" || sort[1].Key != "_id" {
+		t.Errorf("$sort = %v, want created_at then _id", sort)
+	}
+}
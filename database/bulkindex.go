@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultIndexBatchSize = 500
+
+// IndexOptions configures IndexMusicFiles
+type IndexOptions struct {
+	// BatchSize is the number of files per bulk write, DefaultIndexBatchSize if zero
+	BatchSize int
+	// StartBatch skips the batches before it, to resume after the last batch
+	// reported by Progress
+	StartBatch int
+	// Progress, if set, is called after every batch
+	Progress func(IndexProgress)
+	// Generation, if set, marks every indexed file as seen by this index
+	// generation, see StartIndexGeneration
+	Generation int64
+}
+
+// IndexProgress is reported after each batch of IndexMusicFiles
+type IndexProgress struct {
+	// Batch is the index of the batch that just finished
+	Batch   int
+	Batches int
+	// Processed counts the files of finished batches, including skipped ones
+	Processed int
+	Total     int
+
+	Created   int
+	Changed   int
+	Unchanged int
+	Failed    int
+
+	Elapsed time.Duration
+}
+
+// FilesPerSecond is the indexing throughput so far
+func (p IndexProgress) FilesPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Created+p.Changed+p.Unchanged+p.Failed) / p.Elapsed.Seconds()
+}
+
+// IndexFileResult is the outcome of indexing one file. Err is set when the
+// write of this file failed; the other files of its batch are unaffected.
+type IndexFileResult struct {
+	UpsertResult
+	Err error
+}
+
+// IndexMusicFiles upserts files in unordered bulk writes of opts.BatchSize.
+// The results are in the order of files; files of skipped batches have zero
+// results. A returned error aborts the run, results of finished batches are
+// still returned.
+func (d *db) IndexMusicFiles(ctx context.Context, files []models.MusicFile, opts IndexOptions) ([]IndexFileResult, error) {
+	return RunIndexBatches(ctx, files, opts, d.indexBatch, d.TouchMusicFiles)
+}
+
+func (d *db) indexBatch(ctx context.Context, files []models.MusicFile) ([]IndexFileResult, error) {
+	existing, err := d.existingMusicFiles(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	upserts, planned := PlanMusicFileUpserts(existing, files, time.Now().Unix())
+	results := make([]IndexFileResult, len(upserts))
+	for i, upsert := range upserts {
+		results[i] = IndexFileResult{UpsertResult: upsert}
+	}
+	if len(planned) == 0 {
+		return results, nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(planned))
+	for _, write := range planned {
+		if write.Outcome == UpsertCreated {
+			writes = append(writes, mongo.NewInsertOneModel().SetDocument(write.File))
+		} else {
+			writes = append(writes, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": write.File.ID}).SetReplacement(write.File))
+		}
+	}
+
+	_, err = d.musicFilesCollection().BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed := planned[writeErr.Index].File.Path
+			fileErr := error(writeErr)
+			if mongo.IsDuplicateKeyError(writeErr) {
+				fileErr = ErrMusicFileExists
+			}
+			for i := range results {
+				if results[i].Path == failed {
+					results[i].Err = fileErr
+				}
+			}
+		}
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// RunIndexBatches splits files into batches, passes them to upsert and reports
+// progress. With opts.Generation set, the files are written with that
+// generation and touch marks the unchanged ones, which upsert did not write.
+// It is shared by the Database implementations of IndexMusicFiles.
+func RunIndexBatches(
+	ctx context.Context,
+	files []models.MusicFile,
+	opts IndexOptions,
+	upsert func(ctx context.Context, batch []models.MusicFile) ([]IndexFileResult, error),
+	touch func(ctx context.Context, generation int64, paths []string) (int64, error),
+) ([]IndexFileResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultIndexBatchSize
+	}
+
+	started := time.Now()
+	results := make([]IndexFileResult, len(files))
+	progress := IndexProgress{
+		Batches: (len(files) + batchSize - 1) / batchSize,
+		Total:   len(files),
+	}
+
+	for batch := 0; batch < progress.Batches; batch++ {
+		start := batch * batchSize
+		end := min(start+batchSize, len(files))
+		if batch < opts.StartBatch {
+			progress.Processed = end
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		batchFiles := files[start:end]
+		if opts.Generation != 0 {
+			batchFiles = slices.Clone(batchFiles)
+			for i := range batchFiles {
+				batchFiles[i].IndexGeneration = opts.Generation
+			}
+		}
+
+		batchResults, err := upsert(ctx, batchFiles)
+		if err != nil {
+			return results, err
+		}
+		copy(results[start:end], batchResults)
+
+		if opts.Generation != 0 {
+			var unchanged []string
+			for _, result := range batchResults {
+				if result.Err == nil && result.Outcome == UpsertUnchanged {
+					unchanged = append(unchanged, result.Path)
+				}
+			}
+			if len(unchanged) > 0 {
+				if _, err := touch(ctx, opts.Generation, unchanged); err != nil {
+					return results, err
+				}
+			}
+		}
+
+		for _, result := range batchResults {
+			switch {
+			case result.Err != nil:
+				progress.Failed++
+			case result.Outcome == UpsertCreated:
+				progress.Created++
+			case result.Outcome == UpsertChanged:
+				progress.Changed++
+			default:
+				progress.Unchanged++
+			}
+		}
+
+		progress.Batch = batch
+		progress.Processed = end
+		progress.Elapsed = time.Since(started)
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	return results, nil
+}
@@ -51,3 +51,35 @@ func (d *db) musicFilesCollection() *mongo.Collection {
 
 	return d.conn.Database(d.cfg.DatabaseName).Collection(d.cfg.MusicFilesCollectionName)
 }
+
+// userTokensCollection returns the collection of Spotify user tokens
+func (d *db) userTokensCollection() *mongo.Collection {
+	if err := d.conn.Ping(context.Background(), nil); err != nil {
+		d.log.Error("failed to ping database. reconnecting.", zap.Error(err))
+		if reconnectErr := d.reconnectToDB(); reconnectErr != nil {
+			d.log.Error("failed to reconnect to database", zap.Error(reconnectErr))
+		}
+	}
+
+	name := d.cfg.UserTokensCollectionName
+	if name == "" {
+		name = DefaultUserTokensCollectionName
+	}
+	return d.conn.Database(d.cfg.DatabaseName).Collection(name)
+}
+
+// playlistSnapshotsCollection returns the collection of playlist snapshots
+func (d *db) playlistSnapshotsCollection() *mongo.Collection {
+	if err := d.conn.Ping(context.Background(), nil); err != nil {
+		d.log.Error("failed to ping database. reconnecting.", zap.Error(err))
+		if reconnectErr := d.reconnectToDB(); reconnectErr != nil {
+			d.log.Error("failed to reconnect to database", zap.Error(reconnectErr))
+		}
+	}
+
+	name := d.cfg.PlaylistSnapshotsCollectionName
+	if name == "" {
+		name = DefaultPlaylistSnapshotsCollectionName
+	}
+	return d.conn.Database(d.cfg.DatabaseName).Collection(name)
+}
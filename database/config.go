@@ -8,4 +8,15 @@ type DataBaseConfig struct {
 	DownloadRequestCollectionName string `envconfig:"DOWNLOAD_REQUEST_COLLECTION_NAME" required:"true"`
 	PlaylistRequestCollectionName string `envconfig:"PLAYLIST_REQUEST_COLLECTION_NAME" required:"true"`
 	IndexStatusCollectionName     string `envconfig:"INDEX_STATUS_COLLECTION_NAME" required:"true"`
+	MigrationsCollectionName      string `envconfig:"MIGRATIONS_COLLECTION_NAME" default:"schema_migrations"`
+	UserTokensCollectionName      string `envconfig:"USER_TOKENS_COLLECTION_NAME" default:"spotify_user_tokens"`
+	// PlaylistSnapshotsCollectionName holds the tracks of every playlist sync
+	PlaylistSnapshotsCollectionName string `envconfig:"PLAYLIST_SNAPSHOTS_COLLECTION_NAME" default:"playlist_snapshots"`
+
+	// TrackRetry schedules the download attempts of single tracks,
+	// configured with TRACK_RETRY_MAX_ATTEMPTS, TRACK_RETRY_BACKOFF etc.
+	TrackRetry RetryPolicy `envconfig:"TRACK_RETRY"`
+
+	// EnsureIndexes makes NewDatabase create missing indexes on start
+	EnsureIndexes bool `envconfig:"ENSURE_INDEXES" default:"false"`
 }
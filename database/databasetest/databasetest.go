@@ -0,0 +1,1263 @@
+// Package databasetest contains a conformance suite that every
+// database.Database implementation is expected to pass.
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/matching"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Factory returns a new, empty database for a single test
+type Factory func(t *testing.T) database.Database
+
+// Run runs the conformance suite against the databases returned by newDB
+func Run(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, d database.Database)
+	}{
+		{"DownloadRequests", testDownloadRequests},
+		{"DownloadRequestNotFound", testDownloadRequestNotFound},
+		{"Leases", testLeases},
+		{"ExpiredLeases", testExpiredLeases},
+		{"TransitionRequest", testTransitionRequest},
+		{"UpdateKeepsStoredStatus", testUpdateKeepsStoredStatus},
+		{"ListDownloadRequests", testListDownloadRequests},
+		{"TrackAttempts", testTrackAttempts},
+		{"Playlists", testPlaylists},
+		{"PlaylistSnapshots", testPlaylistSnapshots},
+		{"LibrarySyncRequests", testLibrarySyncRequests},
+		{"MusicFiles", testMusicFiles},
+		{"MatchTracks", testMatchTracks},
+		{"UpsertMusicFile", testUpsertMusicFile},
+		{"UpsertMusicFiles", testUpsertMusicFiles},
+		{"IndexMusicFiles", testIndexMusicFiles},
+		{"SweepUnseenMusicFiles", testSweepUnseenMusicFiles},
+		{"IndexStatus", testIndexStatus},
+		{"UserTokens", testUserTokens},
+		{"EnsureIndexes", testEnsureIndexes},
+		{"EnsureIndexesDuplicates", testEnsureIndexesDuplicates},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newDB(t))
+		})
+	}
+}
+
+func testDownloadRequests(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	url := "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy"
+
+	if err := d.NewDownloadRequest(ctx, url, "Album", 42); err != nil {
+		t.Fatalf("NewDownloadRequest: %v", err)
+	}
+
+	req, err := d.GetActiveRequest(ctx, url)
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+	if req.ID == "" || req.Name != "Album" || req.CreatorID != 42 || !req.Active {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if req.Status != models.RequestStatusQueued {
+		t.Errorf("Status = %q, want %q", req.Status, models.RequestStatusQueued)
+	}
+
+	active, err := d.GetActiveRequests(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveRequests: %v", err)
+	}
+	if len(active) != 1 || active[0].ID != req.ID {
+		t.Fatalf("GetActiveRequests = %+v, want only %s", active, req.ID)
+	}
+
+	synced, err := d.CheckIfRequestAlreadySynced(ctx, url)
+	if err != nil {
+		t.Fatalf("CheckIfRequestAlreadySynced: %v", err)
+	}
+	if synced {
+		t.Error("active request reported as synced")
+	}
+
+	req.Active = false
+	req.SyncCount = 1
+	if err := d.UpdateActiveRequest(ctx, req); err != nil {
+		t.Fatalf("UpdateActiveRequest: %v", err)
+	}
+
+	synced, err = d.CheckIfRequestAlreadySynced(ctx, url)
+	if err != nil {
+		t.Fatalf("CheckIfRequestAlreadySynced: %v", err)
+	}
+	if !synced {
+		t.Error("inactive request not reported as synced")
+	}
+	completed, err := d.ListDownloadRequests(ctx, database.DownloadRequestFilter{Statuses: []models.RequestStatus{models.RequestStatusCompleted}}, database.PageRequest{})
+	if err != nil {
+		t.Fatalf("ListDownloadRequests: %v", err)
+	}
+	if len(completed.Requests) != 1 || completed.Requests[0].ID != req.ID {
+		t.Errorf("completed requests = %+v, want %s", completed.Requests, req.ID)
+	}
+
+	active, err = d.GetActiveRequests(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveRequests: %v", err)
+	}
+	if len(active) != 0 {
+		t.Errorf("GetActiveRequests returned %d requests, want 0", len(active))
+	}
+}
+
+func testDownloadRequestNotFound(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	_, err := d.GetActiveRequest(ctx, "https://open.spotify.com/album/missing")
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("GetActiveRequest error = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+
+	err = d.UpdateActiveRequest(ctx, models.DownloadQueueRequest{ID: "missing"})
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("UpdateActiveRequest error = %v, want %v", err, database.ErrNotFound)
+	}
+}
+
+func testLeases(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	for _, url := range []string{"https://open.spotify.com/album/a", "https://open.spotify.com/album/b"} {
+		if err := d.NewDownloadRequest(ctx, url, "", 1); err != nil {
+			t.Fatalf("NewDownloadRequest: %v", err)
+		}
+	}
+
+	first, err := d.ClaimNextRequest(ctx, "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextRequest: %v", err)
+	}
+	if first.LeaseOwner != "worker-1" || first.LeaseExpiresAt <= time.Now().Unix() {
+		t.Errorf("unexpected lease on claimed request: %+v", first)
+	}
+	if first.Status != models.RequestStatusDownloading {
+		t.Errorf("claimed request status = %q, want %q", first.Status, models.RequestStatusDownloading)
+	}
+
+	second, err := d.ClaimNextRequest(ctx, "worker-2", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextRequest: %v", err)
+	}
+	if second.ID == first.ID {
+		t.Fatal("the same request was claimed twice")
+	}
+
+	if _, err := d.ClaimNextRequest(ctx, "worker-3", time.Minute); !errors.Is(err, database.ErrNoRequestsAvailable) {
+		t.Errorf("ClaimNextRequest error = %v, want %v", err, database.ErrNoRequestsAvailable)
+	}
+
+	if err := d.RenewLease(ctx, first.ID, "worker-2", time.Minute); !errors.Is(err, database.ErrLeaseNotHeld) {
+		t.Errorf("RenewLease by another worker error = %v, want %v", err, database.ErrLeaseNotHeld)
+	}
+	if err := d.RenewLease(ctx, first.ID, "worker-1", time.Hour); err != nil {
+		t.Errorf("RenewLease: %v", err)
+	}
+
+	if err := d.ReleaseLease(ctx, first.ID, "worker-2"); !errors.Is(err, database.ErrLeaseNotHeld) {
+		t.Errorf("ReleaseLease by another worker error = %v, want %v", err, database.ErrLeaseNotHeld)
+	}
+	if err := d.ReleaseLease(ctx, first.ID, "worker-1"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+
+	// a released request goes back to the queue
+	queued, err := d.ListDownloadRequests(ctx, database.DownloadRequestFilter{Statuses: []models.RequestStatus{models.RequestStatusQueued}}, database.PageRequest{})
+	if err != nil {
+		t.Fatalf("ListDownloadRequests: %v", err)
+	}
+	if len(queued.Requests) != 1 || queued.Requests[0].ID != first.ID || queued.Requests[0].LeaseOwner != "" {
+		t.Errorf("queued requests after release = %+v, want %s without a lease", queued.Requests, first.ID)
+	}
+
+	again, err := d.ClaimNextRequest(ctx, "worker-3", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextRequest after release: %v", err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("claimed %s after release, want %s", again.ID, first.ID)
+	}
+
+	// putting a request back in the queue drops its lease
+	if err := d.TransitionRequest(ctx, again.ID, models.RequestStatusQueued, "retry"); err != nil {
+		t.Fatalf("TransitionRequest: %v", err)
+	}
+	if err := d.RenewLease(ctx, again.ID, "worker-3", time.Minute); !errors.Is(err, database.ErrLeaseNotHeld) {
+		t.Errorf("RenewLease after requeue error = %v, want %v", err, database.ErrLeaseNotHeld)
+	}
+	retried, err := d.ClaimNextRequest(ctx, "worker-4", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextRequest after requeue: %v", err)
+	}
+	if retried.ID != first.ID || retried.LeaseOwner != "worker-4" {
+		t.Errorf("claimed %+v after requeue, want %s held by worker-4", retried, first.ID)
+	}
+
+	// a request past downloading holds no lease and is not claimable
+	if err := d.TransitionRequest(ctx, second.ID, models.RequestStatusVerifying, ""); err != nil {
+		t.Fatalf("TransitionRequest: %v", err)
+	}
+	if err := d.ReleaseLease(ctx, second.ID, "worker-2"); !errors.Is(err, database.ErrLeaseNotHeld) {
+		t.Errorf("ReleaseLease of a verifying request error = %v, want %v", err, database.ErrLeaseNotHeld)
+	}
+	if _, err := d.ClaimNextRequest(ctx, "worker-5", time.Minute); !errors.Is(err, database.ErrNoRequestsAvailable) {
+		t.Errorf("ClaimNextRequest of a verifying request error = %v, want %v", err, database.ErrNoRequestsAvailable)
+	}
+}
+
+func testExpiredLeases(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	// cancelled requests are not requeued
+	if err := d.NewDownloadRequest(ctx, "https://open.spotify.com/album/b", "", 1); err != nil {
+		t.Fatalf("NewDownloadRequest: %v", err)
+	}
+	cancelled, err := d.ClaimNextRequest(ctx, "worker-3", -time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextRequest: %v", err)
+	}
+	if err := d.TransitionRequest(ctx, cancelled.ID, models.RequestStatusCancelled, ""); err != nil {
+		t.Fatalf("TransitionRequest: %v", err)
+	}
+
+	if err := d.NewDownloadRequest(ctx, "https://open.spotify.com/album/a", "", 1); err != nil {
+		t.Fatalf("NewDownloadRequest: %v", err)
+	}
+
+	// a lease in the past has already expired
+	first, err := d.ClaimNextRequest(ctx, "worker-1", -time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextRequest: %v", err)
+	}
+
+	second, err := d.ClaimNextRequest(ctx, "worker-2", -time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextRequest on expired lease: %v", err)
+	}
+	if second.ID != first.ID || second.LeaseOwner != "worker-2" {
+		t.Errorf("expired lease was not taken over: %+v", second)
+	}
+
+	count, err := d.RequeueExpiredLeases(ctx)
+	if err != nil {
+		t.Fatalf("RequeueExpiredLeases: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("RequeueExpiredLeases = %d, want 1", count)
+	}
+	requeued, err := d.GetActiveRequest(ctx, "https://open.spotify.com/album/a")
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+	if requeued.Status != models.RequestStatusQueued || requeued.LeaseOwner != "" {
+		t.Errorf("requeued request = %+v, want queued without a lease", requeued)
+	}
+
+	if err := d.RenewLease(ctx, first.ID, "worker-2", time.Minute); !errors.Is(err, database.ErrLeaseNotHeld) {
+		t.Errorf("RenewLease after requeue error = %v, want %v", err, database.ErrLeaseNotHeld)
+	}
+}
+
+func testTransitionRequest(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	url := "https://open.spotify.com/album/a"
+	if err := d.NewDownloadRequest(ctx, url, "", 1); err != nil {
+		t.Fatalf("NewDownloadRequest: %v", err)
+	}
+	req, err := d.GetActiveRequest(ctx, url)
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+
+	err = d.TransitionRequest(ctx, req.ID, models.RequestStatusCompleted, "")
+	if !errors.Is(err, models.ErrIllegalTransition) {
+		t.Errorf("illegal TransitionRequest error = %v, want %v", err, models.ErrIllegalTransition)
+	}
+
+	for _, to := range []models.RequestStatus{models.RequestStatusDownloading, models.RequestStatusVerifying} {
+		if err := d.TransitionRequest(ctx, req.ID, to, ""); err != nil {
+			t.Fatalf("TransitionRequest to %s: %v", to, err)
+		}
+	}
+
+	req, err = d.GetActiveRequest(ctx, url)
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+	if req.Status != models.RequestStatusVerifying {
+		t.Errorf("Status = %q, want %q", req.Status, models.RequestStatusVerifying)
+	}
+
+	if err := d.TransitionRequest(ctx, req.ID, models.RequestStatusFailed, "spotdl crashed"); err != nil {
+		t.Fatalf("TransitionRequest to failed: %v", err)
+	}
+	if _, err := d.GetActiveRequest(ctx, url); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("failed request is still active: %v", err)
+	}
+
+	if err := d.TransitionRequest(ctx, "missing", models.RequestStatusDownloading, ""); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("TransitionRequest error = %v, want %v", err, database.ErrNotFound)
+	}
+
+	if _, err := d.MigrateRequestStatuses(ctx); err != nil {
+		t.Errorf("MigrateRequestStatuses: %v", err)
+	}
+}
+
+func testUpdateKeepsStoredStatus(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	url := "https://open.spotify.com/album/a"
+	if err := d.NewDownloadRequest(ctx, url, "", 1); err != nil {
+		t.Fatalf("NewDownloadRequest: %v", err)
+	}
+	stale, err := d.GetActiveRequest(ctx, url)
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+
+	for _, to := range []models.RequestStatus{models.RequestStatusDownloading, models.RequestStatusVerifying, models.RequestStatusPartiallyComplete} {
+		if err := d.TransitionRequest(ctx, stale.ID, to, ""); err != nil {
+			t.Fatalf("TransitionRequest to %s: %v", to, err)
+		}
+	}
+
+	// the copy read while queued must not roll the status back
+	stale.RetryCount = 1
+	if err := d.UpdateActiveRequest(ctx, stale); err != nil {
+		t.Fatalf("UpdateActiveRequest: %v", err)
+	}
+	req, err := d.GetActiveRequest(ctx, url)
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+	if req.Status != models.RequestStatusPartiallyComplete || req.RetryCount != 1 {
+		t.Errorf("request after stale update = %+v, want %q with 1 retry", req, models.RequestStatusPartiallyComplete)
+	}
+
+	if err := d.UpdateActiveRequest(ctx, models.DownloadQueueRequest{ID: req.ID, Active: true, RetryCount: 2}); err != nil {
+		t.Fatalf("UpdateActiveRequest without a status: %v", err)
+	}
+	req, err = d.GetActiveRequest(ctx, url)
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+	if req.Status != models.RequestStatusPartiallyComplete {
+		t.Errorf("Status after update without a status = %q, want %q", req.Status, models.RequestStatusPartiallyComplete)
+	}
+
+	playlistURL := "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M"
+	if err := d.NewPlaylistRequest(ctx, playlistURL, 1); err != nil {
+		t.Fatalf("NewPlaylistRequest: %v", err)
+	}
+	playlists, err := d.GetActivePlaylists(ctx)
+	if err != nil {
+		t.Fatalf("GetActivePlaylists: %v", err)
+	}
+	if len(playlists) != 1 {
+		t.Fatalf("GetActivePlaylists = %+v, want one playlist", playlists)
+	}
+	playlist := playlists[0]
+	if err := d.TransitionPlaylistRequest(ctx, playlist.ID, models.RequestStatusDownloading, ""); err != nil {
+		t.Fatalf("TransitionPlaylistRequest: %v", err)
+	}
+
+	playlist.RetryCount = 1
+	if err := d.UpdatePlaylistRequest(ctx, playlist); err != nil {
+		t.Fatalf("UpdatePlaylistRequest: %v", err)
+	}
+	playlists, err = d.GetActivePlaylists(ctx)
+	if err != nil {
+		t.Fatalf("GetActivePlaylists: %v", err)
+	}
+	if len(playlists) != 1 || playlists[0].Status != models.RequestStatusDownloading {
+		t.Errorf("playlists after stale update = %+v, want %q", playlists, models.RequestStatusDownloading)
+	}
+}
+
+func testListDownloadRequests(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	requests := []struct {
+		url     string
+		name    string
+		creator int64
+	}{
+		{"https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy", "Discovery", 1},
+		{"https://open.spotify.com/album/5uRdvUR7xCnHmUW8n64n9y", "Homework", 1},
+		{"https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M", "Today's Top Hits", 2},
+		{"https://open.spotify.com/track/0DiWol3AO6WpXZgp0goxAV", "One More Time", 1},
+		{"https://open.spotify.com/album/2noRn2Aes5aoNVsU6iWThc", "Human After All", 3},
+	}
+	for _, r := range requests {
+		if err := d.NewDownloadRequest(ctx, r.url, r.name, r.creator); err != nil {
+			t.Fatalf("NewDownloadRequest: %v", err)
+		}
+	}
+
+	for _, sort := range []database.SortOrder{database.SortNewestFirst, database.SortOldestFirst} {
+		seen := make(map[string]bool)
+		page := database.PageRequest{Limit: 2, Sort: sort}
+		for pages := 0; ; pages++ {
+			if pages > len(requests) {
+				t.Fatal("pagination did not terminate")
+			}
+			result, err := d.ListDownloadRequests(ctx, database.DownloadRequestFilter{}, page)
+			if err != nil {
+				t.Fatalf("ListDownloadRequests: %v", err)
+			}
+			if result.TotalCount != int64(len(requests)) {
+				t.Errorf("TotalCount = %d, want %d", result.TotalCount, len(requests))
+			}
+			if len(result.Requests) > 2 {
+				t.Errorf("page has %d requests, limit is 2", len(result.Requests))
+			}
+			for _, req := range result.Requests {
+				if seen[req.ID] {
+					t.Errorf("request %s listed twice", req.ID)
+				}
+				seen[req.ID] = true
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			page.Cursor = result.NextCursor
+		}
+		if len(seen) != len(requests) {
+			t.Errorf("paged through %d requests, want %d", len(seen), len(requests))
+		}
+	}
+
+	filters := []struct {
+		name   string
+		filter database.DownloadRequestFilter
+		want   int
+	}{
+		{"creator", database.DownloadRequestFilter{CreatorID: 1}, 3},
+		{"object type", database.DownloadRequestFilter{ObjectType: spotify.SpotifyObjectTypeAlbum}, 3},
+		{"name", database.DownloadRequestFilter{NameContains: "HOME"}, 1},
+		{"creator and type", database.DownloadRequestFilter{CreatorID: 1, ObjectType: spotify.SpotifyObjectTypeTrack}, 1},
+		{"status", database.DownloadRequestFilter{Statuses: []models.RequestStatus{models.RequestStatusQueued}}, 5},
+		{"no status match", database.DownloadRequestFilter{Statuses: []models.RequestStatus{models.RequestStatusFailed}}, 0},
+		{"created range", database.DownloadRequestFilter{CreatedFrom: time.Now().Add(-time.Hour).Unix(), CreatedTo: time.Now().Add(time.Hour).Unix()}, 5},
+		{"created in future", database.DownloadRequestFilter{CreatedFrom: time.Now().Add(time.Hour).Unix()}, 0},
+	}
+	for _, tt := range filters {
+		result, err := d.ListDownloadRequests(ctx, tt.filter, database.PageRequest{})
+		if err != nil {
+			t.Fatalf("%s: ListDownloadRequests: %v", tt.name, err)
+		}
+		if len(result.Requests) != tt.want || result.TotalCount != int64(tt.want) {
+			t.Errorf("%s: got %d requests (total %d), want %d", tt.name, len(result.Requests), result.TotalCount, tt.want)
+		}
+	}
+
+	_, err := d.ListDownloadRequests(ctx, database.DownloadRequestFilter{}, database.PageRequest{Cursor: "not a cursor"})
+	if !errors.Is(err, database.ErrInvalidCursor) {
+		t.Errorf("ListDownloadRequests error = %v, want %v", err, database.ErrInvalidCursor)
+	}
+}
+
+func testTrackAttempts(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	for _, url := range []string{"https://open.spotify.com/album/a", "https://open.spotify.com/album/b"} {
+		if err := d.NewDownloadRequest(ctx, url, "", 1); err != nil {
+			t.Fatalf("NewDownloadRequest: %v", err)
+		}
+	}
+	first, err := d.GetActiveRequest(ctx, "https://open.spotify.com/album/a")
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+	second, err := d.GetActiveRequest(ctx, "https://open.spotify.com/album/b")
+	if err != nil {
+		t.Fatalf("GetActiveRequest: %v", err)
+	}
+
+	trackA, trackB, trackC := "https://open.spotify.com/track/a", "https://open.spotify.com/track/b", "https://open.spotify.com/track/c"
+	err = d.SetRequestTracks(ctx, first.ID, []spotify.TrackMetadata{
+		{SpotifyURL: trackA, Artist: "a", Title: "a"},
+		{SpotifyURL: trackB, Artist: "b", Title: "b", Found: true},
+	})
+	if err != nil {
+		t.Fatalf("SetRequestTracks: %v", err)
+	}
+	if err := d.SetRequestTracks(ctx, second.ID, []spotify.TrackMetadata{{SpotifyURL: trackC, Artist: "c", Title: "c"}}); err != nil {
+		t.Fatalf("SetRequestTracks: %v", err)
+	}
+	if first, _ = d.GetActiveRequest(ctx, "https://open.spotify.com/album/a"); first.ExpectedTrackCount != 2 || first.FoundTrackCount != 1 {
+		t.Errorf("track counts = %d/%d, want 1/2", first.FoundTrackCount, first.ExpectedTrackCount)
+	}
+
+	// default policy: 3 attempts, 10 minutes doubling
+	start := time.Unix(1_700_000_000, 0)
+	track, err := d.RecordTrackAttempt(ctx, first.ID, trackA, database.TrackAttempt{Error: "no match", At: start})
+	if err != nil {
+		t.Fatalf("RecordTrackAttempt: %v", err)
+	}
+	if track.FailedAttempts != 1 || track.Skipped || track.LastAttemptAt != start.Unix() ||
+		track.NextAttemptAt != start.Add(10*time.Minute).Unix() || track.LastError != "no match" {
+		t.Errorf("after first failure track = %+v", track)
+	}
+	track, err = d.RecordTrackAttempt(ctx, first.ID, trackA, database.TrackAttempt{At: start.Add(10 * time.Minute)})
+	if err != nil {
+		t.Fatalf("RecordTrackAttempt: %v", err)
+	}
+	if track.FailedAttempts != 2 || track.NextAttemptAt != start.Add(30*time.Minute).Unix() {
+		t.Errorf("after second failure track = %+v, want the next attempt 20 minutes later", track)
+	}
+	if _, err := d.RecordTrackAttempt(ctx, second.ID, trackC, database.TrackAttempt{At: start}); err != nil {
+		t.Fatalf("RecordTrackAttempt: %v", err)
+	}
+
+	due, err := d.TracksDueForRetry(ctx, start.Add(5*time.Minute), 0)
+	if err != nil {
+		t.Fatalf("TracksDueForRetry: %v", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("due after 5 minutes = %+v, want none", due)
+	}
+	due, err = d.TracksDueForRetry(ctx, start.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("TracksDueForRetry: %v", err)
+	}
+	if len(due) != 2 || due[0].Track.SpotifyURL != trackC || due[1].Track.SpotifyURL != trackA ||
+		due[1].RequestID != first.ID || due[1].RequestURL != "https://open.spotify.com/album/a" {
+		t.Errorf("due after an hour = %+v, want c then a", due)
+	}
+	if due, _ := d.TracksDueForRetry(ctx, start.Add(time.Hour), 1); len(due) != 1 || due[0].Track.SpotifyURL != trackC {
+		t.Errorf("due with limit = %+v, want only c", due)
+	}
+
+	track, err = d.RecordTrackAttempt(ctx, first.ID, trackA, database.TrackAttempt{Error: "no match", At: start.Add(30 * time.Minute)})
+	if err != nil {
+		t.Fatalf("RecordTrackAttempt: %v", err)
+	}
+	if track.FailedAttempts != 3 || !track.Skipped || track.NextAttemptAt != 0 {
+		t.Errorf("after last failure track = %+v, want it skipped", track)
+	}
+
+	track, err = d.RecordTrackAttempt(ctx, second.ID, trackC, database.TrackAttempt{Found: true, At: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("RecordTrackAttempt: %v", err)
+	}
+	if !track.Found || track.NextAttemptAt != 0 || track.LastError != "" {
+		t.Errorf("found track = %+v", track)
+	}
+	if second, _ = d.GetActiveRequest(ctx, "https://open.spotify.com/album/b"); second.FoundTrackCount != 1 || !second.TrackMetadata[0].Found {
+		t.Errorf("request after found attempt = %+v", second)
+	}
+
+	if due, _ := d.TracksDueForRetry(ctx, start.Add(48*time.Hour), 0); len(due) != 0 {
+		t.Errorf("due = %+v, want none once tracks are found or skipped", due)
+	}
+
+	if _, err := d.RecordTrackAttempt(ctx, first.ID, "https://open.spotify.com/track/missing", database.TrackAttempt{}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("RecordTrackAttempt for missing track error = %v, want %v", err, database.ErrNotFound)
+	}
+	if _, err := d.RecordTrackAttempt(ctx, "missing", trackA, database.TrackAttempt{}); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("RecordTrackAttempt for missing request error = %v, want %v", err, database.ErrNotFound)
+	}
+	if err := d.SetRequestTracks(ctx, "missing", nil); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("SetRequestTracks error = %v, want %v", err, database.ErrNotFound)
+	}
+}
+
+func testPlaylists(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	url := "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M"
+
+	if err := d.NewPlaylistRequest(ctx, url, 7); err != nil {
+		t.Fatalf("NewPlaylistRequest: %v", err)
+	}
+
+	playlists, err := d.GetActivePlaylists(ctx)
+	if err != nil {
+		t.Fatalf("GetActivePlaylists: %v", err)
+	}
+	if len(playlists) != 1 || playlists[0].SpotifyURL != url || playlists[0].CreatorID != 7 {
+		t.Fatalf("GetActivePlaylists = %+v", playlists)
+	}
+	if playlists[0].Status != models.RequestStatusQueued {
+		t.Errorf("Status = %q, want %q", playlists[0].Status, models.RequestStatusQueued)
+	}
+
+	playlist := playlists[0]
+	playlist.RetryCount = 2
+	playlist.Errored = true
+	if err := d.UpdatePlaylistRequest(ctx, playlist); err != nil {
+		t.Fatalf("UpdatePlaylistRequest: %v", err)
+	}
+
+	if err := d.TransitionPlaylistRequest(ctx, playlist.ID, models.RequestStatusCancelled, "removed by user"); err != nil {
+		t.Fatalf("TransitionPlaylistRequest: %v", err)
+	}
+
+	playlists, err = d.GetActivePlaylists(ctx)
+	if err != nil {
+		t.Fatalf("GetActivePlaylists: %v", err)
+	}
+	if len(playlists) != 0 {
+		t.Errorf("cancelled playlist is still active: %+v", playlists)
+	}
+
+	err = d.UpdatePlaylistRequest(ctx, models.PlaylistRequest{ID: "missing"})
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("UpdatePlaylistRequest error = %v, want %v", err, database.ErrNotFound)
+	}
+}
+
+func testLibrarySyncRequests(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	if err := d.NewLibrarySyncRequest(ctx, 7, spotify.SpotifyObjectTypeSavedTracks); err != nil {
+		t.Fatalf("NewLibrarySyncRequest: %v", err)
+	}
+	if err := d.NewLibrarySyncRequest(ctx, 7, spotify.SpotifyObjectTypeSavedTracks); !errors.Is(err, database.ErrRequestExists) {
+		t.Errorf("duplicate NewLibrarySyncRequest error = %v, want %v", err, database.ErrRequestExists)
+	}
+	// the URL is the same for every user, but each has their own library
+	if err := d.NewLibrarySyncRequest(ctx, 8, spotify.SpotifyObjectTypeSavedTracks); err != nil {
+		t.Errorf("NewLibrarySyncRequest for another user: %v", err)
+	}
+	if err := d.NewLibrarySyncRequest(ctx, 7, spotify.SpotifyObjectTypeSavedAlbums); err != nil {
+		t.Errorf("NewLibrarySyncRequest for saved albums: %v", err)
+	}
+	if err := d.NewLibrarySyncRequest(ctx, 7, spotify.SpotifyObjectTypeAlbum); !errors.Is(err, spotify.ErrUnsupportedObjectType) {
+		t.Errorf("NewLibrarySyncRequest for an album error = %v, want %v", err, spotify.ErrUnsupportedObjectType)
+	}
+	if err := d.NewPlaylistRequest(ctx, "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M", 7); err != nil {
+		t.Fatalf("NewPlaylistRequest: %v", err)
+	}
+
+	playlists, err := d.GetActivePlaylists(ctx)
+	if err != nil {
+		t.Fatalf("GetActivePlaylists: %v", err)
+	}
+	var library []models.PlaylistRequest
+	for _, playlist := range playlists {
+		if playlist.IsLibrarySync() {
+			library = append(library, playlist)
+		} else if playlist.ObjectType != spotify.SpotifyObjectTypePlaylist {
+			t.Errorf("playlist request object type = %q, want %q", playlist.ObjectType, spotify.SpotifyObjectTypePlaylist)
+		}
+	}
+	if len(playlists) != 4 || len(library) != 3 {
+		t.Fatalf("GetActivePlaylists = %+v, want 3 library syncs and a playlist", playlists)
+	}
+	for _, request := range library {
+		if request.ID == "" || request.Status != models.RequestStatusQueued || request.SpotifyURL != spotify.LibraryURL(request.ObjectType) {
+			t.Errorf("library sync request = %+v", request)
+		}
+	}
+
+	// a cancelled library sync can be requested again
+	if err := d.TransitionPlaylistRequest(ctx, library[0].ID, models.RequestStatusCancelled, ""); err != nil {
+		t.Fatalf("TransitionPlaylistRequest: %v", err)
+	}
+	if err := d.NewLibrarySyncRequest(ctx, library[0].CreatorID, library[0].ObjectType); err != nil {
+		t.Errorf("NewLibrarySyncRequest after cancelling: %v", err)
+	}
+}
+
+func testPlaylistSnapshots(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	if err := d.NewPlaylistRequest(ctx, "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M", 7); err != nil {
+		t.Fatalf("NewPlaylistRequest: %v", err)
+	}
+	playlists, err := d.GetActivePlaylists(ctx)
+	if err != nil || len(playlists) != 1 {
+		t.Fatalf("GetActivePlaylists = %+v, %v", playlists, err)
+	}
+	id := playlists[0].ID
+
+	if _, err := d.DiffPlaylist(ctx, id); !errors.Is(err, database.ErrNoSnapshot) {
+		t.Errorf("DiffPlaylist without snapshot error = %v, want %v", err, database.ErrNoSnapshot)
+	}
+	if _, err := d.GetPlaylistSnapshot(ctx, id); !errors.Is(err, database.ErrNoSnapshot) {
+		t.Errorf("GetPlaylistSnapshot without snapshot error = %v, want %v", err, database.ErrNoSnapshot)
+	}
+
+	track := func(id, title string) spotify.TrackMetadata {
+		return spotify.TrackMetadata{SpotifyURL: "https://open.spotify.com/track/" + id, Artist: "$uicideboy$", Title: title}
+	}
+	first := models.PlaylistSnapshot{SnapshotID: "s1", TakenAt: 100, Tracks: []spotify.TrackMetadata{track("a", "a"), track("b", "b"), track("c", "c"), track("e", "e")}}
+	if err := d.UpdatePlaylistSnapshot(ctx, id, first); err != nil {
+		t.Fatalf("UpdatePlaylistSnapshot: %v", err)
+	}
+	diff, err := d.DiffPlaylist(ctx, id)
+	if err != nil {
+		t.Fatalf("DiffPlaylist: %v", err)
+	}
+	if len(diff.Added) != 4 || diff.ToSnapshotID != "s1" {
+		t.Errorf("first sync diff = %+v, want every track added", diff)
+	}
+
+	second := models.PlaylistSnapshot{SnapshotID: "s2", TakenAt: 200, Tracks: []spotify.TrackMetadata{track("e", "e"), track("a", "a"), track("c", "c"), track("d", "d")}}
+	if err := d.UpdatePlaylistSnapshot(ctx, id, second); err != nil {
+		t.Fatalf("UpdatePlaylistSnapshot: %v", err)
+	}
+	diff, err = d.DiffPlaylist(ctx, id)
+	if err != nil {
+		t.Fatalf("DiffPlaylist: %v", err)
+	}
+	if diff.FromSnapshotID != "s1" || diff.ToSnapshotID != "s2" {
+		t.Errorf("diff between %q and %q, want s1 and s2", diff.FromSnapshotID, diff.ToSnapshotID)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Track.Title != "d" || len(diff.Removed) != 1 || diff.Removed[0].Track.Title != "b" {
+		t.Errorf("diff = %+v, want d added and b removed", diff)
+	}
+	if len(diff.Reordered) != 1 || diff.Reordered[0].Track.Title != "e" || diff.Reordered[0].To != 0 {
+		t.Errorf("Reordered = %+v, want e moved to the top", diff.Reordered)
+	}
+
+	stored, err := d.GetPlaylistSnapshot(ctx, id)
+	if err != nil {
+		t.Fatalf("GetPlaylistSnapshot: %v", err)
+	}
+	if stored.SnapshotID != "s2" || stored.TakenAt != 200 || len(stored.Tracks) != 4 {
+		t.Errorf("GetPlaylistSnapshot = %+v, want s2", stored)
+	}
+	if stored.Tracks[0].Artist != "$uicideboy$" {
+		t.Errorf("stored artist = %q, want it verbatim", stored.Tracks[0].Artist)
+	}
+
+	// only the last two snapshots are diffed
+	third := models.PlaylistSnapshot{SnapshotID: "s3", TakenAt: 300, Tracks: second.Tracks[:3]}
+	if err := d.UpdatePlaylistSnapshot(ctx, id, third); err != nil {
+		t.Fatalf("UpdatePlaylistSnapshot: %v", err)
+	}
+	diff, err = d.DiffPlaylist(ctx, id)
+	if err != nil {
+		t.Fatalf("DiffPlaylist: %v", err)
+	}
+	if diff.FromSnapshotID != "s2" || len(diff.Removed) != 1 || diff.Removed[0].Track.Title != "d" {
+		t.Errorf("diff = %+v, want d removed since s2", diff)
+	}
+
+	if err := d.UpdatePlaylistSnapshot(ctx, "missing", second); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("UpdatePlaylistSnapshot error = %v, want %v", err, database.ErrNotFound)
+	}
+	if _, err := d.DiffPlaylist(ctx, "missing"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("DiffPlaylist error = %v, want %v", err, database.ErrNotFound)
+	}
+	if _, err := d.GetPlaylistSnapshot(ctx, "missing"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetPlaylistSnapshot error = %v, want %v", err, database.ErrNotFound)
+	}
+}
+
+func testMusicFiles(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	files := []models.MusicFile{
+		{Artist: "daft punk", Title: "one more time", Path: "/music/a.flac", Extra: map[string]string{"mood": "happy"}},
+		{Artist: "daft punk", Title: "aerodynamic", Path: "/music/b.flac"},
+		{Artist: "justice", Title: "genesis", Path: "/music/c.flac"},
+	}
+	for _, file := range files {
+		if err := d.IndexMusicFile(ctx, file); err != nil {
+			t.Fatalf("IndexMusicFile: %v", err)
+		}
+	}
+
+	found, err := d.FindMusicFiles(ctx, []string{"daft punk", "justice"}, []string{"one more time", "aerodynamic"})
+	if err != nil {
+		t.Fatalf("FindMusicFiles: %v", err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("FindMusicFiles returned %d files, want 1: %+v", len(found), found)
+	}
+	if found[0].Path != "/music/a.flac" || found[0].ID == "" || found[0].CreatedAt == 0 {
+		t.Errorf("unexpected file: %+v", found[0])
+	}
+	if found[0].Extra != nil {
+		t.Errorf("FindMusicFiles should not load extra tags, got %v", found[0].Extra)
+	}
+
+	found, err = d.FindMusicFiles(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("FindMusicFiles with no pairs: %v", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("FindMusicFiles with no pairs returned %d files", len(found))
+	}
+}
+
+func testMatchTracks(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	files := []models.MusicFile{
+		{Artist: "Daft Punk", Title: "Get Lucky (feat. Pharrell Williams)", Path: "/music/lucky.flac"},
+		{Artist: "David Bowie", Title: "Heroes - 2017 Remaster", Path: "/music/heroes.flac"},
+		{Artist: "Energy 52", Title: "Café del Mar", Path: "/music/cafe.flac"},
+	}
+	for _, file := range files {
+		if err := d.IndexMusicFile(ctx, file); err != nil {
+			t.Fatalf("IndexMusicFile: %v", err)
+		}
+	}
+
+	tracks := []spotify.TrackMetadata{
+		{SpotifyURL: "https://open.spotify.com/track/1", Artist: "daft punk, pharrell williams", Title: "get lucky"},
+		{SpotifyURL: "https://open.spotify.com/track/2", Artist: "david bowie", Title: "heroes"},
+		{SpotifyURL: "https://open.spotify.com/track/3", Artist: "aphex twin", Title: "xtal"},
+		{SpotifyURL: "https://open.spotify.com/track/4", Artist: "ENERGY 52", Title: "CAFE DEL MAR"},
+	}
+	results, err := d.MatchTracks(ctx, tracks)
+	if err != nil {
+		t.Fatalf("MatchTracks: %v", err)
+	}
+	if len(results) != len(tracks) {
+		t.Fatalf("MatchTracks returned %d results, want %d", len(results), len(tracks))
+	}
+
+	wantPaths := []string{"/music/lucky.flac", "/music/heroes.flac", "", "/music/cafe.flac"}
+	for i, result := range results {
+		if result.Track.SpotifyURL != tracks[i].SpotifyURL {
+			t.Errorf("result %d is for %s, want %s", i, result.Track.SpotifyURL, tracks[i].SpotifyURL)
+		}
+		if wantPaths[i] == "" {
+			if result.Matched() {
+				t.Errorf("track %d unexpectedly matched %s", i, result.File.Path)
+			}
+			continue
+		}
+		if !result.Matched() || result.File.Path != wantPaths[i] {
+			t.Errorf("track %d matched %+v, want %s", i, result.File, wantPaths[i])
+			continue
+		}
+		if result.Confidence != matching.ConfidenceHigh {
+			t.Errorf("track %d confidence = %s, want high", i, result.Confidence)
+		}
+	}
+}
+
+func testUpsertMusicFile(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	file := models.MusicFile{Artist: "Daft Punk", Title: "Aerodynamic", Path: "/music/a.flac", ContentHash: "hash-a"}
+
+	created, err := d.UpsertMusicFile(ctx, file)
+	if err != nil {
+		t.Fatalf("UpsertMusicFile: %v", err)
+	}
+	if created.Outcome != database.UpsertCreated || created.ID == "" {
+		t.Fatalf("first upsert = %+v, want created", created)
+	}
+
+	unchanged, err := d.UpsertMusicFile(ctx, file)
+	if err != nil {
+		t.Fatalf("UpsertMusicFile: %v", err)
+	}
+	if unchanged.Outcome != database.UpsertUnchanged || unchanged.ID != created.ID {
+		t.Errorf("repeated upsert = %+v, want unchanged %s", unchanged, created.ID)
+	}
+
+	// IndexMusicFile must not duplicate an indexed path either
+	if err := d.IndexMusicFile(ctx, file); err != nil {
+		t.Fatalf("IndexMusicFile: %v", err)
+	}
+
+	file.Genre = "French House"
+	changed, err := d.UpsertMusicFile(ctx, file)
+	if err != nil {
+		t.Fatalf("UpsertMusicFile: %v", err)
+	}
+	if changed.Outcome != database.UpsertChanged || changed.ID != created.ID {
+		t.Errorf("retagged upsert = %+v, want changed %s", changed, created.ID)
+	}
+
+	// a file found by its hash under a new path was moved
+	file.Path = "/music/moved/a.flac"
+	moved, err := d.UpsertMusicFile(ctx, file)
+	if err != nil {
+		t.Fatalf("UpsertMusicFile: %v", err)
+	}
+	if moved.Outcome != database.UpsertChanged || moved.ID != created.ID || moved.Path != file.Path {
+		t.Errorf("moved upsert = %+v, want changed %s at %s", moved, created.ID, file.Path)
+	}
+
+	found, err := d.FindMusicFiles(ctx, []string{"Daft Punk"}, []string{"Aerodynamic"})
+	if err != nil {
+		t.Fatalf("FindMusicFiles: %v", err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("found %d records for one file, want 1", len(found))
+	}
+	if found[0].Genre != "French House" || found[0].Path != file.Path {
+		t.Errorf("stored file = %+v", found[0])
+	}
+	if found[0].CreatedAt == 0 || found[0].UpdatedAt == 0 {
+		t.Errorf("timestamps not set: %+v", found[0])
+	}
+}
+
+func testUpsertMusicFiles(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	files := []models.MusicFile{
+		{Artist: "a", Title: "one", Path: "/music/1.flac"},
+		{Artist: "a", Title: "two", Path: "/music/2.flac"},
+	}
+	if _, err := d.UpsertMusicFiles(ctx, files); err != nil {
+		t.Fatalf("UpsertMusicFiles: %v", err)
+	}
+
+	files[1].Album = "album"
+	files = append(files,
+		models.MusicFile{Artist: "a", Title: "three", Path: "/music/3.flac"},
+		models.MusicFile{Artist: "a", Title: "three (final)", Path: "/music/3.flac"},
+	)
+	results, err := d.UpsertMusicFiles(ctx, files)
+	if err != nil {
+		t.Fatalf("UpsertMusicFiles: %v", err)
+	}
+
+	want := []database.UpsertOutcome{database.UpsertUnchanged, database.UpsertChanged, database.UpsertCreated, database.UpsertCreated}
+	if len(results) != len(want) {
+		t.Fatalf("UpsertMusicFiles returned %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		if result.Outcome != want[i] {
+			t.Errorf("result %d = %s, want %s", i, result.Outcome, want[i])
+		}
+	}
+	if results[2].ID != results[3].ID {
+		t.Errorf("duplicate path in one batch got two records: %s and %s", results[2].ID, results[3].ID)
+	}
+
+	found, err := d.FindMusicFiles(ctx, []string{"a", "a"}, []string{"three", "three (final)"})
+	if err != nil {
+		t.Fatalf("FindMusicFiles: %v", err)
+	}
+	if len(found) != 1 || found[0].Title != "three (final)" {
+		t.Errorf("FindMusicFiles = %+v, want only the last version of 3.flac", found)
+	}
+}
+
+func testIndexMusicFiles(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	files := make([]models.MusicFile, 5)
+	for i := range files {
+		files[i] = models.MusicFile{Artist: "a", Title: fmt.Sprintf("track %d", i), Path: fmt.Sprintf("/music/%d.flac", i)}
+	}
+
+	var progress []database.IndexProgress
+	opts := database.IndexOptions{
+		BatchSize: 2,
+		Progress:  func(p database.IndexProgress) { progress = append(progress, p) },
+	}
+	results, err := d.IndexMusicFiles(ctx, files, opts)
+	if err != nil {
+		t.Fatalf("IndexMusicFiles: %v", err)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("IndexMusicFiles returned %d results, want %d", len(results), len(files))
+	}
+	for i, result := range results {
+		if result.Err != nil || result.Outcome != database.UpsertCreated || result.Path != files[i].Path {
+			t.Errorf("result %d = %+v, want %s created", i, result, files[i].Path)
+		}
+	}
+
+	if len(progress) != 3 {
+		t.Fatalf("got %d progress reports, want 3", len(progress))
+	}
+	last := progress[2]
+	if last.Batch != 2 || last.Batches != 3 || last.Processed != 5 || last.Total != 5 || last.Created != 5 {
+		t.Errorf("last progress = %+v", last)
+	}
+
+	// resume after the first batch, the skipped files are left alone
+	files[0].Album = "skipped"
+	files[4].Album = "changed"
+	progress = nil
+	opts.StartBatch = 1
+	results, err = d.IndexMusicFiles(ctx, files, opts)
+	if err != nil {
+		t.Fatalf("resumed IndexMusicFiles: %v", err)
+	}
+	if results[0].ID != "" {
+		t.Errorf("skipped file has result %+v", results[0])
+	}
+	if results[2].Outcome != database.UpsertUnchanged || results[4].Outcome != database.UpsertChanged {
+		t.Errorf("resumed results = %+v", results)
+	}
+	if len(progress) != 2 || progress[0].Batch != 1 || progress[0].Processed != 4 {
+		t.Errorf("resumed progress = %+v", progress)
+	}
+
+	found, err := d.FindMusicFiles(ctx, []string{"a"}, []string{"track 0"})
+	if err != nil {
+		t.Fatalf("FindMusicFiles: %v", err)
+	}
+	if len(found) != 1 || found[0].Album != "" {
+		t.Errorf("file of a skipped batch was written: %+v", found)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := d.IndexMusicFiles(cancelled, files, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("IndexMusicFiles with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func testSweepUnseenMusicFiles(t *testing.T, d database.Database) {
+	ctx := context.Background()
+	files := []models.MusicFile{
+		{Artist: "a", Title: "kept", Path: "/music/kept.flac"},
+		{Artist: "a", Title: "moved away", Path: "/music/moved.flac"},
+		{Artist: "a", Title: "deleted", Path: "/music/deleted.flac"},
+	}
+
+	first, err := d.StartIndexGeneration(ctx)
+	if err != nil {
+		t.Fatalf("StartIndexGeneration: %v", err)
+	}
+	if _, err := d.IndexMusicFiles(ctx, files, database.IndexOptions{Generation: first}); err != nil {
+		t.Fatalf("IndexMusicFiles: %v", err)
+	}
+
+	second, err := d.StartIndexGeneration(ctx)
+	if err != nil {
+		t.Fatalf("StartIndexGeneration: %v", err)
+	}
+	if second != first+1 {
+		t.Fatalf("second generation = %d, want %d", second, first+1)
+	}
+	if _, err := d.IndexMusicFiles(ctx, files[:1], database.IndexOptions{Generation: second}); err != nil {
+		t.Fatalf("IndexMusicFiles: %v", err)
+	}
+	if touched, err := d.TouchMusicFiles(ctx, second, []string{files[1].Path, "/music/unknown.flac"}); err != nil || touched != 1 {
+		t.Fatalf("TouchMusicFiles = %d, %v, want 1", touched, err)
+	}
+
+	report, err := d.SweepUnseenMusicFiles(ctx, second, database.SweepOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run SweepUnseenMusicFiles: %v", err)
+	}
+	if report.Count != 1 || len(report.Paths) != 1 || report.Paths[0] != files[2].Path {
+		t.Errorf("dry run report = %+v, want only %s", report, files[2].Path)
+	}
+	if found, _ := d.FindMusicFiles(ctx, []string{"a"}, []string{"deleted"}); len(found) != 1 {
+		t.Errorf("dry run deleted a file")
+	}
+
+	report, err = d.SweepUnseenMusicFiles(ctx, second, database.SweepOptions{})
+	if err != nil {
+		t.Fatalf("SweepUnseenMusicFiles: %v", err)
+	}
+	if report.Count != 1 {
+		t.Errorf("swept %d files, want 1", report.Count)
+	}
+	if found, _ := d.FindMusicFiles(ctx, []string{"a"}, []string{"deleted"}); len(found) != 0 {
+		t.Errorf("FindMusicFiles returned soft-deleted file %+v", found)
+	}
+	if results, _ := d.MatchTracks(ctx, []spotify.TrackMetadata{{Artist: "a", Title: "deleted"}}); len(results) != 1 || results[0].Matched() {
+		t.Errorf("MatchTracks matched a soft-deleted file: %+v", results)
+	}
+	if report, _ := d.SweepUnseenMusicFiles(ctx, second, database.SweepOptions{}); report.Count != 0 {
+		t.Errorf("second sweep deleted %d files again", report.Count)
+	}
+
+	if err := d.UpdateIndexStatus(ctx, models.IndexStatus{ID: "status", LastIndexed: 100}); err != nil {
+		t.Fatalf("UpdateIndexStatus: %v", err)
+	}
+	status, err := d.GetIndexStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetIndexStatus: %v", err)
+	}
+	if status.Generation != second || status.LastIndexed != 100 {
+		t.Errorf("index status = %+v, want generation %d kept", status, second)
+	}
+	if status.LastSweep == nil || status.LastSweep.Generation != second || status.LastSweep.DryRun || status.LastSweep.Count != 0 {
+		t.Errorf("last sweep = %+v", status.LastSweep)
+	}
+
+	// a deleted file showing up again is restored
+	restored, err := d.UpsertMusicFile(ctx, files[2])
+	if err != nil {
+		t.Fatalf("UpsertMusicFile: %v", err)
+	}
+	if restored.Outcome != database.UpsertChanged {
+		t.Errorf("restoring a deleted file = %s, want %s", restored.Outcome, database.UpsertChanged)
+	}
+	if found, _ := d.FindMusicFiles(ctx, []string{"a"}, []string{"deleted"}); len(found) != 1 {
+		t.Errorf("restored file not found")
+	}
+
+	third, err := d.StartIndexGeneration(ctx)
+	if err != nil {
+		t.Fatalf("StartIndexGeneration: %v", err)
+	}
+	if _, err := d.TouchMusicFiles(ctx, third, []string{files[0].Path}); err != nil {
+		t.Fatalf("TouchMusicFiles: %v", err)
+	}
+	report, err = d.SweepUnseenMusicFiles(ctx, third, database.SweepOptions{HardDelete: true})
+	if err != nil {
+		t.Fatalf("hard SweepUnseenMusicFiles: %v", err)
+	}
+	if report.Count != 2 {
+		t.Errorf("hard sweep removed %d files, want 2", report.Count)
+	}
+	if results, _ := d.UpsertMusicFiles(ctx, files); results[1].Outcome != database.UpsertCreated {
+		t.Errorf("hard-deleted file was not removed: %+v", results[1])
+	}
+
+	if _, err := d.SweepUnseenMusicFiles(ctx, 0, database.SweepOptions{}); !errors.Is(err, database.ErrInvalidGeneration) {
+		t.Errorf("sweep of generation 0 error = %v, want %v", err, database.ErrInvalidGeneration)
+	}
+}
+
+func testIndexStatus(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	if _, err := d.GetIndexStatus(ctx); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("GetIndexStatus error = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+
+	for _, lastIndexed := range []int64{100, 200} {
+		status := models.IndexStatus{ID: "status", LastIndexed: lastIndexed, LastUpdated: lastIndexed}
+		if err := d.UpdateIndexStatus(ctx, status); err != nil {
+			t.Fatalf("UpdateIndexStatus: %v", err)
+		}
+	}
+
+	status, err := d.GetIndexStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetIndexStatus: %v", err)
+	}
+	if status.LastIndexed != 200 {
+		t.Errorf("LastIndexed = %d, want 200", status.LastIndexed)
+	}
+}
+
+func testUserTokens(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	if _, err := d.GetUserToken(ctx, 1); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetUserToken error = %v, want %v", err, database.ErrNotFound)
+	}
+
+	token := models.UserToken{CreatorID: 1, AccessToken: "a1", RefreshToken: "r1", TokenType: "Bearer", Expiry: 1000, Scope: "user-library-read"}
+	if err := d.SaveUserToken(ctx, token); err != nil {
+		t.Fatalf("SaveUserToken: %v", err)
+	}
+	stored, err := d.GetUserToken(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserToken: %v", err)
+	}
+	if stored.AccessToken != "a1" || stored.RefreshToken != "r1" || stored.Expiry != 1000 || stored.CreatedAt == 0 {
+		t.Errorf("stored token = %+v", stored)
+	}
+
+	// a refreshed token without scope keeps the granted scope
+	if err := d.SaveUserToken(ctx, models.UserToken{CreatorID: 1, AccessToken: "a2", RefreshToken: "r2", TokenType: "Bearer", Expiry: 2000}); err != nil {
+		t.Fatalf("SaveUserToken: %v", err)
+	}
+	refreshed, err := d.GetUserToken(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserToken: %v", err)
+	}
+	if refreshed.AccessToken != "a2" || refreshed.RefreshToken != "r2" || refreshed.Scope != "user-library-read" || refreshed.CreatedAt != stored.CreatedAt {
+		t.Errorf("refreshed token = %+v", refreshed)
+	}
+
+	if err := d.DeleteUserToken(ctx, 1); err != nil {
+		t.Fatalf("DeleteUserToken: %v", err)
+	}
+	if _, err := d.GetUserToken(ctx, 1); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetUserToken after delete error = %v, want %v", err, database.ErrNotFound)
+	}
+	if err := d.DeleteUserToken(ctx, 1); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("second DeleteUserToken error = %v, want %v", err, database.ErrNotFound)
+	}
+}
+
+func testEnsureIndexes(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	if _, err := d.EnsureIndexes(ctx); err != nil {
+		t.Fatalf("EnsureIndexes: %v", err)
+	}
+	report, err := d.EnsureIndexes(ctx)
+	if err != nil {
+		t.Fatalf("second EnsureIndexes: %v", err)
+	}
+	if len(report.Created) != 0 {
+		t.Errorf("second EnsureIndexes created %v, want nothing", report.Created)
+	}
+
+	url := "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy"
+	if err := d.NewDownloadRequest(ctx, url, "", 1); err != nil {
+		t.Fatalf("NewDownloadRequest: %v", err)
+	}
+	if err := d.NewDownloadRequest(ctx, url, "", 2); !errors.Is(err, database.ErrRequestExists) {
+		t.Errorf("duplicate NewDownloadRequest error = %v, want %v", err, database.ErrRequestExists)
+	}
+
+	// only library syncs are unique per user, playlists may be requested again
+	playlist := "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M"
+	for range 2 {
+		if err := d.NewPlaylistRequest(ctx, playlist, 1); err != nil {
+			t.Fatalf("NewPlaylistRequest: %v", err)
+		}
+	}
+	if err := d.NewLibrarySyncRequest(ctx, 1, spotify.SpotifyObjectTypeSavedTracks); err != nil {
+		t.Fatalf("NewLibrarySyncRequest: %v", err)
+	}
+	if err := d.NewLibrarySyncRequest(ctx, 1, spotify.SpotifyObjectTypeSavedTracks); !errors.Is(err, database.ErrRequestExists) {
+		t.Errorf("duplicate NewLibrarySyncRequest error = %v, want %v", err, database.ErrRequestExists)
+	}
+	if err := d.NewLibrarySyncRequest(ctx, 2, spotify.SpotifyObjectTypeSavedTracks); err != nil {
+		t.Errorf("NewLibrarySyncRequest of another user: %v", err)
+	}
+}
+
+func testEnsureIndexesDuplicates(t *testing.T, d database.Database) {
+	ctx := context.Background()
+
+	// without the unique index duplicates can be stored
+	url := "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy"
+	for creatorID := int64(1); creatorID <= 2; creatorID++ {
+		if err := d.NewDownloadRequest(ctx, url, "", creatorID); err != nil {
+			t.Fatalf("NewDownloadRequest: %v", err)
+		}
+	}
+	// repeated playlist requests do not block the indexes
+	playlist := "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M"
+	for range 2 {
+		if err := d.NewPlaylistRequest(ctx, playlist, 1); err != nil {
+			t.Fatalf("NewPlaylistRequest: %v", err)
+		}
+	}
+
+	if _, err := d.EnsureIndexes(ctx); !errors.Is(err, database.ErrDuplicateKeys) {
+		t.Fatalf("EnsureIndexes with duplicates error = %v, want %v", err, database.ErrDuplicateKeys)
+	}
+
+	requests, err := d.GetActiveRequests(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveRequests: %v", err)
+	}
+	if err := d.TransitionRequest(ctx, requests[1].ID, models.RequestStatusCancelled, "duplicate"); err != nil {
+		t.Fatalf("TransitionRequest: %v", err)
+	}
+	if _, err := d.EnsureIndexes(ctx); err != nil {
+		t.Errorf("EnsureIndexes after removing the duplicate: %v", err)
+	}
+}
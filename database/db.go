@@ -2,8 +2,11 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/matching"
+	"github.com/supperdoggy/spot-models/spotify"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -15,16 +18,45 @@ type Database interface {
 	CheckIfRequestAlreadySynced(ctx context.Context, url string) (bool, error)
 	NewDownloadRequest(ctx context.Context, url, name string, creatorID int64) error
 	UpdateActiveRequest(ctx context.Context, request models.DownloadQueueRequest) error
+	ClaimNextRequest(ctx context.Context, workerID string, leaseDuration time.Duration) (models.DownloadQueueRequest, error)
+	RenewLease(ctx context.Context, id, workerID string, leaseDuration time.Duration) error
+	ReleaseLease(ctx context.Context, id, workerID string) error
+	RequeueExpiredLeases(ctx context.Context) (int64, error)
+	TransitionRequest(ctx context.Context, id string, to models.RequestStatus, reason string) error
+	ListDownloadRequests(ctx context.Context, filter DownloadRequestFilter, page PageRequest) (DownloadRequestPage, error)
+	SetRequestTracks(ctx context.Context, id string, tracks []spotify.TrackMetadata) error
+	RecordTrackAttempt(ctx context.Context, requestID, trackURL string, attempt TrackAttempt) (spotify.TrackMetadata, error)
+	TracksDueForRetry(ctx context.Context, now time.Time, limit int) ([]TrackRetry, error)
 
 	GetActivePlaylists(ctx context.Context) ([]models.PlaylistRequest, error)
 	UpdatePlaylistRequest(ctx context.Context, request models.PlaylistRequest) error
 	NewPlaylistRequest(ctx context.Context, url string, creatorID int64) error
+	NewLibrarySyncRequest(ctx context.Context, creatorID int64, objectType spotify.SpotifyObjectType) error
+	TransitionPlaylistRequest(ctx context.Context, id string, to models.RequestStatus, reason string) error
+	UpdatePlaylistSnapshot(ctx context.Context, id string, snapshot models.PlaylistSnapshot) error
+	GetPlaylistSnapshot(ctx context.Context, id string) (models.PlaylistSnapshot, error)
+	DiffPlaylist(ctx context.Context, id string) (models.PlaylistDiff, error)
+
+	MigrateRequestStatuses(ctx context.Context) (int64, error)
 
 	FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error)
+	MatchTracks(ctx context.Context, tracks []spotify.TrackMetadata) ([]matching.MatchResult, error)
 	IndexMusicFile(ctx context.Context, file models.MusicFile) error
+	UpsertMusicFile(ctx context.Context, file models.MusicFile) (UpsertResult, error)
+	UpsertMusicFiles(ctx context.Context, files []models.MusicFile) ([]UpsertResult, error)
+	IndexMusicFiles(ctx context.Context, files []models.MusicFile, opts IndexOptions) ([]IndexFileResult, error)
+	StartIndexGeneration(ctx context.Context) (int64, error)
+	TouchMusicFiles(ctx context.Context, generation int64, paths []string) (int64, error)
+	SweepUnseenMusicFiles(ctx context.Context, generation int64, opts SweepOptions) (models.SweepReport, error)
+
+	SaveUserToken(ctx context.Context, token models.UserToken) error
+	GetUserToken(ctx context.Context, creatorID int64) (models.UserToken, error)
+	DeleteUserToken(ctx context.Context, creatorID int64) error
 
 	GetIndexStatus(ctx context.Context) (models.IndexStatus, error)
 	UpdateIndexStatus(ctx context.Context, status models.IndexStatus) error
+
+	EnsureIndexes(ctx context.Context) (IndexReport, error)
 }
 
 type db struct {
@@ -40,12 +72,20 @@ func NewDatabase(ctx context.Context, log *zap.Logger, cfg *DataBaseConfig) (Dat
 		return nil, err
 	}
 
-	return &db{
+	d := &db{
 		conn: conn,
 		log:  log,
 
 		cfg: cfg,
-	}, nil
+	}
+
+	if cfg.EnsureIndexes {
+		if _, err := d.EnsureIndexes(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
 }
 
 func (d *db) reconnectToDB() error {
@@ -0,0 +1,100 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/database/databasetest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// TestConformance runs the shared suite against a real MongoDB when
+// SPOT_MODELS_TEST_MONGO_URL is set
+func TestConformance(t *testing.T) {
+	url := os.Getenv("SPOT_MODELS_TEST_MONGO_URL")
+	if url == "" {
+		t.Skip("SPOT_MODELS_TEST_MONGO_URL is not set")
+	}
+
+	databasetest.Run(t, func(t *testing.T) database.Database {
+		ctx := context.Background()
+		cfg := &database.DataBaseConfig{
+			DatabaseURL:                   url,
+			DatabaseName:                  fmt.Sprintf("spot_models_test_%d", time.Now().UnixNano()),
+			MusicFilesCollectionName:      "music_files",
+			DownloadRequestCollectionName: "download_requests",
+			PlaylistRequestCollectionName: "playlist_requests",
+			IndexStatusCollectionName:     "index_status",
+		}
+
+		d, err := database.NewDatabase(ctx, zap.NewNop(), cfg)
+		if err != nil {
+			t.Fatalf("NewDatabase: %v", err)
+		}
+
+		t.Cleanup(func() {
+			client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+			if err != nil {
+				t.Logf("failed to connect for cleanup: %v", err)
+				return
+			}
+			defer client.Disconnect(ctx)
+			if err := client.Database(cfg.DatabaseName).Drop(ctx); err != nil {
+				t.Logf("failed to drop test database: %v", err)
+			}
+		})
+
+		return d
+	})
+}
+
+// TestEnsureIndexesConflict runs against a real MongoDB when
+// SPOT_MODELS_TEST_MONGO_URL is set
+func TestEnsureIndexesConflict(t *testing.T) {
+	url := os.Getenv("SPOT_MODELS_TEST_MONGO_URL")
+	if url == "" {
+		t.Skip("SPOT_MODELS_TEST_MONGO_URL is not set")
+	}
+
+	ctx := context.Background()
+	cfg := &database.DataBaseConfig{
+		DatabaseURL:                   url,
+		DatabaseName:                  fmt.Sprintf("spot_models_test_%d", time.Now().UnixNano()),
+		MusicFilesCollectionName:      "music_files",
+		DownloadRequestCollectionName: "download_requests",
+		PlaylistRequestCollectionName: "playlist_requests",
+		IndexStatusCollectionName:     "index_status",
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	defer client.Database(cfg.DatabaseName).Drop(ctx)
+
+	// the url index without the unique flag EnsureIndexes wants
+	_, err = client.Database(cfg.DatabaseName).Collection(cfg.DownloadRequestCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "spotify_url", Value: 1}},
+		Options: options.Index().SetName("spotify_url").SetPartialFilterExpression(bson.M{"active": true}),
+	})
+	if err != nil {
+		t.Fatalf("CreateOne: %v", err)
+	}
+
+	d, err := database.NewDatabase(ctx, zap.NewNop(), cfg)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	if _, err := d.EnsureIndexes(ctx); !errors.Is(err, database.ErrIndexConflict) {
+		t.Errorf("EnsureIndexes error = %v, want %v", err, database.ErrIndexConflict)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"time"
 
 	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
 	"github.com/gofrs/uuid"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -58,16 +61,26 @@ func (d *db) NewDownloadRequest(ctx context.Context, url, name string, creatorID
 		return err
 	}
 
+	var objectType spotify.SpotifyObjectType
+	if ref, err := spotify.ParseURL(url); err == nil {
+		objectType = ref.Type
+	}
+
 	request := models.DownloadQueueRequest{
 		SpotifyURL: url,
+		ObjectType: objectType,
 		Name:       name,
 		Active:     true,
+		Status:     models.RequestStatusQueued,
 		ID:         id.String(),
 		CreatedAt:  time.Now().Unix(),
 		CreatorID:  creatorID,
 	}
 
 	_, err = d.downloadQueueRequestCollection().InsertOne(ctx, request)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrRequestExists
+	}
 	if err != nil {
 		return err
 	}
@@ -75,28 +88,131 @@ func (d *db) NewDownloadRequest(ctx context.Context, url, name string, creatorID
 	return nil
 }
 
+// UpdateActiveRequest stores the flags and counters of a request. Its stored
+// status follows the Active/Errored flags, see models.StatusForFlags; the
+// Status of request is ignored. ErrStatusChanged is returned if the status
+// changed concurrently.
 func (d *db) UpdateActiveRequest(ctx context.Context, request models.DownloadQueueRequest) error {
-	info, err := d.downloadQueueRequestCollection().UpdateOne(ctx, bson.M{"_id": request.ID}, bson.M{"$set": bson.M{
-		"active":      request.Active,
+	return d.updateRequestFlags(ctx, d.downloadQueueRequestCollection(), request.ID, request.Active, request.Errored, bson.M{
 		"sync_count":  request.SyncCount,
-		"errored":     request.Errored,
 		"retry_count": request.RetryCount,
+	})
+}
+
+func (d *db) DeactivateRequest(ctx context.Context, id string) error {
+	_, err := d.downloadQueueRequestCollection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"active": false, "updated_at": time.Now().Unix()}})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimNextRequest atomically leases the oldest active request that is not
+// leased by another worker and moves it to downloading. Only queued requests
+// and downloading ones whose lease expired are claimable, see
+// models.RequestStatus.Claimable.
+func (d *db) ClaimNextRequest(ctx context.Context, workerID string, leaseDuration time.Duration) (models.DownloadQueueRequest, error) {
+	now := time.Now()
+	filter := bson.M{
+		"active": true,
+		"status": bson.M{"$in": []interface{}{nil, "", models.RequestStatusQueued, models.RequestStatusDownloading}},
+		"$or": []bson.M{
+			{"lease_expires_at": bson.M{"$exists": false}},
+			{"lease_expires_at": bson.M{"$lte": now.Unix()}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":           models.RequestStatusDownloading,
+		"status_reason":    "",
+		"lease_owner":      workerID,
+		"lease_expires_at": now.Add(leaseDuration).Unix(),
+		"updated_at":       now.Unix(),
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"created_at": 1}).
+		SetReturnDocument(options.After)
+
+	var req models.DownloadQueueRequest
+	err := d.downloadQueueRequestCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&req)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.DownloadQueueRequest{}, ErrNoRequestsAvailable
+	}
+	if err != nil {
+		return models.DownloadQueueRequest{}, err
+	}
+
+	return req, nil
+}
+
+// RenewLease extends the lease on a request held by workerID
+func (d *db) RenewLease(ctx context.Context, id, workerID string, leaseDuration time.Duration) error {
+	now := time.Now()
+	info, err := d.downloadQueueRequestCollection().UpdateOne(ctx, bson.M{"_id": id, "lease_owner": workerID}, bson.M{"$set": bson.M{
+		"lease_expires_at": now.Add(leaseDuration).Unix(),
+		"updated_at":       now.Unix(),
 	}})
 	if err != nil {
 		return err
 	}
 
 	if info.MatchedCount == 0 {
-		return errors.New("not found")
+		return ErrLeaseNotHeld
 	}
 	return nil
 }
 
-func (d *db) DeactivateRequest(ctx context.Context, id string) error {
-	_, err := d.downloadQueueRequestCollection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"active": false, "updated_at": time.Now().Unix()}})
+// ReleaseLease gives up the lease on a request held by workerID. A request
+// still downloading goes back to queued so another worker can claim it.
+func (d *db) ReleaseLease(ctx context.Context, id, workerID string) error {
+	info, err := d.downloadQueueRequestCollection().UpdateOne(ctx, bson.M{"_id": id, "lease_owner": workerID}, []bson.M{
+		{"$set": bson.M{
+			"status": bson.M{"$cond": []interface{}{
+				bson.M{"$eq": []interface{}{"$status", models.RequestStatusDownloading}},
+				models.RequestStatusQueued,
+				"$status",
+			}},
+			"updated_at": time.Now().Unix(),
+		}},
+		{"$unset": []string{"lease_owner", "lease_expires_at"}},
+	})
 	if err != nil {
 		return err
 	}
 
+	if info.MatchedCount == 0 {
+		return ErrLeaseNotHeld
+	}
 	return nil
 }
+
+// RequeueExpiredLeases clears leases of active requests that expired without
+// being renewed or released, returning the number of requests put back in
+// the queue. Requests still downloading are moved back to queued.
+func (d *db) RequeueExpiredLeases(ctx context.Context) (int64, error) {
+	now := time.Now().Unix()
+	expired := bson.M{"active": true, "lease_expires_at": bson.M{"$lte": now}}
+	unset := bson.M{"lease_owner": "", "lease_expires_at": ""}
+
+	downloading := bson.M{"active": true, "lease_expires_at": bson.M{"$lte": now}, "status": models.RequestStatusDownloading}
+	requeued, err := d.downloadQueueRequestCollection().UpdateMany(ctx, downloading, bson.M{
+		"$unset": unset,
+		"$set":   bson.M{"status": models.RequestStatusQueued, "status_reason": "lease expired", "updated_at": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+	info, err := d.downloadQueueRequestCollection().UpdateMany(ctx, expired, bson.M{
+		"$unset": unset,
+		"$set":   bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return requeued.ModifiedCount, err
+	}
+
+	count := requeued.ModifiedCount + info.ModifiedCount
+	if count > 0 {
+		d.log.Info("requeued requests with expired leases", zap.Int64("count", count))
+	}
+	return count, nil
+}
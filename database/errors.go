@@ -6,4 +6,16 @@ var (
 	ErrNotSure             = errors.New("please be sure what you are doing")
 	ErrEmptyCollectionName = errors.New("collection name cannot be empty")
 	ErrEmptyDBName         = errors.New("database name cannot be empty")
+	ErrNoRequestsAvailable = errors.New("no download requests available")
+	ErrLeaseNotHeld        = errors.New("lease is not held by this worker")
+	ErrNotFound            = errors.New("not found")
+	ErrStatusChanged       = errors.New("request status was changed concurrently")
+	ErrInvalidCursor       = errors.New("invalid page cursor")
+	ErrRequestExists       = errors.New("an active request for this url already exists")
+	ErrMusicFileExists     = errors.New("a music file with this path already exists")
+	ErrInvalidGeneration   = errors.New("index generation must be positive")
+	ErrNoSnapshot          = errors.New("playlist has no snapshot yet")
+	ErrTrackChanged        = errors.New("track was changed concurrently")
+	ErrDuplicateKeys       = errors.New("duplicate documents prevent a unique index, run the migrations first")
+	ErrIndexConflict       = errors.New("an index with the same keys but different options exists")
 )
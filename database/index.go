@@ -2,18 +2,16 @@ package database
 
 import (
 	"context"
-	"time"
 
 	"github.com/supperdoggy/spot-models"
-	"github.com/gofrs/uuid"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
 )
 
-// IndexMusicFile indexes a music file in the database
+// IndexMusicFile indexes a music file in the database. Re-indexing a path
+// updates the existing record, see UpsertMusicFile.
 func (d *db) IndexMusicFile(ctx context.Context, file models.MusicFile) error {
-	file.ID = uuid.Must(uuid.NewV4()).String()
-	file.CreatedAt = time.Now().Unix()
-	_, err := d.musicFilesCollection().InsertOne(ctx, file)
+	_, err := d.UpsertMusicFile(ctx, file)
 	return err
 }
 
@@ -27,10 +25,25 @@ func (d *db) GetIndexStatus(ctx context.Context) (models.IndexStatus, error) {
 	return status, nil
 }
 
+// UpdateIndexStatus stores the index status. Generation and LastSweep are
+// left alone when unset, they are maintained by StartIndexGeneration and
+// SweepUnseenMusicFiles.
 func (d *db) UpdateIndexStatus(ctx context.Context, status models.IndexStatus) error {
+	set := bson.M{
+		"last_indexed": status.LastIndexed,
+		"last_updated": status.LastUpdated,
+	}
+	if status.Generation != 0 {
+		set["generation"] = status.Generation
+	}
+	if status.LastSweep != nil {
+		set["last_sweep"] = status.LastSweep
+	}
+
 	_, err := d.indexStatusCollection().UpdateOne(ctx, bson.M{}, bson.M{
-		"$set": status,
-	})
+		"$set":         set,
+		"$setOnInsert": bson.M{"_id": status.ID},
+	}, options.Update().SetUpsert(true))
 	if err != nil {
 		return err
 	}
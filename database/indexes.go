@@ -0,0 +1,245 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/supperdoggy/spot-models/spotify"
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IndexReport lists the indexes created by EnsureIndexes
+type IndexReport struct {
+	Created []CreatedIndex
+}
+
+// CreatedIndex is an index created by EnsureIndexes
+type CreatedIndex struct {
+	Collection string
+	Name       string
+}
+
+// collectionIndexes returns the indexes every collection should have
+func (d *db) collectionIndexes() map[*mongo.Collection][]mongo.IndexModel {
+	return map[*mongo.Collection][]mongo.IndexModel{
+		d.downloadQueueRequestCollection(): {
+			{
+				Keys:    orderedDoc{{Name: "spotify_url", Value: 1}, {Name: "active", Value: 1}},
+				Options: options.Index().SetName("spotify_url_active"),
+			},
+			{
+				// only one active request per url
+				Keys: orderedDoc{{Name: "spotify_url", Value: 1}},
+				Options: options.Index().SetName("active_spotify_url_unique").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{"active": true}),
+			},
+			{
+				Keys:    orderedDoc{{Name: "active", Value: 1}, {Name: "lease_expires_at", Value: 1}, {Name: "created_at", Value: 1}},
+				Options: options.Index().SetName("claim"),
+			},
+			{
+				Keys:    orderedDoc{{Name: "created_at", Value: -1}, {Name: "_id", Value: -1}},
+				Options: options.Index().SetName("created"),
+			},
+			{
+				Keys:    orderedDoc{{Name: "creator_id", Value: 1}, {Name: "created_at", Value: -1}, {Name: "_id", Value: -1}},
+				Options: options.Index().SetName("creator_created"),
+			},
+			{
+				Keys:    orderedDoc{{Name: "status", Value: 1}, {Name: "created_at", Value: -1}, {Name: "_id", Value: -1}},
+				Options: options.Index().SetName("status_created"),
+			},
+			{
+				Keys:    orderedDoc{{Name: "active", Value: 1}, {Name: "track_metadata.next_attempt_at", Value: 1}},
+				Options: options.Index().SetName("track_retry"),
+			},
+		},
+		d.playlistsCollection(): {
+			{
+				Keys:    orderedDoc{{Name: "active", Value: 1}},
+				Options: options.Index().SetName("active"),
+			},
+			{
+				Keys:    orderedDoc{{Name: "spotify_url", Value: 1}},
+				Options: options.Index().SetName("spotify_url"),
+			},
+			{
+				// only one active library sync per user and collection, a
+				// playlist may be requested again while a request is active.
+				// $in in a partial filter needs MongoDB 6.0.
+				Keys: orderedDoc{{Name: "creator_id", Value: 1}, {Name: "spotify_url", Value: 1}},
+				Options: options.Index().SetName("active_library_sync_unique").
+					SetUnique(true).
+					SetPartialFilterExpression(orderedDoc{
+						{Name: "active", Value: true},
+						{Name: "object_type", Value: bson.M{"$in": []spotify.SpotifyObjectType{spotify.SpotifyObjectTypeSavedTracks, spotify.SpotifyObjectTypeSavedAlbums}}},
+					}),
+			},
+		},
+		d.playlistSnapshotsCollection(): {
+			{
+				Keys:    orderedDoc{{Name: "request_id", Value: 1}, {Name: "version", Value: -1}},
+				Options: options.Index().SetName("request_version"),
+			},
+		},
+		d.musicFilesCollection(): {
+			{
+				Keys:    orderedDoc{{Name: "path", Value: 1}},
+				Options: options.Index().SetName("path_unique").SetUnique(true),
+			},
+			{
+				Keys:    orderedDoc{{Name: "artist", Value: 1}, {Name: "title", Value: 1}},
+				Options: options.Index().SetName("artist_title"),
+			},
+			{
+				Keys:    orderedDoc{{Name: "artist", Value: "text"}, {Name: "title", Value: "text"}, {Name: "album", Value: "text"}},
+				Options: options.Index().SetName("text_search"),
+			},
+			{
+				Keys:    orderedDoc{{Name: "index_generation", Value: 1}},
+				Options: options.Index().SetName("index_generation"),
+			},
+			{
+				// candidate lookup of MatchTracks
+				Keys:    orderedDoc{{Name: "title_words", Value: 1}},
+				Options: options.Index().SetName("title_words"),
+			},
+		},
+	}
+}
+
+// EnsureIndexes creates missing indexes on all collections. It is safe to run
+// on every start; an index counts as existing when one with the same keys is
+// there, whatever its name. Unique indexes cannot be created while duplicates
+// exist, EnsureIndexes then fails with ErrDuplicateKeys and the duplicates
+// have to be removed by the migrations first. An existing index whose unique
+// flag or partial filter differs fails with ErrIndexConflict; it has to be
+// dropped so EnsureIndexes can create it again.
+func (d *db) EnsureIndexes(ctx context.Context) (IndexReport, error) {
+	var report IndexReport
+	for coll, indexes := range d.collectionIndexes() {
+		existing, err := existingIndexes(ctx, coll)
+		if err != nil {
+			return report, fmt.Errorf("failed to list indexes of %s: %w", coll.Name(), err)
+		}
+
+		for _, model := range indexes {
+			name := *model.Options.Name
+			if spec, ok := existing[indexKey(model.Keys.(orderedDoc))]; ok {
+				if err := compareIndexOptions(model, spec); err != nil {
+					return report, fmt.Errorf("%w: index %s on %s: %v", ErrIndexConflict, spec.Name, coll.Name(), err)
+				}
+				if spec.Name != name {
+					d.log.Debug("index exists under another name", zap.String("collection", coll.Name()),
+						zap.String("index", name), zap.String("existing", spec.Name))
+				}
+				continue
+			}
+
+			if _, err := coll.Indexes().CreateOne(ctx, model); err != nil {
+				if mongo.IsDuplicateKeyError(err) {
+					return report, fmt.Errorf("%w: index %s on %s: %v", ErrDuplicateKeys, name, coll.Name(), err)
+				}
+				return report, fmt.Errorf("failed to create index %s on %s: %w", name, coll.Name(), err)
+			}
+			d.log.Info("created index", zap.String("collection", coll.Name()), zap.String("index", name))
+			report.Created = append(report.Created, CreatedIndex{Collection: coll.Name(), Name: name})
+		}
+	}
+
+	return report, nil
+}
+
+// existingIndex is an index as listIndexes reports it
+type existingIndex struct {
+	Name    string         `bson:"name"`
+	Key     driverbson.Raw `bson:"key"`
+	Unique  bool           `bson:"unique"`
+	Partial driverbson.M   `bson:"partialFilterExpression"`
+}
+
+// existingIndexes maps the key of every index of coll to the index, see indexKey
+func existingIndexes(ctx context.Context, coll *mongo.Collection) (map[string]existingIndex, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		// the collection does not exist yet
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+			return map[string]existingIndex{}, nil
+		}
+		return nil, err
+	}
+
+	var indexes []existingIndex
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]existingIndex, len(indexes))
+	for _, index := range indexes {
+		elements, err := index.Key.Elements()
+		if err != nil {
+			return nil, err
+		}
+
+		var doc orderedDoc
+		for _, element := range elements {
+			value := element.Value()
+			if s, ok := value.StringValueOK(); ok {
+				doc = append(doc, bson.DocElem{Name: element.Key(), Value: s})
+			} else if n, ok := value.AsInt64OK(); ok {
+				doc = append(doc, bson.DocElem{Name: element.Key(), Value: n})
+			} else {
+				doc = append(doc, bson.DocElem{Name: element.Key(), Value: value.String()})
+			}
+		}
+		keys[indexKey(doc)] = index
+	}
+	return keys, nil
+}
+
+// compareIndexOptions reports how index differs from model in the options
+// that change which documents it accepts: unique and partialFilterExpression
+func compareIndexOptions(model mongo.IndexModel, index existingIndex) error {
+	wantUnique := model.Options.Unique != nil && *model.Options.Unique
+	if index.Unique != wantUnique {
+		return fmt.Errorf("unique is %t, want %t", index.Unique, wantUnique)
+	}
+
+	var want driverbson.M
+	if model.Options.PartialFilterExpression != nil {
+		data, err := driverbson.Marshal(model.Options.PartialFilterExpression)
+		if err != nil {
+			return err
+		}
+		if err := driverbson.Unmarshal(data, &want); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(index.Partial, want) {
+		return fmt.Errorf("partial filter is %v, want %v", index.Partial, want)
+	}
+	return nil
+}
+
+// indexKey identifies an index by its key pattern, e.g. "spotify_url:1,active:1".
+// MongoDB stores the keys of text indexes as _fts and _ftsx and a collection
+// has at most one, so every text index has the key "text".
+func indexKey(keys orderedDoc) string {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.Value == "text" || key.Name == "_fts" {
+			return "text"
+		}
+		parts = append(parts, fmt.Sprintf("%s:%v", key.Name, key.Value))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"testing"
+
+	driverbson "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCompareIndexOptions(t *testing.T) {
+	unique := mongo.IndexModel{
+		Keys:    orderedDoc{{Name: "spotify_url", Value: 1}},
+		Options: options.Index().SetName("active_spotify_url_unique").SetUnique(true).SetPartialFilterExpression(bson.M{"active": true}),
+	}
+	plain := mongo.IndexModel{
+		Keys:    orderedDoc{{Name: "spotify_url", Value: 1}},
+		Options: options.Index().SetName("spotify_url"),
+	}
+
+	tests := []struct {
+		name     string
+		model    mongo.IndexModel
+		index    existingIndex
+		conflict bool
+	}{
+		{"same options", unique, existingIndex{Unique: true, Partial: driverbson.M{"active": true}}, false},
+		{"plain", plain, existingIndex{}, false},
+		{"not unique", unique, existingIndex{Partial: driverbson.M{"active": true}}, true},
+		{"no partial filter", unique, existingIndex{Unique: true}, true},
+		{"other partial filter", unique, existingIndex{Unique: true, Partial: driverbson.M{"active": false}}, true},
+		{"unexpected unique", plain, existingIndex{Unique: true}, true},
+	}
+	for _, tt := range tests {
+		err := compareIndexOptions(tt.model, tt.index)
+		if (err != nil) != tt.conflict {
+			t.Errorf("%s: compareIndexOptions = %v, want conflict %t", tt.name, err, tt.conflict)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 200
+)
+
+// DownloadRequestFilter narrows ListDownloadRequests. Zero fields do not filter.
+type DownloadRequestFilter struct {
+	Statuses   []models.RequestStatus
+	CreatorID  int64
+	ObjectType spotify.SpotifyObjectType
+	// CreatedFrom and CreatedTo bound CreatedAt in unix seconds, inclusive
+	CreatedFrom int64
+	CreatedTo   int64
+	// NameContains matches a case-insensitive substring of the name
+	NameContains string
+}
+
+// SortOrder orders listed requests by creation time
+type SortOrder int
+
+const (
+	SortNewestFirst SortOrder = iota
+	SortOldestFirst
+)
+
+// PageRequest selects a page of results
+type PageRequest struct {
+	// Limit defaults to DefaultPageLimit and is capped at MaxPageLimit
+	Limit int
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+	Sort   SortOrder
+}
+
+// DownloadRequestPage is one page of ListDownloadRequests results
+type DownloadRequestPage struct {
+	Requests []models.DownloadQueueRequest
+	// NextCursor is empty on the last page
+	NextCursor string
+	// TotalCount is the number of requests matching the filter across all pages
+	TotalCount int64
+}
+
+// pageCursor is the position after the last request of a page
+type pageCursor struct {
+	CreatedAt int64  `json:"c"`
+	ID        string `json:"i"`
+}
+
+// EncodeCursor returns the cursor pointing after request
+func EncodeCursor(request models.DownloadQueueRequest) string {
+	data, _ := json.Marshal(pageCursor{CreatedAt: request.CreatedAt, ID: request.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor returns the creation time and ID a cursor points after
+func DecodeCursor(cursor string) (createdAt int64, id string, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return 0, "", ErrInvalidCursor
+	}
+	return c.CreatedAt, c.ID, nil
+}
+
+// Normalize applies the default and maximum limit
+func (p PageRequest) Normalize() PageRequest {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+	return p
+}
+
+// ListDownloadRequests returns a page of download requests matching filter
+func (d *db) ListDownloadRequests(ctx context.Context, filter DownloadRequestFilter, page PageRequest) (DownloadRequestPage, error) {
+	page = page.Normalize()
+	query := downloadRequestQuery(filter)
+
+	total, err := d.downloadQueueRequestCollection().CountDocuments(ctx, query)
+	if err != nil {
+		return DownloadRequestPage{}, err
+	}
+
+	direction := -1
+	comparison := "$lt"
+	if page.Sort == SortOldestFirst {
+		direction = 1
+		comparison = "$gt"
+	}
+
+	if page.Cursor != "" {
+		createdAt, id, err := DecodeCursor(page.Cursor)
+		if err != nil {
+			return DownloadRequestPage{}, err
+		}
+		query = bson.M{"$and": []bson.M{query, {"$or": []bson.M{
+			{"created_at": bson.M{comparison: createdAt}},
+			{"created_at": createdAt, "_id": bson.M{comparison: id}},
+		}}}}
+	}
+
+	opts := options.Find().
+		SetSort(orderedDoc{{Name: "created_at", Value: direction}, {Name: "_id", Value: direction}}).
+		SetLimit(int64(page.Limit + 1))
+	cursor, err := d.downloadQueueRequestCollection().Find(ctx, query, opts)
+	if err != nil {
+		return DownloadRequestPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	requests := make([]models.DownloadQueueRequest, 0, page.Limit)
+	if err := cursor.All(ctx, &requests); err != nil {
+		return DownloadRequestPage{}, err
+	}
+
+	result := DownloadRequestPage{TotalCount: total}
+	if len(requests) > page.Limit {
+		requests = requests[:page.Limit]
+		result.NextCursor = EncodeCursor(requests[len(requests)-1])
+	}
+	result.Requests = requests
+
+	return result, nil
+}
+
+func downloadRequestQuery(filter DownloadRequestFilter) bson.M {
+	query := bson.M{}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if filter.CreatorID != 0 {
+		query["creator_id"] = filter.CreatorID
+	}
+	if filter.ObjectType != "" {
+		query["object_type"] = filter.ObjectType
+	}
+
+	created := bson.M{}
+	if filter.CreatedFrom != 0 {
+		created["$gte"] = filter.CreatedFrom
+	}
+	if filter.CreatedTo != 0 {
+		created["$lte"] = filter.CreatedTo
+	}
+	if len(created) > 0 {
+		query["created_at"] = created
+	}
+
+	if filter.NameContains != "" {
+		query["name"] = bson.M{"$regex": regexp.QuoteMeta(filter.NameContains), "$options": "i"}
+	}
+
+	return query
+}
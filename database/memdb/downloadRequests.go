@@ -0,0 +1,209 @@
+package memdb
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (m *DB) GetActiveRequests(ctx context.Context) ([]models.DownloadQueueRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var requests []models.DownloadQueueRequest
+	for _, id := range m.requestOrder {
+		if req := m.requests[id]; req.Active {
+			requests = append(requests, cloneRequest(req))
+		}
+	}
+
+	return requests, nil
+}
+
+func (m *DB) GetActiveRequest(ctx context.Context, url string) (models.DownloadQueueRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range m.requestOrder {
+		if req := m.requests[id]; req.Active && req.SpotifyURL == url {
+			return cloneRequest(req), nil
+		}
+	}
+
+	return models.DownloadQueueRequest{}, mongo.ErrNoDocuments
+}
+
+func (m *DB) CheckIfRequestAlreadySynced(ctx context.Context, url string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, req := range m.requests {
+		if !req.Active && req.SpotifyURL == url {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *DB) NewDownloadRequest(ctx context.Context, url, name string, creatorID int64) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexed {
+		for _, req := range m.requests {
+			if req.Active && req.SpotifyURL == url {
+				return database.ErrRequestExists
+			}
+		}
+	}
+
+	var objectType spotify.SpotifyObjectType
+	if ref, err := spotify.ParseURL(url); err == nil {
+		objectType = ref.Type
+	}
+
+	m.requests[id.String()] = models.DownloadQueueRequest{
+		SpotifyURL: url,
+		ObjectType: objectType,
+		Name:       name,
+		Active:     true,
+		Status:     models.RequestStatusQueued,
+		ID:         id.String(),
+		CreatedAt:  time.Now().Unix(),
+		CreatorID:  creatorID,
+	}
+	m.requestOrder = append(m.requestOrder, id.String())
+
+	return nil
+}
+
+func (m *DB) UpdateActiveRequest(ctx context.Context, request models.DownloadQueueRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.requests[request.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	req.Active = request.Active
+	req.SyncCount = request.SyncCount
+	req.Errored = request.Errored
+	req.RetryCount = request.RetryCount
+	req.Status = models.StatusForFlags(req.Status, request.Active, request.Errored)
+	if req.Status != models.RequestStatusDownloading {
+		req.LeaseOwner = ""
+		req.LeaseExpiresAt = 0
+	}
+	req.UpdatedAt = time.Now().Unix()
+	m.requests[req.ID] = req
+
+	return nil
+}
+
+func (m *DB) ClaimNextRequest(ctx context.Context, workerID string, leaseDuration time.Duration) (models.DownloadQueueRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var next *models.DownloadQueueRequest
+	for _, id := range m.requestOrder {
+		req := m.requests[id]
+		if !req.Active || !req.Status.Claimable() || (req.LeaseExpiresAt != 0 && req.LeaseExpiresAt > now.Unix()) {
+			continue
+		}
+		if next == nil || req.CreatedAt < next.CreatedAt {
+			next = &req
+		}
+	}
+	if next == nil {
+		return models.DownloadQueueRequest{}, database.ErrNoRequestsAvailable
+	}
+
+	next.Status = models.RequestStatusDownloading
+	next.StatusReason = ""
+	next.LeaseOwner = workerID
+	next.LeaseExpiresAt = now.Add(leaseDuration).Unix()
+	next.UpdatedAt = now.Unix()
+	m.requests[next.ID] = *next
+
+	return cloneRequest(*next), nil
+}
+
+func (m *DB) RenewLease(ctx context.Context, id, workerID string, leaseDuration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.requests[id]
+	if !ok || req.LeaseOwner != workerID {
+		return database.ErrLeaseNotHeld
+	}
+
+	now := time.Now()
+	req.LeaseExpiresAt = now.Add(leaseDuration).Unix()
+	req.UpdatedAt = now.Unix()
+	m.requests[id] = req
+
+	return nil
+}
+
+func (m *DB) ReleaseLease(ctx context.Context, id, workerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.requests[id]
+	if !ok || req.LeaseOwner != workerID {
+		return database.ErrLeaseNotHeld
+	}
+
+	if req.Status == models.RequestStatusDownloading {
+		req.Status = models.RequestStatusQueued
+	}
+	req.LeaseOwner = ""
+	req.LeaseExpiresAt = 0
+	req.UpdatedAt = time.Now().Unix()
+	m.requests[id] = req
+
+	return nil
+}
+
+func (m *DB) RequeueExpiredLeases(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	var count int64
+	for id, req := range m.requests {
+		if !req.Active || req.LeaseExpiresAt == 0 || req.LeaseExpiresAt > now {
+			continue
+		}
+		if req.Status == models.RequestStatusDownloading {
+			req.Status = models.RequestStatusQueued
+			req.StatusReason = "lease expired"
+		}
+		req.LeaseOwner = ""
+		req.LeaseExpiresAt = 0
+		req.UpdatedAt = now
+		m.requests[id] = req
+		count++
+	}
+
+	return count, nil
+}
+
+func cloneRequest(req models.DownloadQueueRequest) models.DownloadQueueRequest {
+	req.TrackMetadata = slices.Clone(req.TrackMetadata)
+	return req
+}
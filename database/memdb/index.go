@@ -0,0 +1,140 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (m *DB) IndexMusicFile(ctx context.Context, file models.MusicFile) error {
+	_, err := m.UpsertMusicFile(ctx, file)
+	return err
+}
+
+func (m *DB) UpsertMusicFile(ctx context.Context, file models.MusicFile) (database.UpsertResult, error) {
+	results, err := m.UpsertMusicFiles(ctx, []models.MusicFile{file})
+	if err != nil {
+		return database.UpsertResult{}, err
+	}
+	return results[0], nil
+}
+
+func (m *DB) UpsertMusicFiles(ctx context.Context, files []models.MusicFile) ([]database.UpsertResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make(map[string]bool, len(files))
+	hashes := make(map[string]bool, len(files))
+	for _, file := range files {
+		paths[file.Path] = true
+		if file.ContentHash != "" {
+			hashes[file.ContentHash] = true
+		}
+	}
+
+	var existing []models.MusicFile
+	for _, id := range m.fileOrder {
+		if file := m.files[id]; paths[file.Path] || hashes[file.ContentHash] {
+			existing = append(existing, file)
+		}
+	}
+
+	results, writes := database.PlanMusicFileUpserts(existing, files, time.Now().Unix())
+	for _, write := range writes {
+		file := write.File
+		file.Extra = maps.Clone(file.Extra)
+		if write.Outcome == database.UpsertCreated {
+			m.fileOrder = append(m.fileOrder, file.ID)
+		}
+		m.files[file.ID] = file
+	}
+
+	return results, nil
+}
+
+func (m *DB) IndexMusicFiles(ctx context.Context, files []models.MusicFile, opts database.IndexOptions) ([]database.IndexFileResult, error) {
+	return database.RunIndexBatches(ctx, files, opts, func(ctx context.Context, batch []models.MusicFile) ([]database.IndexFileResult, error) {
+		upserts, err := m.UpsertMusicFiles(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		results := make([]database.IndexFileResult, len(upserts))
+		for i, upsert := range upserts {
+			results[i] = database.IndexFileResult{UpsertResult: upsert}
+		}
+		return results, nil
+	}, m.TouchMusicFiles)
+}
+
+func (m *DB) GetIndexStatus(ctx context.Context) (models.IndexStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexStatus == nil {
+		return models.IndexStatus{}, mongo.ErrNoDocuments
+	}
+
+	return *m.indexStatus, nil
+}
+
+func (m *DB) UpdateIndexStatus(ctx context.Context, status models.IndexStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexStatus != nil {
+		status.ID = m.indexStatus.ID
+		if status.Generation == 0 {
+			status.Generation = m.indexStatus.Generation
+		}
+		if status.LastSweep == nil {
+			status.LastSweep = m.indexStatus.LastSweep
+		}
+	}
+
+	m.indexStatus = &status
+	return nil
+}
+
+// EnsureIndexes enables unique constraints, failing like MongoDB while
+// active requests share a url or a user has several active library syncs of
+// a collection. memdb has no indexes to create, so the report is always
+// empty.
+func (m *DB) EnsureIndexes(ctx context.Context) (database.IndexReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active := make(map[string]bool)
+	for _, req := range m.requests {
+		if !req.Active {
+			continue
+		}
+		if active[req.SpotifyURL] {
+			return database.IndexReport{}, fmt.Errorf("%w: active request url %s", database.ErrDuplicateKeys, req.SpotifyURL)
+		}
+		active[req.SpotifyURL] = true
+	}
+	type playlistKey struct {
+		creatorID int64
+		url       string
+	}
+	playlists := make(map[playlistKey]bool)
+	for _, req := range m.playlists {
+		if !req.Active || !req.ObjectType.IsLibrary() {
+			continue
+		}
+		key := playlistKey{req.CreatorID, req.SpotifyURL}
+		if playlists[key] {
+			return database.IndexReport{}, fmt.Errorf("%w: active library sync %s of %d", database.ErrDuplicateKeys, req.SpotifyURL, req.CreatorID)
+		}
+		playlists[key] = true
+	}
+
+	m.indexed = true
+	return database.IndexReport{}, nil
+}
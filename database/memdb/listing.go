@@ -0,0 +1,83 @@
+package memdb
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+)
+
+func (m *DB) ListDownloadRequests(ctx context.Context, filter database.DownloadRequestFilter, page database.PageRequest) (database.DownloadRequestPage, error) {
+	page = page.Normalize()
+
+	var afterCreatedAt int64
+	var afterID string
+	if page.Cursor != "" {
+		var err error
+		afterCreatedAt, afterID, err = database.DecodeCursor(page.Cursor)
+		if err != nil {
+			return database.DownloadRequestPage{}, err
+		}
+	}
+
+	m.mu.Lock()
+	var matched []models.DownloadQueueRequest
+	for _, id := range m.requestOrder {
+		if req := m.requests[id]; matchesFilter(req, filter) {
+			matched = append(matched, cloneRequest(req))
+		}
+	}
+	m.mu.Unlock()
+
+	direction := -1
+	if page.Sort == database.SortOldestFirst {
+		direction = 1
+	}
+	compare := func(createdAt int64, id string, req models.DownloadQueueRequest) int {
+		return direction * cmp.Or(cmp.Compare(createdAt, req.CreatedAt), strings.Compare(id, req.ID))
+	}
+	slices.SortFunc(matched, func(a, b models.DownloadQueueRequest) int {
+		return compare(a.CreatedAt, a.ID, b)
+	})
+
+	result := database.DownloadRequestPage{TotalCount: int64(len(matched))}
+	requests := make([]models.DownloadQueueRequest, 0, page.Limit)
+	for _, req := range matched {
+		if page.Cursor != "" && compare(afterCreatedAt, afterID, req) >= 0 {
+			continue
+		}
+		if len(requests) == page.Limit {
+			result.NextCursor = database.EncodeCursor(requests[len(requests)-1])
+			break
+		}
+		requests = append(requests, req)
+	}
+	result.Requests = requests
+
+	return result, nil
+}
+
+func matchesFilter(req models.DownloadQueueRequest, filter database.DownloadRequestFilter) bool {
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, req.Status) {
+		return false
+	}
+	if filter.CreatorID != 0 && req.CreatorID != filter.CreatorID {
+		return false
+	}
+	if filter.ObjectType != "" && req.ObjectType != filter.ObjectType {
+		return false
+	}
+	if filter.CreatedFrom != 0 && req.CreatedAt < filter.CreatedFrom {
+		return false
+	}
+	if filter.CreatedTo != 0 && req.CreatedAt > filter.CreatedTo {
+		return false
+	}
+	if filter.NameContains != "" && !strings.Contains(strings.ToLower(req.Name), strings.ToLower(filter.NameContains)) {
+		return false
+	}
+	return true
+}
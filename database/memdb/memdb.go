@@ -0,0 +1,56 @@
+// Package memdb provides an in-memory implementation of database.Database.
+// It follows the semantics of the MongoDB implementation closely enough to be
+// used in place of it in tests.
+package memdb
+
+import (
+	"sync"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+)
+
+var _ database.Database = (*DB)(nil)
+
+// DB is an in-memory database.Database. It is safe for concurrent use.
+type DB struct {
+	mu sync.Mutex
+
+	// each collection keeps insertion order, like MongoDB's natural order
+	requests      map[string]models.DownloadQueueRequest
+	requestOrder  []string
+	playlists     map[string]models.PlaylistRequest
+	playlistOrder []string
+	// snapshots holds the last two snapshots of a playlist, the latest last
+	snapshots  map[string][]models.PlaylistSnapshot
+	files      map[string]models.MusicFile
+	fileOrder  []string
+	userTokens map[int64]models.UserToken
+
+	indexStatus *models.IndexStatus
+	retryPolicy database.RetryPolicy
+
+	// indexed enables the unique constraints MongoDB enforces once
+	// EnsureIndexes created its unique indexes
+	indexed bool
+}
+
+// New returns an empty in-memory database
+func New() *DB {
+	return &DB{
+		requests:   make(map[string]models.DownloadQueueRequest),
+		playlists:  make(map[string]models.PlaylistRequest),
+		snapshots:  make(map[string][]models.PlaylistSnapshot),
+		files:      make(map[string]models.MusicFile),
+		userTokens: make(map[int64]models.UserToken),
+	}
+}
+
+// SetRetryPolicy sets the policy used by RecordTrackAttempt, like
+// DataBaseConfig.TrackRetry does for MongoDB
+func (m *DB) SetRetryPolicy(policy database.RetryPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retryPolicy = policy
+}
@@ -0,0 +1,15 @@
+package memdb_test
+
+import (
+	"testing"
+
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/database/databasetest"
+	"github.com/supperdoggy/spot-models/database/memdb"
+)
+
+func TestConformance(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Database {
+		return memdb.New()
+	})
+}
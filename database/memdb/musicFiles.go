@@ -0,0 +1,61 @@
+package memdb
+
+import (
+	"context"
+	"slices"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/matching"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func (m *DB) FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := make([]models.MusicFile, 0)
+	for _, id := range m.fileOrder {
+		file := m.files[id]
+		if file.Deleted() {
+			continue
+		}
+		for i := range artists {
+			if file.Artist == artists[i] && file.Title == titles[i] {
+				// the mongo implementation does not load extra tags here
+				file.Extra = nil
+				files = append(files, file)
+				break
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// MatchTracks applies the same candidate prefilter as the mongo
+// implementation, see matching.TitleKey
+func (m *DB) MatchTracks(ctx context.Context, tracks []spotify.TrackMetadata) ([]matching.MatchResult, error) {
+	keys := make(map[string]bool, len(tracks))
+	for _, track := range tracks {
+		if key := matching.TitleKey(track.Title); key != "" {
+			keys[key] = true
+		}
+	}
+
+	m.mu.Lock()
+	files := make([]models.MusicFile, 0)
+	for _, id := range m.fileOrder {
+		file := m.files[id]
+		if file.Deleted() {
+			continue
+		}
+		if !slices.ContainsFunc(file.TitleWords, func(word string) bool { return keys[word] }) {
+			continue
+		}
+		file.Extra = nil
+		files = append(files, file)
+	}
+	m.mu.Unlock()
+
+	return matching.MatchTracks(tracks, files), nil
+}
@@ -0,0 +1,158 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func (m *DB) GetActivePlaylists(ctx context.Context) ([]models.PlaylistRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var requests []models.PlaylistRequest
+	for _, id := range m.playlistOrder {
+		if req := m.playlists[id]; req.Active {
+			requests = append(requests, req)
+		}
+	}
+
+	return requests, nil
+}
+
+func (m *DB) UpdatePlaylistRequest(ctx context.Context, request models.PlaylistRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.playlists[request.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	req.Active = request.Active
+	req.Errored = request.Errored
+	req.RetryCount = request.RetryCount
+	req.Status = models.StatusForFlags(req.Status, request.Active, request.Errored)
+	req.UpdatedAt = time.Now().Unix()
+	m.playlists[req.ID] = req
+
+	return nil
+}
+
+func (m *DB) NewPlaylistRequest(ctx context.Context, url string, creatorID int64) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.playlists[id.String()] = models.PlaylistRequest{
+		SpotifyURL: url,
+		ObjectType: spotify.SpotifyObjectTypePlaylist,
+		Active:     true,
+		Status:     models.RequestStatusQueued,
+		ID:         id.String(),
+		CreatedAt:  time.Now().Unix(),
+		CreatorID:  creatorID,
+	}
+	m.playlistOrder = append(m.playlistOrder, id.String())
+
+	return nil
+}
+
+func (m *DB) NewLibrarySyncRequest(ctx context.Context, creatorID int64, objectType spotify.SpotifyObjectType) error {
+	url := spotify.LibraryURL(objectType)
+	if url == "" {
+		return fmt.Errorf("%w: %s is not a library collection", spotify.ErrUnsupportedObjectType, objectType)
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, req := range m.playlists {
+		if req.Active && req.CreatorID == creatorID && req.SpotifyURL == url {
+			return database.ErrRequestExists
+		}
+	}
+
+	m.playlists[id.String()] = models.PlaylistRequest{
+		SpotifyURL: url,
+		ObjectType: objectType,
+		Active:     true,
+		Status:     models.RequestStatusQueued,
+		ID:         id.String(),
+		CreatedAt:  time.Now().Unix(),
+		CreatorID:  creatorID,
+	}
+	m.playlistOrder = append(m.playlistOrder, id.String())
+
+	return nil
+}
+
+func (m *DB) UpdatePlaylistSnapshot(ctx context.Context, id string, snapshot models.PlaylistSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.playlists[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	snapshot.Tracks = slices.Clone(snapshot.Tracks)
+	snapshots := append(m.snapshots[id], snapshot)
+	m.snapshots[id] = snapshots[max(0, len(snapshots)-2):]
+	req.UpdatedAt = time.Now().Unix()
+	m.playlists[id] = req
+
+	return nil
+}
+
+func (m *DB) GetPlaylistSnapshot(ctx context.Context, id string) (models.PlaylistSnapshot, error) {
+	current, _, err := m.latestSnapshots(id)
+	if err != nil {
+		return models.PlaylistSnapshot{}, err
+	}
+
+	snapshot := *current
+	snapshot.Tracks = slices.Clone(snapshot.Tracks)
+	return snapshot, nil
+}
+
+func (m *DB) DiffPlaylist(ctx context.Context, id string) (models.PlaylistDiff, error) {
+	current, previous, err := m.latestSnapshots(id)
+	if err != nil {
+		return models.PlaylistDiff{}, err
+	}
+
+	return database.DiffLatestSnapshots(current, previous)
+}
+
+func (m *DB) latestSnapshots(id string) (current, previous *models.PlaylistSnapshot, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.playlists[id]; !ok {
+		return nil, nil, database.ErrNotFound
+	}
+
+	snapshots := slices.Clone(m.snapshots[id])
+	switch len(snapshots) {
+	case 0:
+		return nil, nil, database.ErrNoSnapshot
+	case 1:
+		return &snapshots[0], nil, nil
+	}
+	return &snapshots[1], &snapshots[0], nil
+}
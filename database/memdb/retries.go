@@ -0,0 +1,97 @@
+package memdb
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func (m *DB) SetRequestTracks(ctx context.Context, id string, tracks []spotify.TrackMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.requests[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	req.TrackMetadata = slices.Clone(tracks)
+	if req.TrackMetadata == nil {
+		req.TrackMetadata = []spotify.TrackMetadata{}
+	}
+	req.ExpectedTrackCount = len(tracks)
+	req.FoundTrackCount = 0
+	for _, track := range tracks {
+		if track.Found {
+			req.FoundTrackCount++
+		}
+	}
+	req.UpdatedAt = time.Now().Unix()
+	m.requests[id] = req
+
+	return nil
+}
+
+func (m *DB) RecordTrackAttempt(ctx context.Context, requestID, trackURL string, attempt database.TrackAttempt) (spotify.TrackMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.requests[requestID]
+	if !ok {
+		return spotify.TrackMetadata{}, database.ErrNotFound
+	}
+	i := slices.IndexFunc(req.TrackMetadata, func(track spotify.TrackMetadata) bool {
+		return track.SpotifyURL == trackURL
+	})
+	if i < 0 {
+		return spotify.TrackMetadata{}, database.ErrNotFound
+	}
+
+	current := req.TrackMetadata[i]
+	updated := m.retryPolicy.Apply(current, attempt)
+
+	req = cloneRequest(req)
+	req.TrackMetadata[i] = updated
+	if updated.Found && !current.Found {
+		req.FoundTrackCount++
+	} else if current.Found && !updated.Found {
+		req.FoundTrackCount--
+	}
+	req.UpdatedAt = time.Now().Unix()
+	m.requests[requestID] = req
+
+	return updated, nil
+}
+
+func (m *DB) TracksDueForRetry(ctx context.Context, now time.Time, limit int) ([]database.TrackRetry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	retries := make([]database.TrackRetry, 0)
+	for _, id := range m.requestOrder {
+		req := m.requests[id]
+		if !req.Active {
+			continue
+		}
+		for _, track := range req.TrackMetadata {
+			if track.Found || track.Skipped || track.FailedAttempts == 0 || track.NextAttemptAt > now.Unix() {
+				continue
+			}
+			retries = append(retries, database.TrackRetry{RequestID: req.ID, RequestURL: req.SpotifyURL, Track: track})
+		}
+	}
+
+	// requestOrder is creation order, so a stable sort keeps the tie break of MongoDB
+	slices.SortStableFunc(retries, func(a, b database.TrackRetry) int {
+		return cmp.Compare(a.Track.NextAttemptAt, b.Track.NextAttemptAt)
+	})
+	if limit > 0 && len(retries) > limit {
+		retries = retries[:limit]
+	}
+
+	return retries, nil
+}
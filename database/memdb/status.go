@@ -0,0 +1,89 @@
+package memdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+)
+
+func (m *DB) TransitionRequest(ctx context.Context, id string, to models.RequestStatus, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.requests[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	if err := applyTransition(&req.Status, &req.Active, &req.Errored, to); err != nil {
+		return err
+	}
+	if to != models.RequestStatusDownloading {
+		req.LeaseOwner = ""
+		req.LeaseExpiresAt = 0
+	}
+	req.StatusReason = reason
+	req.UpdatedAt = time.Now().Unix()
+	m.requests[id] = req
+
+	return nil
+}
+
+func (m *DB) TransitionPlaylistRequest(ctx context.Context, id string, to models.RequestStatus, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.playlists[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	if err := applyTransition(&req.Status, &req.Active, &req.Errored, to); err != nil {
+		return err
+	}
+	req.StatusReason = reason
+	req.UpdatedAt = time.Now().Unix()
+	m.playlists[id] = req
+
+	return nil
+}
+
+func (m *DB) MigrateRequestStatuses(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total int64
+	for id, req := range m.requests {
+		if req.Status == "" {
+			req.Status = models.LegacyRequestStatus(req.Active, req.Errored)
+			m.requests[id] = req
+			total++
+		}
+	}
+	for id, req := range m.playlists {
+		if req.Status == "" {
+			req.Status = models.LegacyRequestStatus(req.Active, req.Errored)
+			m.playlists[id] = req
+			total++
+		}
+	}
+
+	return total, nil
+}
+
+func applyTransition(status *models.RequestStatus, active, errored *bool, to models.RequestStatus) error {
+	from := *status
+	if from == "" {
+		from = models.LegacyRequestStatus(*active, *errored)
+	}
+	if !models.CanTransition(from, to) {
+		return &models.TransitionError{From: from, To: to}
+	}
+
+	*status = to
+	*active = !to.IsTerminal()
+	*errored = to == models.RequestStatusFailed
+	return nil
+}
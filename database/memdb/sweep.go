@@ -0,0 +1,94 @@
+package memdb
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+)
+
+func (m *DB) StartIndexGeneration(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.indexStatus == nil {
+		m.indexStatus = &models.IndexStatus{}
+	}
+	m.indexStatus.Generation++
+
+	return m.indexStatus.Generation, nil
+}
+
+func (m *DB) TouchMusicFiles(ctx context.Context, generation int64, paths []string) (int64, error) {
+	if generation <= 0 {
+		return 0, database.ErrInvalidGeneration
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var touched int64
+	for _, id := range m.fileOrder {
+		file := m.files[id]
+		if !slices.Contains(paths, file.Path) {
+			continue
+		}
+		file.IndexGeneration = generation
+		file.DeletedAt = 0
+		m.files[id] = file
+		touched++
+	}
+
+	return touched, nil
+}
+
+func (m *DB) SweepUnseenMusicFiles(ctx context.Context, generation int64, opts database.SweepOptions) (models.SweepReport, error) {
+	if generation <= 0 {
+		return models.SweepReport{}, database.ErrInvalidGeneration
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := models.SweepReport{
+		Generation: generation,
+		SweptAt:    time.Now().Unix(),
+		DryRun:     opts.DryRun,
+		HardDelete: opts.HardDelete,
+		Paths:      make([]string, 0),
+	}
+
+	kept := make([]string, 0, len(m.fileOrder))
+	for _, id := range m.fileOrder {
+		file := m.files[id]
+		if file.IndexGeneration >= generation || (file.Deleted() && !opts.HardDelete) {
+			kept = append(kept, id)
+			continue
+		}
+
+		report.Paths = append(report.Paths, file.Path)
+		report.Count++
+		switch {
+		case opts.DryRun:
+			kept = append(kept, id)
+		case opts.HardDelete:
+			delete(m.files, id)
+		default:
+			file.DeletedAt = report.SweptAt
+			m.files[id] = file
+			kept = append(kept, id)
+		}
+	}
+	m.fileOrder = kept
+
+	if m.indexStatus == nil {
+		m.indexStatus = &models.IndexStatus{}
+	}
+	stored := report
+	stored.Paths = nil
+	m.indexStatus.LastSweep = &stored
+
+	return report, nil
+}
@@ -0,0 +1,50 @@
+package memdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+)
+
+func (m *DB) SaveUserToken(ctx context.Context, token models.UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	token.CreatedAt = now
+	if existing, ok := m.userTokens[token.CreatorID]; ok {
+		token.CreatedAt = existing.CreatedAt
+		if token.Scope == "" {
+			token.Scope = existing.Scope
+		}
+	}
+	token.UpdatedAt = now
+	m.userTokens[token.CreatorID] = token
+
+	return nil
+}
+
+func (m *DB) GetUserToken(ctx context.Context, creatorID int64) (models.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokens[creatorID]
+	if !ok {
+		return models.UserToken{}, database.ErrNotFound
+	}
+	return token, nil
+}
+
+func (m *DB) DeleteUserToken(ctx context.Context, creatorID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.userTokens[creatorID]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.userTokens, creatorID)
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const bulkBatchSize = 500
+
+func init() {
+	Register(Migration{
+		Version: 1,
+		Name:    "backfill download request tracking fields",
+		Up:      backfillDownloadRequestFields,
+	})
+}
+
+// backfillDownloadRequestFields sets ObjectType, ExpectedTrackCount,
+// FoundTrackCount and TrackMetadata on requests created before they existed
+func backfillDownloadRequestFields(ctx context.Context, env Env) (int64, error) {
+	coll := env.DB.Collection(env.Config.DownloadRequestCollectionName)
+
+	var affected int64
+	defaults := []struct {
+		field string
+		value interface{}
+	}{
+		{"expected_track_count", 0},
+		{"found_track_count", 0},
+		{"track_metadata", bson.A{}},
+	}
+	for _, d := range defaults {
+		// matches both missing and null fields
+		filter := bson.M{d.field: nil}
+		if env.DryRun {
+			count, err := coll.CountDocuments(ctx, filter)
+			if err != nil {
+				return affected, err
+			}
+			affected += count
+			continue
+		}
+
+		info, err := coll.UpdateMany(ctx, filter, bson.M{"$set": bson.M{d.field: d.value}})
+		if err != nil {
+			return affected, err
+		}
+		affected += info.ModifiedCount
+	}
+
+	count, err := backfillObjectTypes(ctx, env, coll)
+	return affected + count, err
+}
+
+func backfillObjectTypes(ctx context.Context, env Env, coll *mongo.Collection) (int64, error) {
+	cursor, err := coll.Find(ctx,
+		bson.M{"object_type": bson.M{"$in": bson.A{nil, ""}}},
+		options.Find().SetProjection(bson.M{"spotify_url": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var affected int64
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := coll.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		affected += result.ModifiedCount
+		batch = batch[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID         string `bson:"_id"`
+			SpotifyURL string `bson:"spotify_url"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return affected, err
+		}
+
+		ref, err := spotify.ParseURL(doc.SpotifyURL)
+		if err != nil {
+			env.Log.Warn("cannot derive object type", zap.String("id", doc.ID), zap.String("url", doc.SpotifyURL), zap.Error(err))
+			continue
+		}
+
+		if env.DryRun {
+			affected++
+			continue
+		}
+
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"object_type": ref.Type}}))
+		if len(batch) == bulkBatchSize {
+			if err := flush(); err != nil {
+				return affected, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return affected, err
+	}
+
+	return affected, flush()
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/supperdoggy/spot-models/database"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func init() {
+	Register(Migration{
+		Version: 2,
+		Name:    "derive request status from active and errored flags",
+		Up:      backfillRequestStatuses,
+	})
+}
+
+// backfillRequestStatuses sets Status on download and playlist requests
+// created before it existed, see database.BackfillRequestStatuses
+func backfillRequestStatuses(ctx context.Context, env Env) (int64, error) {
+	return database.BackfillRequestStatuses(ctx, []*mongo.Collection{
+		env.DB.Collection(env.Config.DownloadRequestCollectionName),
+		env.DB.Collection(env.Config.PlaylistRequestCollectionName),
+	}, env.DryRun)
+}
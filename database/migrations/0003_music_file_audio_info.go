@@ -0,0 +1,221 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/supperdoggy/spot-models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	Register(Migration{
+		Version: 3,
+		Name:    "convert music file meta data to audio info",
+		Up:      convertMusicFileMetaData,
+	})
+}
+
+// convertMusicFileMetaData replaces the untyped meta_data of music files with
+// audio, size, mod_time and extra, see convertMetaData
+func convertMusicFileMetaData(ctx context.Context, env Env) (int64, error) {
+	coll := env.DB.Collection(env.Config.MusicFilesCollectionName)
+
+	cursor, err := coll.Find(ctx,
+		bson.M{"meta_data": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"meta_data": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var affected int64
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := coll.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		affected += result.ModifiedCount
+		batch = batch[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID       string `bson:"_id"`
+			MetaData bson.M `bson:"meta_data"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return affected, err
+		}
+
+		if env.DryRun {
+			affected++
+			continue
+		}
+
+		converted := convertMetaData(doc.MetaData)
+		set := bson.M{"audio": converted.Audio}
+		if converted.Size != 0 {
+			set["size"] = converted.Size
+		}
+		if converted.ModTime != 0 {
+			set["mod_time"] = converted.ModTime
+		}
+		if len(converted.Extra) > 0 {
+			set["extra"] = converted.Extra
+		}
+
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$set": set, "$unset": bson.M{"meta_data": ""}}))
+		if len(batch) == bulkBatchSize {
+			if err := flush(); err != nil {
+				return affected, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return affected, err
+	}
+
+	return affected, flush()
+}
+
+// convertMetaData maps the keys the old indexers wrote into meta_data onto
+// the typed fields of a music file. Duration was stored in seconds. Unknown
+// keys are kept as strings in Extra.
+func convertMetaData(meta map[string]any) models.MusicFile {
+	var file models.MusicFile
+	for key, value := range meta {
+		if value == nil {
+			continue
+		}
+
+		n, isNumber := metaNumber(value)
+		switch strings.ToLower(key) {
+		case "duration":
+			if isNumber {
+				file.Audio.DurationMs = int64(math.Round(n * 1000))
+				continue
+			}
+		case "duration_ms":
+			if isNumber {
+				file.Audio.DurationMs = int64(n)
+				continue
+			}
+		case "bitrate":
+			if isNumber {
+				file.Audio.Bitrate = int(n)
+				continue
+			}
+		case "sample_rate", "samplerate":
+			if isNumber {
+				file.Audio.SampleRate = int(n)
+				continue
+			}
+		case "channels":
+			if isNumber {
+				file.Audio.Channels = int(n)
+				continue
+			}
+		case "bit_depth", "bits_per_sample":
+			if isNumber {
+				file.Audio.BitDepth = int(n)
+				continue
+			}
+		case "track_number", "track":
+			if isNumber {
+				file.Audio.TrackNumber = int(n)
+				continue
+			}
+		case "disc_number", "disc":
+			if isNumber {
+				file.Audio.DiscNumber = int(n)
+				continue
+			}
+		case "year":
+			if isNumber {
+				file.Audio.Year = int(n)
+				continue
+			}
+		case "size":
+			if isNumber {
+				file.Size = int64(n)
+				continue
+			}
+		case "mod_time":
+			if isNumber {
+				file.ModTime = int64(n)
+				continue
+			}
+		case "codec", "format":
+			if s, ok := value.(string); ok {
+				file.Audio.Codec = strings.ToLower(s)
+				continue
+			}
+		case "isrc":
+			if s, ok := value.(string); ok {
+				file.Audio.ISRC = s
+				continue
+			}
+		case "musicbrainz_track_id", "musicbrainz_trackid":
+			if s, ok := value.(string); ok {
+				file.Audio.MusicBrainzTrackID = s
+				continue
+			}
+		case "musicbrainz_album_id", "musicbrainz_albumid":
+			if s, ok := value.(string); ok {
+				file.Audio.MusicBrainzAlbumID = s
+				continue
+			}
+		case "musicbrainz_artist_id", "musicbrainz_artistid":
+			if s, ok := value.(string); ok {
+				file.Audio.MusicBrainzArtistID = s
+				continue
+			}
+		}
+
+		if file.Extra == nil {
+			file.Extra = make(map[string]string)
+		}
+		file.Extra[key] = metaString(value)
+	}
+	return file
+}
+
+// metaNumber reads the number types BSON and JSON decode to, and numeric strings
+func metaNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func metaString(value any) string {
+	if n, ok := metaNumber(value); ok {
+		if _, isString := value.(string); !isString {
+			return strconv.FormatFloat(n, 'f', -1, 64)
+		}
+	}
+	return fmt.Sprint(value)
+}
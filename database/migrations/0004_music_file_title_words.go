@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/supperdoggy/spot-models/matching"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	Register(Migration{
+		Version: 4,
+		Name:    "backfill music file title words",
+		Up:      backfillTitleWords,
+	})
+}
+
+// backfillTitleWords sets title_words on music files indexed before it
+// existed, so MatchTracks finds them
+func backfillTitleWords(ctx context.Context, env Env) (int64, error) {
+	coll := env.DB.Collection(env.Config.MusicFilesCollectionName)
+
+	cursor, err := coll.Find(ctx,
+		bson.M{"title_words": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"title": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var affected int64
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := coll.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		affected += result.ModifiedCount
+		batch = batch[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID    string `bson:"_id"`
+			Title string `bson:"title"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return affected, err
+		}
+
+		words := matching.TitleWords(doc.Title)
+		if len(words) == 0 {
+			// omitted on indexing as well, the file can never be a candidate
+			continue
+		}
+		if env.DryRun {
+			affected++
+			continue
+		}
+
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"title_words": words}}))
+		if len(batch) == bulkBatchSize {
+			if err := flush(); err != nil {
+				return affected, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return affected, err
+	}
+
+	return affected, flush()
+}
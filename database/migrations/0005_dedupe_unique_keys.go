@@ -0,0 +1,111 @@
+package migrations
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register(Migration{
+		Version: 5,
+		Name:    "remove duplicates blocking unique indexes",
+		Up:      dedupeUniqueKeys,
+	})
+}
+
+// dedupeUniqueKeys removes the duplicates that keep EnsureIndexes from
+// creating the path_unique and active_spotify_url_unique indexes. Of music
+// files sharing a path the most recently updated one is kept, of active
+// requests sharing a url the oldest one stays active and the others are
+// cancelled.
+func dedupeUniqueKeys(ctx context.Context, env Env) (int64, error) {
+	files, err := dedupeMusicFilePaths(ctx, env)
+	if err != nil {
+		return files, err
+	}
+	requests, err := dedupeActiveRequests(ctx, env)
+	return files + requests, err
+}
+
+func dedupeMusicFilePaths(ctx context.Context, env Env) (int64, error) {
+	coll := env.DB.Collection(env.Config.MusicFilesCollectionName)
+	duplicates, err := duplicateIDs(ctx, coll, bson.M{}, "$path", bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: 1}})
+	if err != nil || env.DryRun {
+		return int64(len(duplicates)), err
+	}
+
+	var affected int64
+	for batch := range slices.Chunk(duplicates, bulkBatchSize) {
+		result, err := coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batch}})
+		if err != nil {
+			return affected, err
+		}
+		affected += result.DeletedCount
+	}
+	if affected > 0 {
+		env.Log.Info("removed music files with duplicate paths", zap.Int64("count", affected))
+	}
+	return affected, nil
+}
+
+func dedupeActiveRequests(ctx context.Context, env Env) (int64, error) {
+	coll := env.DB.Collection(env.Config.DownloadRequestCollectionName)
+	duplicates, err := duplicateIDs(ctx, coll, bson.M{"active": true}, "$spotify_url", bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	if err != nil || env.DryRun {
+		return int64(len(duplicates)), err
+	}
+
+	var affected int64
+	for batch := range slices.Chunk(duplicates, bulkBatchSize) {
+		result, err := coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": batch}, "active": true}, bson.M{"$set": bson.M{
+			"active":        false,
+			"errored":       false,
+			"status":        models.RequestStatusCancelled,
+			"status_reason": "duplicate active request",
+			"updated_at":    time.Now().Unix(),
+		}, "$unset": bson.M{"lease_owner": "", "lease_expires_at": ""}})
+		if err != nil {
+			return affected, err
+		}
+		affected += result.ModifiedCount
+	}
+	if affected > 0 {
+		env.Log.Info("cancelled duplicate active requests", zap.Int64("count", affected))
+	}
+	return affected, nil
+}
+
+// duplicateIDs groups the documents matching filter by key and returns the
+// ids of all but the first document of every group, in the order of sort
+func duplicateIDs(ctx context.Context, coll *mongo.Collection, filter bson.M, key interface{}, sort bson.D) ([]string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: sort}},
+		{{Key: "$group", Value: bson.M{"_id": key, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cursor, err := coll.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var duplicates []string
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs []string `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, group.IDs[1:]...)
+	}
+	return duplicates, cursor.Err()
+}
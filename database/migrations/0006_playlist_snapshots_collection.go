@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	Register(Migration{
+		Version: 6,
+		Name:    "move playlist snapshots to their own collection",
+		Up:      movePlaylistSnapshots,
+	})
+}
+
+// movePlaylistSnapshots moves the snapshot and previous_snapshot embedded in
+// playlist requests to the playlist snapshots collection, as versions 1 and
+// 2 of the request, see database.UpdatePlaylistSnapshot
+func movePlaylistSnapshots(ctx context.Context, env Env) (int64, error) {
+	playlists := env.DB.Collection(env.Config.PlaylistRequestCollectionName)
+	name := env.Config.PlaylistSnapshotsCollectionName
+	if name == "" {
+		name = database.DefaultPlaylistSnapshotsCollectionName
+	}
+	snapshots := env.DB.Collection(name)
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"snapshot": bson.M{"$exists": true}},
+		bson.M{"previous_snapshot": bson.M{"$exists": true}},
+	}}
+	if env.DryRun {
+		return playlists.CountDocuments(ctx, filter)
+	}
+
+	// requests are loaded one at a time, the snapshots can be large
+	cursor, err := playlists.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var affected int64
+	for cursor.Next(ctx) {
+		id, ok := cursor.Current.Lookup("_id").StringValueOK()
+		if !ok {
+			continue
+		}
+
+		var doc struct {
+			Snapshot         *models.PlaylistSnapshot `bson:"snapshot"`
+			PreviousSnapshot *models.PlaylistSnapshot `bson:"previous_snapshot"`
+		}
+		if err := playlists.FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+			return affected, err
+		}
+
+		var version int64
+		for _, snapshot := range []*models.PlaylistSnapshot{doc.PreviousSnapshot, doc.Snapshot} {
+			if snapshot == nil {
+				continue
+			}
+			version++
+			// replacing keeps a rerun after a failure from duplicating snapshots
+			_, err := snapshots.ReplaceOne(ctx, bson.M{"_id": fmt.Sprintf("%s/%d", id, version)}, bson.M{
+				"request_id":  id,
+				"version":     version,
+				"snapshot_id": snapshot.SnapshotID,
+				"tracks":      snapshot.Tracks,
+				"taken_at":    snapshot.TakenAt,
+			}, options.Replace().SetUpsert(true))
+			if err != nil {
+				return affected, err
+			}
+		}
+
+		_, err := playlists.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+			"$set":   bson.M{"snapshot_version": version},
+			"$unset": bson.M{"snapshot": "", "previous_snapshot": ""},
+		})
+		if err != nil {
+			return affected, err
+		}
+		affected++
+	}
+	if err := cursor.Err(); err != nil {
+		return affected, err
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register(Migration{
+		Version: 7,
+		Name:    "cancel duplicate active library syncs",
+		Up:      dedupeActivePlaylists,
+	})
+}
+
+// dedupeActivePlaylists keeps the oldest active library sync of a user per
+// collection and cancels the others, so EnsureIndexes can create the
+// active_library_sync_unique index. Plain playlist requests are left alone.
+func dedupeActivePlaylists(ctx context.Context, env Env) (int64, error) {
+	coll := env.DB.Collection(env.Config.PlaylistRequestCollectionName)
+	filter := bson.M{
+		"active":      true,
+		"object_type": bson.M{"$in": bson.A{spotify.SpotifyObjectTypeSavedTracks, spotify.SpotifyObjectTypeSavedAlbums}},
+	}
+	key := bson.M{"creator_id": "$creator_id", "spotify_url": "$spotify_url"}
+	duplicates, err := duplicateIDs(ctx, coll, filter, key, bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	if err != nil || env.DryRun {
+		return int64(len(duplicates)), err
+	}
+
+	var affected int64
+	for batch := range slices.Chunk(duplicates, bulkBatchSize) {
+		result, err := coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": batch}, "active": true}, bson.M{"$set": bson.M{
+			"active":        false,
+			"errored":       false,
+			"status":        models.RequestStatusCancelled,
+			"status_reason": "duplicate active request",
+			"updated_at":    time.Now().Unix(),
+		}})
+		if err != nil {
+			return affected, err
+		}
+		affected += result.ModifiedCount
+	}
+	if affected > 0 {
+		env.Log.Info("cancelled duplicate active library syncs", zap.Int64("count", affected))
+	}
+	return affected, nil
+}
@@ -0,0 +1,68 @@
+// Package migrations applies ordered, versioned changes to stored documents.
+// Migrations register themselves from init functions; a Migrator records the
+// applied versions in the migrations collection and holds a lock there so
+// only one service instance migrates at a time.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/supperdoggy/spot-models/database"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// Env is passed to every migration
+type Env struct {
+	DB     *mongo.Database
+	Config *database.DataBaseConfig
+	Log    *zap.Logger
+	// DryRun asks the migration to count the documents it would change
+	// without changing them
+	DryRun bool
+}
+
+// Migration is a single versioned change. Up returns the number of documents
+// it changed, or would change in a dry run.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, env Env) (int64, error)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Migration
+)
+
+// Register adds a migration. It panics on a duplicate or non-positive version,
+// and is meant to be called from init functions.
+func Register(m Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if m.Version <= 0 {
+		panic(fmt.Sprintf("migrations: invalid version %d for %q", m.Version, m.Name))
+	}
+	for _, existing := range registry {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("migrations: version %d registered twice (%q and %q)", m.Version, existing.Name, m.Name))
+		}
+	}
+	registry = append(registry, m)
+}
+
+// Registered returns all registered migrations ordered by version
+func Registered() []Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	migrations := slices.Clone(registry)
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+	return migrations
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/supperdoggy/spot-models"
+)
+
+func TestRegistered(t *testing.T) {
+	migrations := Registered()
+	if len(migrations) == 0 {
+		t.Fatal("no migrations registered")
+	}
+
+	for i, m := range migrations {
+		if m.Name == "" || m.Up == nil {
+			t.Errorf("migration %d is incomplete: %+v", m.Version, m)
+		}
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			t.Errorf("migrations out of order: %d after %d", m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestRegister_DuplicateVersion(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate version did not panic")
+		}
+	}()
+
+	existing := Registered()[0]
+	Register(Migration{Version: existing.Version, Name: "duplicate"})
+}
+
+func TestConvertMetaData(t *testing.T) {
+	got := convertMetaData(map[string]any{
+		"duration":    int32(180),
+		"bitrate":     float64(320),
+		"sample_rate": int64(44100),
+		"year":        "1999",
+		"format":      "FLAC",
+		"size":        int64(31457280),
+		"isrc":        "GBDUW0000053",
+		"mood":        "happy",
+		"bpm":         float64(123),
+		"empty":       nil,
+	})
+
+	want := models.AudioInfo{
+		DurationMs: 180000,
+		Bitrate:    320,
+		SampleRate: 44100,
+		Codec:      "flac",
+		Year:       1999,
+		ISRC:       "GBDUW0000053",
+	}
+	if got.Audio != want {
+		t.Errorf("Audio = %+v, want %+v", got.Audio, want)
+	}
+	if got.Size != 31457280 {
+		t.Errorf("Size = %d, want 31457280", got.Size)
+	}
+	if len(got.Extra) != 2 || got.Extra["mood"] != "happy" || got.Extra["bpm"] != "123" {
+		t.Errorf("Extra = %v, want mood and bpm", got.Extra)
+	}
+}
@@ -0,0 +1,270 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/supperdoggy/spot-models/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultCollectionName = "schema_migrations"
+	DefaultLockTTL        = 10 * time.Minute
+
+	lockID = "lock"
+)
+
+var ErrLocked = errors.New("migrations are locked by another instance")
+
+// Options configures Migrate
+type Options struct {
+	// DryRun reports what pending migrations would change without applying them
+	DryRun bool
+}
+
+// Status is the state of a registered migration
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int64
+}
+
+// Result describes a migration run by Migrate
+type Result struct {
+	Version int
+	Name    string
+	// Affected is the number of document updates made, or that would be made in a dry run
+	Affected int64
+	DryRun   bool
+}
+
+// appliedMigration is the document recorded for an applied migration
+type appliedMigration struct {
+	Version   int    `bson:"_id"`
+	Name      string `bson:"name"`
+	AppliedAt int64  `bson:"applied_at"`
+	Affected  int64  `bson:"affected"`
+}
+
+// Migrator applies registered migrations to one database
+type Migrator struct {
+	conn *mongo.Client
+	log  *zap.Logger
+	cfg  *database.DataBaseConfig
+
+	owner      string
+	lockTTL    time.Duration
+	migrations []Migration
+}
+
+// NewMigrator connects to the database described by cfg. Close releases the connection.
+func NewMigrator(ctx context.Context, log *zap.Logger, cfg *database.DataBaseConfig) (*Migrator, error) {
+	conn, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.DatabaseURL))
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	return &Migrator{
+		conn: conn,
+		log:  log,
+		cfg:  cfg,
+
+		owner:      fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.Must(uuid.NewV4())),
+		lockTTL:    DefaultLockTTL,
+		migrations: Registered(),
+	}, nil
+}
+
+// Close disconnects from the database
+func (m *Migrator) Close(ctx context.Context) error {
+	return m.conn.Disconnect(ctx)
+}
+
+func (m *Migrator) database() *mongo.Database {
+	return m.conn.Database(m.cfg.DatabaseName)
+}
+
+func (m *Migrator) collection() *mongo.Collection {
+	name := m.cfg.MigrationsCollectionName
+	if name == "" {
+		name = DefaultCollectionName
+	}
+	return m.database().Collection(name)
+}
+
+// Status returns every registered migration and whether it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+	return statuses, nil
+}
+
+// Migrate applies pending migrations in version order, stopping at the first
+// failure. It returns ErrLocked if another instance is migrating.
+func (m *Migrator) Migrate(ctx context.Context, opts Options) ([]Result, error) {
+	if !opts.DryRun {
+		if err := m.lock(ctx); err != nil {
+			return nil, err
+		}
+		defer m.unlock()
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	env := Env{DB: m.database(), Config: m.cfg, Log: m.log, DryRun: opts.DryRun}
+	var results []Result
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		log := m.log.With(zap.Int("version", migration.Version), zap.String("name", migration.Name), zap.Bool("dry_run", opts.DryRun))
+		log.Info("running migration")
+
+		var affected int64
+		if opts.DryRun {
+			affected, err = migration.Up(ctx, env)
+		} else {
+			affected, err = m.runLocked(ctx, migration, env)
+		}
+		if err != nil {
+			return results, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		results = append(results, Result{Version: migration.Version, Name: migration.Name, Affected: affected, DryRun: opts.DryRun})
+		log.Info("migration done", zap.Int64("affected", affected))
+
+		if opts.DryRun {
+			continue
+		}
+
+		_, err = m.collection().InsertOne(ctx, appliedMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now().Unix(),
+			Affected:  affected,
+		})
+		if err != nil {
+			return results, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+
+		if err := m.extendLock(ctx); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	cursor, err := m.collection().Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := make(map[int]appliedMigration)
+	for cursor.Next(ctx) {
+		var record appliedMigration
+		if err := cursor.Decode(&record); err != nil {
+			return nil, err
+		}
+		applied[record.Version] = record
+	}
+	return applied, cursor.Err()
+}
+
+// lock takes the migration lock unless another owner holds an unexpired one
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.M{"_id": lockID, "$or": bson.A{
+		bson.M{"owner": m.owner},
+		bson.M{"expires_at": bson.M{"$lte": now.Unix()}},
+	}}
+	update := bson.M{"$set": bson.M{"owner": m.owner, "expires_at": now.Add(m.lockTTL).Unix()}}
+
+	_, err := m.collection().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+// runLocked runs a migration while renewing the lock every third of its TTL,
+// so a migration running longer than the TTL keeps it. The migration is
+// cancelled when the lock is lost.
+func (m *Migrator) runLocked(ctx context.Context, migration Migration, env Env) (int64, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(m.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := m.extendLock(ctx); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}
+	}()
+
+	affected, err := migration.Up(ctx, env)
+	close(done)
+	<-renewed
+
+	if err != nil && ctx.Err() != nil {
+		return affected, context.Cause(ctx)
+	}
+	return affected, err
+}
+
+// extendLock renews the lock so long runs keep it
+func (m *Migrator) extendLock(ctx context.Context) error {
+	if err := m.lock(ctx); err != nil {
+		return fmt.Errorf("lost migration lock: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) unlock() {
+	// release the lock even if the migration context was cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := m.collection().DeleteOne(ctx, bson.M{"_id": lockID, "owner": m.owner}); err != nil {
+		m.log.Error("failed to release migration lock", zap.Error(err))
+	}
+}
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/spot-models/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// TestMigrator runs against a real MongoDB when SPOT_MODELS_TEST_MONGO_URL is set
+func TestMigrator(t *testing.T) {
+	url := os.Getenv("SPOT_MODELS_TEST_MONGO_URL")
+	if url == "" {
+		t.Skip("SPOT_MODELS_TEST_MONGO_URL is not set")
+	}
+
+	ctx := context.Background()
+	cfg := &database.DataBaseConfig{
+		DatabaseURL:                   url,
+		DatabaseName:                  fmt.Sprintf("spot_models_migrations_%d", time.Now().UnixNano()),
+		DownloadRequestCollectionName: "download_requests",
+		PlaylistRequestCollectionName: "playlist_requests",
+		MusicFilesCollectionName:      "music_files",
+	}
+
+	m, err := NewMigrator(ctx, zap.NewNop(), cfg)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	defer m.Close(ctx)
+	defer m.database().Drop(ctx)
+
+	requests := m.database().Collection(cfg.DownloadRequestCollectionName)
+	if _, err := requests.InsertOne(ctx, bson.M{
+		"_id":         "legacy",
+		"spotify_url": "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy",
+		"active":      false,
+	}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	results, err := m.Migrate(ctx, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(results) != len(m.migrations) {
+		t.Fatalf("dry run returned %d results, want %d", len(results), len(m.migrations))
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Errorf("migration %d applied by a dry run", status.Version)
+		}
+	}
+
+	// another instance holding the lock blocks migrations
+	other := &Migrator{conn: m.conn, log: m.log, cfg: cfg, owner: "other", lockTTL: time.Minute, migrations: m.migrations}
+	if err := other.lock(ctx); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if _, err := m.Migrate(ctx, Options{}); !errors.Is(err, ErrLocked) {
+		t.Errorf("Migrate error = %v, want %v", err, ErrLocked)
+	}
+	other.unlock()
+
+	if _, err := m.Migrate(ctx, Options{}); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	var doc struct {
+		ObjectType string `bson:"object_type"`
+		Status     string `bson:"status"`
+	}
+	if err := requests.FindOne(ctx, bson.M{"_id": "legacy"}).Decode(&doc); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	if doc.ObjectType != "album" || doc.Status != "completed" {
+		t.Errorf("legacy request not migrated: %+v", doc)
+	}
+
+	results, err = m.Migrate(ctx, Options{})
+	if err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("second Migrate ran %d migrations, want 0", len(results))
+	}
+}
+
+// TestMigratorRenewsLock runs against a real MongoDB when SPOT_MODELS_TEST_MONGO_URL is set
+func TestMigratorRenewsLock(t *testing.T) {
+	url := os.Getenv("SPOT_MODELS_TEST_MONGO_URL")
+	if url == "" {
+		t.Skip("SPOT_MODELS_TEST_MONGO_URL is not set")
+	}
+
+	ctx := context.Background()
+	cfg := &database.DataBaseConfig{
+		DatabaseURL:  url,
+		DatabaseName: fmt.Sprintf("spot_models_migrations_%d", time.Now().UnixNano()),
+	}
+
+	m, err := NewMigrator(ctx, zap.NewNop(), cfg)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	defer m.Close(ctx)
+	defer m.database().Drop(ctx)
+
+	// the migration outlives the lock TTL, but the lock is renewed meanwhile
+	m.lockTTL = 3 * time.Second
+	other := &Migrator{conn: m.conn, log: m.log, cfg: cfg, owner: "other", lockTTL: time.Minute}
+	m.migrations = []Migration{{
+		Version: 1,
+		Name:    "slow",
+		Up: func(ctx context.Context, env Env) (int64, error) {
+			time.Sleep(5 * time.Second)
+			if err := other.lock(ctx); !errors.Is(err, ErrLocked) {
+				return 0, fmt.Errorf("lock by another instance error = %v, want %v", err, ErrLocked)
+			}
+			return 0, nil
+		},
+	}}
+
+	if _, err := m.Migrate(ctx, Options{}); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+}
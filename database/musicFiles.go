@@ -4,12 +4,21 @@ import (
 	"context"
 
 	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/matching"
+	"github.com/supperdoggy/spot-models/spotify"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// matchCandidateBatchSize bounds the number of tracks per candidate query
+const matchCandidateBatchSize = 100
+
 func (d *db) FindMusicFiles(ctx context.Context, artists, titles []string) ([]models.MusicFile, error) {
+	if len(artists) == 0 {
+		return []models.MusicFile{}, nil
+	}
+
 	orPairs := make([]bson.M, 0, len(artists))
 	for i := range artists {
 		orPairs = append(orPairs, bson.M{
@@ -20,9 +29,46 @@ func (d *db) FindMusicFiles(ctx context.Context, artists, titles []string) ([]mo
 
 	d.log.Info("Finding music files", zap.Any("orPairs", orPairs))
 
-	cur, err := d.musicFilesCollection().Find(ctx, bson.M{
-		"$or": orPairs,
-	}, options.Find().SetProjection(bson.M{"meta_data": 0}))
+	return d.findMusicFiles(ctx, bson.M{"$or": orPairs})
+}
+
+// MatchTracks matches tracks against the library. Candidates are the files
+// whose title words contain the key of a track's title, see matching.TitleKey.
+func (d *db) MatchTracks(ctx context.Context, tracks []spotify.TrackMetadata) ([]matching.MatchResult, error) {
+	candidates := make([]models.MusicFile, 0)
+	seen := make(map[string]bool)
+	for start := 0; start < len(tracks); start += matchCandidateBatchSize {
+		end := min(start+matchCandidateBatchSize, len(tracks))
+
+		keys := make([]string, 0, end-start)
+		for _, track := range tracks[start:end] {
+			if key := matching.TitleKey(track.Title); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		files, err := d.findMusicFiles(ctx, bson.M{"title_words": bson.M{"$in": keys}})
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !seen[file.ID] {
+				seen[file.ID] = true
+				candidates = append(candidates, file)
+			}
+		}
+	}
+
+	return matching.MatchTracks(tracks, candidates), nil
+}
+
+// findMusicFiles finds the files matching filter that were not deleted by a sweep
+func (d *db) findMusicFiles(ctx context.Context, filter bson.M) ([]models.MusicFile, error) {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	cur, err := d.musicFilesCollection().Find(ctx, filter, options.Find().SetProjection(bson.M{"extra": 0}))
 	if err != nil {
 		return nil, err
 	}
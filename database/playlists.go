@@ -3,13 +3,31 @@ package database
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
 	"github.com/gofrs/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// DefaultPlaylistSnapshotsCollectionName is used when PlaylistSnapshotsCollectionName is empty
+const DefaultPlaylistSnapshotsCollectionName = "playlist_snapshots"
+
+// storedSnapshot is a snapshot in the playlist snapshots collection.
+// Version counts the syncs of the request; the counter is kept in the
+// snapshot_version field of the request, see UpdatePlaylistSnapshot.
+type storedSnapshot struct {
+	ID        string `bson:"_id"`
+	RequestID string `bson:"request_id"`
+	Version   int64  `bson:"version"`
+
+	models.PlaylistSnapshot `bson:",inline"`
+}
+
 func (d *db) GetActivePlaylists(ctx context.Context) ([]models.PlaylistRequest, error) {
 	var requests []models.PlaylistRequest
 	cursor, err := d.playlistsCollection().Find(ctx, bson.M{"active": true})
@@ -28,25 +46,22 @@ func (d *db) GetActivePlaylists(ctx context.Context) ([]models.PlaylistRequest,
 	return requests, nil
 }
 
+// UpdatePlaylistRequest stores the flags of a playlist request. Its stored
+// status follows the Active/Errored flags, see models.StatusForFlags; the
+// Status of request is ignored.
 func (d *db) UpdatePlaylistRequest(ctx context.Context, request models.PlaylistRequest) error {
-	info, err := d.playlistsCollection().UpdateOne(ctx, bson.M{"_id": request.ID}, bson.M{"$set": bson.M{
-		"active":      request.Active,
-		"errored":     request.Errored,
+	return d.updateRequestFlags(ctx, d.playlistsCollection(), request.ID, request.Active, request.Errored, bson.M{
 		"retry_count": request.RetryCount,
-	}})
-
-	if info.MatchedCount == 0 {
-		return errors.New("not found")
-	}
-
-	return err
+	})
 }
 
 func (d *db) NewPlaylistRequest(ctx context.Context, url string, creatorID int64) error {
 	id, _ := uuid.NewV4()
 	request := models.PlaylistRequest{
 		SpotifyURL: url,
+		ObjectType: spotify.SpotifyObjectTypePlaylist,
 		Active:     true,
+		Status:     models.RequestStatusQueued,
 		ID:         id.String(),
 		CreatedAt:  time.Now().Unix(),
 		CreatorID:  creatorID,
@@ -59,3 +74,145 @@ func (d *db) NewPlaylistRequest(ctx context.Context, url string, creatorID int64
 
 	return nil
 }
+
+// NewLibrarySyncRequest adds a request syncing the Liked Songs or saved albums
+// of a user. The playlist sync loop picks it up like any playlist. It returns
+// ErrRequestExists if the user already has an active one for objectType.
+func (d *db) NewLibrarySyncRequest(ctx context.Context, creatorID int64, objectType spotify.SpotifyObjectType) error {
+	url := spotify.LibraryURL(objectType)
+	if url == "" {
+		return fmt.Errorf("%w: %s is not a library collection", spotify.ErrUnsupportedObjectType, objectType)
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"creator_id": creatorID, "spotify_url": url, "active": true}
+	info, err := d.playlistsCollection().UpdateOne(ctx, filter, bson.M{"$setOnInsert": bson.M{
+		"_id":         id.String(),
+		"object_type": objectType,
+		"errored":     false,
+		"retry_count": 0,
+		"status":      models.RequestStatusQueued,
+		"no_pull":     false,
+		"created_at":  time.Now().Unix(),
+		"updated_at":  0,
+	}}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent call inserted the request first
+		return ErrRequestExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.UpsertedCount == 0 {
+		return ErrRequestExists
+	}
+
+	return nil
+}
+
+// UpdatePlaylistSnapshot stores the playlist content of a sync in the playlist
+// snapshots collection, apart from the request so large playlists do not
+// grow it. The snapshot stored so far becomes the previous one, which
+// DiffPlaylist compares against; older ones are removed.
+func (d *db) UpdatePlaylistSnapshot(ctx context.Context, id string, snapshot models.PlaylistSnapshot) error {
+	var request struct {
+		SnapshotVersion int64 `bson:"snapshot_version"`
+	}
+	err := d.playlistsCollection().FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{"snapshot_version": 1},
+		"$set": bson.M{"updated_at": time.Now().Unix()},
+	}, options.FindOneAndUpdate().
+		SetProjection(bson.M{"snapshot_version": 1}).
+		SetReturnDocument(options.After)).Decode(&request)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	version := request.SnapshotVersion
+	_, err = d.playlistSnapshotsCollection().InsertOne(ctx, storedSnapshot{
+		ID:               fmt.Sprintf("%s/%d", id, version),
+		RequestID:        id,
+		Version:          version,
+		PlaylistSnapshot: snapshot,
+	})
+	if err != nil {
+		return err
+	}
+
+	// only the snapshot before is kept for DiffPlaylist
+	_, err = d.playlistSnapshotsCollection().DeleteMany(ctx, bson.M{"request_id": id, "version": bson.M{"$lt": version - 1}})
+	return err
+}
+
+// GetPlaylistSnapshot returns the playlist content of the last sync
+func (d *db) GetPlaylistSnapshot(ctx context.Context, id string) (models.PlaylistSnapshot, error) {
+	current, _, err := d.latestSnapshots(ctx, id)
+	if err != nil {
+		return models.PlaylistSnapshot{}, err
+	}
+	return *current, nil
+}
+
+// DiffPlaylist compares the last two snapshots of a playlist. After the first
+// sync every track counts as added.
+func (d *db) DiffPlaylist(ctx context.Context, id string) (models.PlaylistDiff, error) {
+	current, previous, err := d.latestSnapshots(ctx, id)
+	if err != nil {
+		return models.PlaylistDiff{}, err
+	}
+	return DiffLatestSnapshots(current, previous)
+}
+
+// latestSnapshots loads the last two snapshots of a playlist, previous is nil
+// after the first sync. It returns ErrNoSnapshot before the first sync.
+func (d *db) latestSnapshots(ctx context.Context, id string) (current, previous *models.PlaylistSnapshot, err error) {
+	cursor, err := d.playlistSnapshotsCollection().Find(ctx, bson.M{"request_id": id},
+		options.Find().SetSort(bson.M{"version": -1}).SetLimit(2))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var snapshots []storedSnapshot
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		return nil, nil, err
+	}
+
+	if len(snapshots) == 0 {
+		count, err := d.playlistsCollection().CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, nil, err
+		}
+		if count == 0 {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, ErrNoSnapshot
+	}
+
+	current = &snapshots[0].PlaylistSnapshot
+	if len(snapshots) > 1 {
+		previous = &snapshots[1].PlaylistSnapshot
+	}
+	return current, previous, nil
+}
+
+// DiffLatestSnapshots diffs the last snapshot of a playlist against the one
+// before, see DiffPlaylist. It is shared by the Database implementations.
+func DiffLatestSnapshots(current, previous *models.PlaylistSnapshot) (models.PlaylistDiff, error) {
+	if current == nil {
+		return models.PlaylistDiff{}, ErrNoSnapshot
+	}
+
+	var from models.PlaylistSnapshot
+	if previous != nil {
+		from = *previous
+	}
+	return models.DiffPlaylistSnapshots(from, *current), nil
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Retry policy defaults, used for unset RetryPolicy fields
+const (
+	DefaultRetryBackoff    = 10 * time.Minute
+	DefaultRetryMaxBackoff = 24 * time.Hour
+	DefaultRetryMultiplier = 2
+)
+
+// recordAttemptTries bounds how often RecordTrackAttempt re-reads a track
+// that was changed concurrently
+const recordAttemptTries = 5
+
+// RetryPolicy schedules the download attempts of a track. The n-th failed
+// attempt schedules the next one Backoff * Multiplier^(n-1) later, capped at
+// MaxBackoff; after MaxAttempts failures the track is skipped.
+type RetryPolicy struct {
+	MaxAttempts int           `envconfig:"MAX_ATTEMPTS" default:"3"`
+	Backoff     time.Duration `envconfig:"BACKOFF" default:"10m"`
+	MaxBackoff  time.Duration `envconfig:"MAX_BACKOFF" default:"24h"`
+	Multiplier  float64       `envconfig:"MULTIPLIER" default:"2"`
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: spotify.MaxFailedAttempts,
+		Backoff:     DefaultRetryBackoff,
+		MaxBackoff:  DefaultRetryMaxBackoff,
+		Multiplier:  DefaultRetryMultiplier,
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = defaults.Backoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaults.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaults.Multiplier
+	}
+	return p
+}
+
+// Delay returns how long to wait after the given number of failed attempts
+func (p RetryPolicy) Delay(failedAttempts int) time.Duration {
+	p = p.withDefaults()
+	delay := float64(p.Backoff) * math.Pow(p.Multiplier, float64(max(failedAttempts-1, 0)))
+	if delay >= float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// TrackAttempt is the outcome of one download attempt of a track
+type TrackAttempt struct {
+	Found bool
+	// Error describes why the track was not found
+	Error string
+	// At is when the attempt was made, now if zero
+	At time.Time
+}
+
+// Apply records attempt on track. It is shared by the Database implementations.
+func (p RetryPolicy) Apply(track spotify.TrackMetadata, attempt TrackAttempt) spotify.TrackMetadata {
+	p = p.withDefaults()
+	if attempt.At.IsZero() {
+		attempt.At = time.Now()
+	}
+
+	track.LastAttemptAt = attempt.At.Unix()
+	track.Found = attempt.Found
+	if attempt.Found {
+		track.Skipped = false
+		track.NextAttemptAt = 0
+		track.LastError = ""
+		return track
+	}
+
+	track.FailedAttempts++
+	track.LastError = attempt.Error
+	if track.FailedAttempts >= p.MaxAttempts {
+		track.Skipped = true
+		track.NextAttemptAt = 0
+		return track
+	}
+	track.NextAttemptAt = attempt.At.Add(p.Delay(track.FailedAttempts)).Unix()
+
+	return track
+}
+
+// TrackRetry is a track of a download request that is due for another attempt
+type TrackRetry struct {
+	RequestID  string                `json:"request_id" bson:"_id"`
+	RequestURL string                `json:"request_url" bson:"spotify_url"`
+	Track      spotify.TrackMetadata `json:"track" bson:"track_metadata"`
+}
+
+// foundDelta is the change of FoundTrackCount when a track changes from before to after
+func foundDelta(before, after spotify.TrackMetadata) int {
+	switch {
+	case after.Found && !before.Found:
+		return 1
+	case before.Found && !after.Found:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// SetRequestTracks replaces the tracks of a download request, updating its
+// expected and found track counts
+func (d *db) SetRequestTracks(ctx context.Context, id string, tracks []spotify.TrackMetadata) error {
+	if tracks == nil {
+		tracks = []spotify.TrackMetadata{}
+	}
+
+	found := 0
+	for _, track := range tracks {
+		if track.Found {
+			found++
+		}
+	}
+
+	info, err := d.downloadQueueRequestCollection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"track_metadata":       tracks,
+		"expected_track_count": len(tracks),
+		"found_track_count":    found,
+		"updated_at":           time.Now().Unix(),
+	}})
+	if err != nil {
+		return err
+	}
+
+	if info.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordTrackAttempt records a download attempt of the track with trackURL in
+// a request and schedules the next attempt with the configured RetryPolicy.
+// It returns the updated track.
+func (d *db) RecordTrackAttempt(ctx context.Context, requestID, trackURL string, attempt TrackAttempt) (spotify.TrackMetadata, error) {
+	if attempt.At.IsZero() {
+		attempt.At = time.Now()
+	}
+
+	for range recordAttemptTries {
+		var request models.DownloadQueueRequest
+		err := d.downloadQueueRequestCollection().FindOne(ctx,
+			bson.M{"_id": requestID, "track_metadata.spotify_url": trackURL},
+			options.FindOne().SetProjection(bson.M{"track_metadata.$": 1}),
+		).Decode(&request)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return spotify.TrackMetadata{}, ErrNotFound
+		}
+		if err != nil {
+			return spotify.TrackMetadata{}, err
+		}
+		if len(request.TrackMetadata) == 0 {
+			return spotify.TrackMetadata{}, ErrNotFound
+		}
+
+		current := request.TrackMetadata[0]
+		updated := d.cfg.TrackRetry.Apply(current, attempt)
+
+		// the filter only matches the track as it was read, so a concurrent
+		// attempt makes the update miss and the track is read again
+		filter := bson.M{"_id": requestID, "track_metadata": bson.M{"$elemMatch": bson.M{
+			"spotify_url":     trackURL,
+			"found":           current.Found,
+			"failed_attempts": current.FailedAttempts,
+		}}}
+		update := bson.M{
+			"$set": bson.M{"track_metadata.$": updated, "updated_at": time.Now().Unix()},
+			"$inc": bson.M{"found_track_count": foundDelta(current, updated)},
+		}
+		info, err := d.downloadQueueRequestCollection().UpdateOne(ctx, filter, update)
+		if err != nil {
+			return spotify.TrackMetadata{}, err
+		}
+		if info.MatchedCount == 1 {
+			return updated, nil
+		}
+	}
+
+	return spotify.TrackMetadata{}, ErrTrackChanged
+}
+
+// TracksDueForRetry returns the failed, not skipped tracks of active requests
+// whose next attempt is due at now, soonest first. A limit of 0 returns all.
+func (d *db) TracksDueForRetry(ctx context.Context, now time.Time, limit int) ([]TrackRetry, error) {
+	due := bson.M{
+		"found":           false,
+		"skipped":         false,
+		"failed_attempts": bson.M{"$gt": 0},
+		// tracks that failed before attempts were scheduled are due as well
+		"next_attempt_at": bson.M{"$not": bson.M{"$gt": now.Unix()}},
+	}
+	unwound := bson.M{}
+	for key, value := range due {
+		unwound["track_metadata."+key] = value
+	}
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"active": true, "track_metadata": bson.M{"$elemMatch": due}}},
+		{"$unwind": "$track_metadata"},
+		{"$match": unwound},
+		{"$sort": orderedDoc{{Name: "track_metadata.next_attempt_at", Value: 1}, {Name: "created_at", Value: 1}, {Name: "_id", Value: 1}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"spotify_url": 1, "track_metadata": 1}})
+
+	cursor, err := d.downloadQueueRequestCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	retries := make([]TrackRetry, 0)
+	if err := cursor.All(ctx, &retries); err != nil {
+		return nil, err
+	}
+
+	return retries, nil
+}
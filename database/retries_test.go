@@ -0,0 +1,53 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := database.RetryPolicy{Backoff: time.Minute, MaxBackoff: 5 * time.Minute, Multiplier: 3}
+
+	tests := []struct {
+		failed int
+		want   time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 3 * time.Minute},
+		{3, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.failed); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failed, got, tt.want)
+		}
+	}
+
+	if got := (database.RetryPolicy{}).Delay(2); got != 2*database.DefaultRetryBackoff {
+		t.Errorf("zero policy Delay(2) = %v, want the defaults", got)
+	}
+}
+
+func TestRetryPolicyApply(t *testing.T) {
+	policy := database.RetryPolicy{MaxAttempts: 2, Backoff: time.Minute}
+	at := time.Unix(1_700_000_000, 0)
+
+	track := policy.Apply(spotify.TrackMetadata{SpotifyURL: "a"}, database.TrackAttempt{Error: "timeout", At: at})
+	if track.FailedAttempts != 1 || track.Skipped || track.NextAttemptAt != at.Add(time.Minute).Unix() {
+		t.Errorf("after one failure = %+v", track)
+	}
+
+	track = policy.Apply(track, database.TrackAttempt{Error: "timeout", At: at})
+	if !track.Skipped || track.NextAttemptAt != 0 {
+		t.Errorf("after max attempts = %+v, want skipped", track)
+	}
+
+	track = policy.Apply(track, database.TrackAttempt{Found: true, At: at})
+	if !track.Found || track.Skipped || track.LastError != "" || track.FailedAttempts != 2 {
+		t.Errorf("after found attempt = %+v", track)
+	}
+}
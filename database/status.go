@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TransitionRequest moves a download request to a new status, rejecting
+// transitions not allowed by models.CanTransition. Moving it to any status
+// but downloading also clears its lease.
+func (d *db) TransitionRequest(ctx context.Context, id string, to models.RequestStatus, reason string) error {
+	return d.transitionStatus(ctx, d.downloadQueueRequestCollection(), id, to, reason)
+}
+
+// TransitionPlaylistRequest moves a playlist request to a new status
+func (d *db) TransitionPlaylistRequest(ctx context.Context, id string, to models.RequestStatus, reason string) error {
+	return d.transitionStatus(ctx, d.playlistsCollection(), id, to, reason)
+}
+
+func (d *db) transitionStatus(ctx context.Context, coll *mongo.Collection, id string, to models.RequestStatus, reason string) error {
+	var current struct {
+		Status  models.RequestStatus `bson:"status"`
+		Active  bool                 `bson:"active"`
+		Errored bool                 `bson:"errored"`
+	}
+	if err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&current); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	from := current.Status
+	if from == "" {
+		from = models.LegacyRequestStatus(current.Active, current.Errored)
+	}
+	if !models.CanTransition(from, to) {
+		return &models.TransitionError{From: from, To: to}
+	}
+
+	// only apply the update if nobody changed the status since we read it
+	filter := bson.M{"_id": id, "status": current.Status}
+	if current.Status == "" {
+		filter["status"] = bson.M{"$in": []interface{}{nil, ""}}
+	}
+
+	update := bson.M{"$set": bson.M{
+		"status":        to,
+		"status_reason": reason,
+		"active":        !to.IsTerminal(),
+		"errored":       to == models.RequestStatusFailed,
+		"updated_at":    time.Now().Unix(),
+	}}
+	// only a downloading request may hold a lease
+	if to != models.RequestStatusDownloading {
+		update["$unset"] = bson.M{"lease_owner": "", "lease_expires_at": ""}
+	}
+
+	info, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if info.MatchedCount == 0 {
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+// updateRequestFlags sets the Active/Errored flags of a request along with
+// the fields in set. The status is derived from the stored one, see
+// models.StatusForFlags, so a caller holding a stale copy cannot roll it back.
+func (d *db) updateRequestFlags(ctx context.Context, coll *mongo.Collection, id string, active, errored bool, set bson.M) error {
+	var current struct {
+		Status models.RequestStatus `bson:"status"`
+	}
+	if err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&current); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	to := models.StatusForFlags(current.Status, active, errored)
+	set["active"] = active
+	set["errored"] = errored
+	set["status"] = to
+	set["updated_at"] = time.Now().Unix()
+	update := bson.M{"$set": set}
+	if to != models.RequestStatusDownloading {
+		update["$unset"] = bson.M{"lease_owner": "", "lease_expires_at": ""}
+	}
+
+	// only apply the update if nobody changed the status since we read it
+	filter := bson.M{"_id": id, "status": current.Status}
+	if current.Status == "" {
+		filter["status"] = bson.M{"$in": []interface{}{nil, ""}}
+	}
+
+	info, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if info.MatchedCount == 0 {
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+// MigrateRequestStatuses sets Status on download and playlist requests created
+// before it existed, derived from their Active and Errored flags
+func (d *db) MigrateRequestStatuses(ctx context.Context) (int64, error) {
+	total, err := BackfillRequestStatuses(ctx, []*mongo.Collection{d.downloadQueueRequestCollection(), d.playlistsCollection()}, false)
+	if err != nil {
+		return total, err
+	}
+
+	d.log.Info("migrated request statuses", zap.Int64("count", total))
+	return total, nil
+}
+
+// BackfillRequestStatuses sets Status on the requests in colls that have
+// none, see models.LegacyRequestStatus. A dry run counts them instead. It is
+// shared by MigrateRequestStatuses and the request status migration.
+func BackfillRequestStatuses(ctx context.Context, colls []*mongo.Collection, dryRun bool) (int64, error) {
+	var total int64
+	for _, coll := range colls {
+		for _, active := range []bool{true, false} {
+			for _, errored := range []bool{true, false} {
+				filter := bson.M{
+					"status":  bson.M{"$in": []interface{}{nil, ""}},
+					"active":  legacyFlagFilter(active),
+					"errored": legacyFlagFilter(errored),
+				}
+
+				if dryRun {
+					count, err := coll.CountDocuments(ctx, filter)
+					if err != nil {
+						return total, err
+					}
+					total += count
+					continue
+				}
+
+				info, err := coll.UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+					"status": models.LegacyRequestStatus(active, errored),
+				}})
+				if err != nil {
+					return total, err
+				}
+				total += info.ModifiedCount
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// legacyFlagFilter matches a boolean flag, treating a missing field as false
+func legacyFlagFilter(value bool) interface{} {
+	if value {
+		return true
+	}
+	return bson.M{"$ne": true}
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// sweepBatchSize bounds the number of paths or ids per touch or sweep query
+const sweepBatchSize = 1000
+
+// SweepOptions configures SweepUnseenMusicFiles
+type SweepOptions struct {
+	// DryRun only reports the files that would be swept
+	DryRun bool
+	// HardDelete removes the files instead of setting DeletedAt. It also
+	// removes files soft-deleted by earlier sweeps.
+	HardDelete bool
+}
+
+// StartIndexGeneration begins a new index generation and returns it. Files
+// seen by a scan are marked with it through TouchMusicFiles or
+// IndexOptions.Generation, the rest are removed by SweepUnseenMusicFiles.
+func (d *db) StartIndexGeneration(ctx context.Context) (int64, error) {
+	var status models.IndexStatus
+	err := d.indexStatusCollection().FindOneAndUpdate(ctx, bson.M{}, bson.M{
+		"$inc": bson.M{"generation": 1},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&status)
+	if err != nil {
+		return 0, err
+	}
+
+	return status.Generation, nil
+}
+
+// TouchMusicFiles marks the files at paths as seen by generation, restoring
+// them if they were soft-deleted. It returns the number of files found.
+func (d *db) TouchMusicFiles(ctx context.Context, generation int64, paths []string) (int64, error) {
+	if generation <= 0 {
+		return 0, ErrInvalidGeneration
+	}
+	if len(paths) == 0 {
+		return 0, nil
+	}
+
+	var touched int64
+	for batch := range slices.Chunk(paths, sweepBatchSize) {
+		res, err := d.musicFilesCollection().UpdateMany(ctx, bson.M{"path": bson.M{"$in": batch}}, bson.M{
+			"$set":   bson.M{"index_generation": generation},
+			"$unset": bson.M{"deleted_at": ""},
+		})
+		if err != nil {
+			return touched, err
+		}
+		touched += res.MatchedCount
+	}
+
+	return touched, nil
+}
+
+// SweepUnseenMusicFiles deletes the files not seen by generation and records
+// the report as the last sweep of the index status
+func (d *db) SweepUnseenMusicFiles(ctx context.Context, generation int64, opts SweepOptions) (models.SweepReport, error) {
+	if generation <= 0 {
+		return models.SweepReport{}, ErrInvalidGeneration
+	}
+
+	filter := bson.M{"$or": []bson.M{
+		{"index_generation": bson.M{"$lt": generation}},
+		{"index_generation": bson.M{"$exists": false}},
+	}}
+	if !opts.HardDelete {
+		filter["deleted_at"] = bson.M{"$exists": false}
+	}
+
+	cur, err := d.musicFilesCollection().Find(ctx, filter, options.Find().SetProjection(bson.M{"path": 1}))
+	if err != nil {
+		return models.SweepReport{}, err
+	}
+	defer cur.Close(ctx)
+
+	report := models.SweepReport{
+		Generation: generation,
+		SweptAt:    time.Now().Unix(),
+		DryRun:     opts.DryRun,
+		HardDelete: opts.HardDelete,
+		Paths:      make([]string, 0),
+	}
+	ids := make([]string, 0, sweepBatchSize)
+	// sweep flushes the collected ids, keeping files touched since the lookup
+	sweep := func() error {
+		if opts.DryRun || len(ids) == 0 {
+			return nil
+		}
+		batch := bson.M{"_id": bson.M{"$in": ids}}
+		for key, value := range filter {
+			batch[key] = value
+		}
+		ids = ids[:0]
+
+		if opts.HardDelete {
+			res, err := d.musicFilesCollection().DeleteMany(ctx, batch)
+			if err != nil {
+				return err
+			}
+			report.Count += res.DeletedCount
+			return nil
+		}
+		res, err := d.musicFilesCollection().UpdateMany(ctx, batch, bson.M{
+			"$set": bson.M{"deleted_at": report.SweptAt},
+		})
+		if err != nil {
+			return err
+		}
+		report.Count += res.ModifiedCount
+		return nil
+	}
+
+	for cur.Next(ctx) {
+		var file models.MusicFile
+		if err := cur.Decode(&file); err != nil {
+			return models.SweepReport{}, err
+		}
+		report.Paths = append(report.Paths, file.Path)
+		if opts.DryRun {
+			report.Count++
+			continue
+		}
+
+		ids = append(ids, file.ID)
+		if len(ids) == sweepBatchSize {
+			if err := sweep(); err != nil {
+				return models.SweepReport{}, err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return models.SweepReport{}, err
+	}
+	if err := sweep(); err != nil {
+		return models.SweepReport{}, err
+	}
+
+	_, err = d.indexStatusCollection().UpdateOne(ctx, bson.M{}, bson.M{
+		"$set": bson.M{"last_sweep": report},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return models.SweepReport{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gofrs/uuid"
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/matching"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// UpsertOutcome says what an upsert did with a music file
+type UpsertOutcome string
+
+const (
+	UpsertCreated   UpsertOutcome = "created"
+	UpsertChanged   UpsertOutcome = "changed"
+	UpsertUnchanged UpsertOutcome = "unchanged"
+)
+
+// UpsertResult is the outcome of upserting one music file
+type UpsertResult struct {
+	ID      string
+	Path    string
+	Outcome UpsertOutcome
+}
+
+// UpsertMusicFile creates or updates the music file stored under file.Path.
+// If no file has that path but one has the same ContentHash, that file is
+// treated as moved and updated in place. ID and CreatedAt of existing files
+// are preserved and UpdatedAt is only bumped when something changed.
+func (d *db) UpsertMusicFile(ctx context.Context, file models.MusicFile) (UpsertResult, error) {
+	results, err := d.UpsertMusicFiles(ctx, []models.MusicFile{file})
+	if err != nil {
+		return UpsertResult{}, err
+	}
+	return results[0], nil
+}
+
+// UpsertMusicFiles upserts a batch of files with one lookup and one bulk
+// write. Use IndexMusicFiles for large batches and per-file errors.
+func (d *db) UpsertMusicFiles(ctx context.Context, files []models.MusicFile) ([]UpsertResult, error) {
+	if len(files) == 0 {
+		return []UpsertResult{}, nil
+	}
+
+	indexed, err := d.indexBatch(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	return upsertResults(indexed)
+}
+
+// upsertResults strips per-file errors, failing on the first one
+func upsertResults(indexed []IndexFileResult) ([]UpsertResult, error) {
+	results := make([]UpsertResult, len(indexed))
+	for i, result := range indexed {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		results[i] = result.UpsertResult
+	}
+	return results, nil
+}
+
+// existingMusicFiles loads the stored files sharing a path or content hash with files
+func (d *db) existingMusicFiles(ctx context.Context, files []models.MusicFile) ([]models.MusicFile, error) {
+	paths := make([]string, 0, len(files))
+	hashes := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+		if file.ContentHash != "" {
+			hashes = append(hashes, file.ContentHash)
+		}
+	}
+
+	or := []bson.M{{"path": bson.M{"$in": paths}}}
+	if len(hashes) > 0 {
+		or = append(or, bson.M{"content_hash": bson.M{"$in": hashes}})
+	}
+
+	cur, err := d.musicFilesCollection().Find(ctx, bson.M{"$or": or})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	existing := make([]models.MusicFile, 0)
+	if err := cur.All(ctx, &existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// MusicFileWrite is a write planned by PlanMusicFileUpserts
+type MusicFileWrite struct {
+	File    models.MusicFile
+	Outcome UpsertOutcome
+}
+
+// PlanMusicFileUpserts decides for every file whether it is created, changed
+// or unchanged, given the stored files sharing a path or content hash with
+// them. It is shared by the Database implementations.
+//
+// When a path occurs more than once in files the last occurrence wins. A
+// stored file is only treated as moved to a new path if its own path is not
+// part of the batch, so copies of the same file keep separate records.
+func PlanMusicFileUpserts(existing, files []models.MusicFile, now int64) ([]UpsertResult, []MusicFileWrite) {
+	byPath := make(map[string]models.MusicFile, len(existing))
+	byHash := make(map[string]models.MusicFile)
+	for _, file := range existing {
+		byPath[file.Path] = file
+		if file.ContentHash != "" {
+			byHash[file.ContentHash] = file
+		}
+	}
+
+	last := make(map[string]int, len(files))
+	claimed := make(map[string]bool, len(files))
+	for i, file := range files {
+		last[file.Path] = i
+		claimed[file.Path] = true
+	}
+
+	results := make([]UpsertResult, len(files))
+	writes := make([]MusicFileWrite, 0, len(files))
+	for i, file := range files {
+		if last[file.Path] != i {
+			continue
+		}
+
+		file.TitleWords = matching.TitleWords(file.Title)
+		current, ok := byPath[file.Path]
+		if !ok && file.ContentHash != "" {
+			if moved, found := byHash[file.ContentHash]; found && !claimed[moved.Path] {
+				current, ok = moved, true
+				claimed[moved.Path] = true
+			}
+		}
+
+		outcome := UpsertChanged
+		switch {
+		case !ok:
+			outcome = UpsertCreated
+			file.ID = uuid.Must(uuid.NewV4()).String()
+			file.CreatedAt = now
+			file.UpdatedAt = now
+		case current.SameContent(file) && !current.Deleted() && slices.Equal(current.TitleWords, file.TitleWords):
+			outcome = UpsertUnchanged
+			file = current
+		default:
+			// a soft-deleted file that shows up again is restored
+			file.ID = current.ID
+			file.CreatedAt = current.CreatedAt
+			file.UpdatedAt = now
+			if file.IndexGeneration == 0 {
+				file.IndexGeneration = current.IndexGeneration
+			}
+		}
+
+		results[i] = UpsertResult{ID: file.ID, Path: file.Path, Outcome: outcome}
+		if outcome != UpsertUnchanged {
+			writes = append(writes, MusicFileWrite{File: file, Outcome: outcome})
+		}
+	}
+
+	// earlier occurrences of a path share the result of the last one
+	for i, file := range files {
+		if j := last[file.Path]; j != i {
+			results[i] = results[j]
+		}
+	}
+
+	return results, writes
+}
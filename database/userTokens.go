@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/oauth2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultUserTokensCollectionName is used when UserTokensCollectionName is empty
+const DefaultUserTokensCollectionName = "spotify_user_tokens"
+
+// SaveUserToken stores the token of token.CreatorID, replacing the previous
+// one. An empty Scope keeps the stored scope.
+func (d *db) SaveUserToken(ctx context.Context, token models.UserToken) error {
+	now := time.Now().Unix()
+	set := bson.M{
+		"access_token":  token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"token_type":    token.TokenType,
+		"expiry":        token.Expiry,
+		"updated_at":    now,
+	}
+	// refresh responses may leave out the scope, which did not change then
+	if token.Scope != "" {
+		set["scope"] = token.Scope
+	}
+
+	_, err := d.userTokensCollection().UpdateOne(ctx, bson.M{"_id": token.CreatorID}, bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"created_at": now},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (d *db) GetUserToken(ctx context.Context, creatorID int64) (models.UserToken, error) {
+	var token models.UserToken
+	err := d.userTokensCollection().FindOne(ctx, bson.M{"_id": creatorID}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.UserToken{}, ErrNotFound
+	}
+	if err != nil {
+		return models.UserToken{}, err
+	}
+
+	return token, nil
+}
+
+// DeleteUserToken forgets the token of a user, e.g. when they revoke access
+func (d *db) DeleteUserToken(ctx context.Context, creatorID int64) error {
+	info, err := d.userTokensCollection().DeleteOne(ctx, bson.M{"_id": creatorID})
+	if err != nil {
+		return err
+	}
+
+	if info.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// NewTokenStore returns a spotify.TokenStore keeping the tokens of
+// spotify.UserAuth in d
+func NewTokenStore(d Database) spotify.TokenStore {
+	return tokenStore{d: d}
+}
+
+type tokenStore struct {
+	d Database
+}
+
+func (s tokenStore) LoadToken(ctx context.Context, creatorID int64) (*oauth2.Token, error) {
+	stored, err := s.d.GetUserToken(ctx, creatorID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, spotify.ErrNoUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  stored.AccessToken,
+		RefreshToken: stored.RefreshToken,
+		TokenType:    stored.TokenType,
+	}
+	if stored.Expiry != 0 {
+		token.Expiry = time.Unix(stored.Expiry, 0)
+	}
+	return token, nil
+}
+
+func (s tokenStore) SaveToken(ctx context.Context, creatorID int64, token *oauth2.Token) error {
+	stored := models.UserToken{
+		CreatorID:    creatorID,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    token.TokenType,
+	}
+	if !token.Expiry.IsZero() {
+		stored.Expiry = token.Expiry.Unix()
+	}
+	if scope, ok := token.Extra("scope").(string); ok {
+		stored.Scope = scope
+	}
+
+	return s.d.SaveUserToken(ctx, stored)
+}
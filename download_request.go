@@ -12,6 +12,9 @@ type DownloadQueueRequest struct {
 	Active     bool                      `json:"active" bson:"active"`
 	Errored    bool                      `json:"errored" bson:"errored"`
 
+	Status       RequestStatus `json:"status" bson:"status"`
+	StatusReason string        `json:"status_reason,omitempty" bson:"status_reason,omitempty"`
+
 	CreatedAt  int64 `json:"created_at" bson:"created_at"`
 	UpdatedAt  int64 `json:"updated_at" bson:"updated_at"`
 	SyncCount  int   `json:"sync_count" bson:"sync_count"`
@@ -21,19 +24,36 @@ type DownloadQueueRequest struct {
 	ExpectedTrackCount int                     `json:"expected_track_count" bson:"expected_track_count"`
 	FoundTrackCount    int                     `json:"found_track_count" bson:"found_track_count"`
 	TrackMetadata      []spotify.TrackMetadata `json:"track_metadata" bson:"track_metadata"`
+
+	// Lease fields, set while a worker is processing the request
+	LeaseOwner     string `json:"lease_owner,omitempty" bson:"lease_owner,omitempty"`
+	LeaseExpiresAt int64  `json:"lease_expires_at,omitempty" bson:"lease_expires_at,omitempty"`
 }
 
 type PlaylistRequest struct {
 	ID         string `json:"id" bson:"_id"`
 	CreatorID  int64  `json:"creator_id" bson:"creator_id"`
 	SpotifyURL string `json:"spotify_url" bson:"spotify_url"`
+	// ObjectType is a playlist, or a library collection for library sync
+	// requests. Requests created before it was added have none.
+	ObjectType spotify.SpotifyObjectType `json:"object_type,omitempty" bson:"object_type,omitempty"`
 
 	Active     bool `json:"active" bson:"active"`
 	Errored    bool `json:"errored" bson:"errored"`
 	RetryCount int  `json:"retry_count" bson:"retry_count"`
+
+	Status       RequestStatus `json:"status" bson:"status"`
+	StatusReason string        `json:"status_reason,omitempty" bson:"status_reason,omitempty"`
 	// NoPull indicates that the playlist missing songs should not be pulled from Spotify
 	NoPull bool `json:"no_pull" bson:"no_pull"`
 
 	CreatedAt int64 `json:"created_at" bson:"created_at"`
 	UpdatedAt int64 `json:"updated_at" bson:"updated_at"`
 }
+
+// IsLibrarySync reports whether the request mirrors the creator's Liked Songs
+// or saved albums. Its SpotifyURL is the same for every user, so it has to be
+// synced with the creator's token, see spotify.SpotifyService.ForUser.
+func (r PlaylistRequest) IsLibrarySync() bool {
+	return r.ObjectType.IsLibrary()
+}
@@ -5,4 +5,21 @@ type IndexStatus struct {
 	ID          string `bson:"_id"`
 	LastIndexed int64  `bson:"last_indexed"`
 	LastUpdated int64  `bson:"last_updated"`
+
+	// Generation is the current index generation, see StartIndexGeneration.
+	// Zero values are not written, so updating the status keeps them.
+	Generation int64        `bson:"generation,omitempty"`
+	LastSweep  *SweepReport `bson:"last_sweep,omitempty"`
+}
+
+// SweepReport describes a sweep of the music files not seen by an index generation
+type SweepReport struct {
+	Generation int64 `bson:"generation"`
+	SweptAt    int64 `bson:"swept_at"`
+	DryRun     bool  `bson:"dry_run"`
+	HardDelete bool  `bson:"hard_delete"`
+	// Count is the number of files deleted, or that would be deleted on a dry run
+	Count int64 `bson:"count"`
+	// Paths of the swept files, not stored with the index status
+	Paths []string `bson:"-"`
 }
@@ -0,0 +1,466 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrUnsupportedFormat is returned for files whose stream properties cannot be read
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// errInvalidStream is returned when a file does not look like its format
+var errInvalidStream = errors.New("invalid audio stream")
+
+// AudioProperties are the stream properties that tags do not carry
+type AudioProperties struct {
+	Duration time.Duration
+	// Bitrate is the average bitrate in kbit/s
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	Codec      string
+	// BitDepth is only set for lossless codecs
+	BitDepth int
+}
+
+// ReadAudioProperties reads the stream properties of an MP3, FLAC, Ogg
+// (Vorbis or Opus) or MP4 file of the given size
+func ReadAudioProperties(r io.ReadSeeker, size int64, ext string) (AudioProperties, error) {
+	var (
+		props AudioProperties
+		err   error
+	)
+	switch ext {
+	case ".mp3":
+		props, err = readMP3(r, size)
+	case ".flac":
+		props, err = readFLAC(r)
+	case ".ogg", ".oga", ".opus":
+		props, err = readOgg(r, size)
+	case ".m4a", ".m4b", ".mp4":
+		props, err = readMP4(r, size)
+	default:
+		return AudioProperties{}, ErrUnsupportedFormat
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errInvalidStream
+		}
+		return AudioProperties{}, err
+	}
+
+	if props.Bitrate == 0 && props.Duration > 0 {
+		props.Bitrate = int(float64(size*8) / props.Duration.Seconds() / 1000)
+	}
+	return props, nil
+}
+
+func samplesDuration(samples int64, sampleRate int) time.Duration {
+	return ratioDuration(samples, int64(sampleRate))
+}
+
+// ratioDuration is n/perSecond seconds, computed without overflowing for long files
+func ratioDuration(n, perSecond int64) time.Duration {
+	if perSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(n) / float64(perSecond) * float64(time.Second))
+}
+
+// id3v2Size returns the size of the ID3v2 tag at the start of r, zero if there is none
+func id3v2Size(r io.ReadSeeker) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+
+	size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+	size += 10
+	if header[5]&0x10 != 0 {
+		// footer present
+		size += 10
+	}
+	return size, nil
+}
+
+func readFLAC(r io.ReadSeeker) (AudioProperties, error) {
+	offset, err := id3v2Size(r)
+	if err != nil {
+		return AudioProperties{}, err
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return AudioProperties{}, err
+	}
+
+	// "fLaC", then the STREAMINFO block header and its 34 bytes
+	buf := make([]byte, 4+4+34)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return AudioProperties{}, err
+	}
+	if string(buf[:4]) != "fLaC" || buf[4]&0x7f != 0 {
+		return AudioProperties{}, errInvalidStream
+	}
+
+	// sample rate (20 bits), channels - 1 (3), bits per sample - 1 (5), total samples (36)
+	info := binary.BigEndian.Uint64(buf[8+10 : 8+18])
+	sampleRate := int(info >> 44)
+	channels := int(info>>41&0x7) + 1
+	bitDepth := int(info>>36&0x1f) + 1
+	samples := int64(info & (1<<36 - 1))
+
+	return AudioProperties{
+		Duration:   samplesDuration(samples, sampleRate),
+		SampleRate: sampleRate,
+		Channels:   channels,
+		Codec:      "flac",
+		BitDepth:   bitDepth,
+	}, nil
+}
+
+var (
+	// kbit/s by bitrate index, for MPEG-1 layers I-III and MPEG-2/2.5 layer I and layers II/III
+	mpeg1Bitrates = [3][16]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	}
+	mpeg2Bitrates = [2][16]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mpeg1SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3Frame is a parsed MPEG audio frame header
+type mp3Frame struct {
+	mpeg1      bool
+	layer      int
+	bitrate    int
+	sampleRate int
+	mono       bool
+}
+
+func parseMP3Frame(h []byte) (mp3Frame, bool) {
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+
+	version := h[1] >> 3 & 0x3
+	layer := 4 - int(h[1]>>1&0x3)
+	bitrateIndex := h[2] >> 4
+	sampleRateIndex := h[2] >> 2 & 0x3
+	if version == 1 || layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	frame := mp3Frame{
+		mpeg1:      version == 3,
+		layer:      layer,
+		sampleRate: mpeg1SampleRates[sampleRateIndex],
+		mono:       h[3]>>6 == 3,
+	}
+	switch version {
+	case 3:
+		frame.bitrate = mpeg1Bitrates[layer-1][bitrateIndex]
+	case 2:
+		frame.sampleRate /= 2
+	case 0:
+		frame.sampleRate /= 4
+	}
+	if !frame.mpeg1 {
+		frame.bitrate = mpeg2Bitrates[min(layer-1, 1)][bitrateIndex]
+	}
+	return frame, true
+}
+
+func (f mp3Frame) samples() int64 {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && !f.mpeg1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// xingOffset is the offset of a Xing/Info header from the start of the frame
+func (f mp3Frame) xingOffset() int {
+	switch {
+	case f.mpeg1 && !f.mono:
+		return 4 + 32
+	case f.mpeg1 || !f.mono:
+		return 4 + 17
+	default:
+		return 4 + 9
+	}
+}
+
+// mp3SyncWindow bounds the search for the first frame after the ID3 tag
+const mp3SyncWindow = 64 << 10
+
+func readMP3(r io.ReadSeeker, size int64) (AudioProperties, error) {
+	offset, err := id3v2Size(r)
+	if err != nil {
+		return AudioProperties{}, err
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return AudioProperties{}, err
+	}
+
+	buf := make([]byte, mp3SyncWindow)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return AudioProperties{}, err
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		frame, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+
+		props := AudioProperties{SampleRate: frame.sampleRate, Channels: 2, Codec: fmt.Sprintf("mp%d", frame.layer)}
+		if frame.mono {
+			props.Channels = 1
+		}
+
+		// VBR files carry the frame count in a Xing/Info or VBRI header
+		var frames int64
+		header := buf[i:]
+		if x := frame.xingOffset(); len(header) >= x+12 {
+			if tag := string(header[x : x+4]); (tag == "Xing" || tag == "Info") && header[x+7]&0x1 != 0 {
+				frames = int64(binary.BigEndian.Uint32(header[x+8:]))
+			}
+		}
+		if len(header) >= 4+32+18 && bytes.Equal(header[4+32:4+36], []byte("VBRI")) {
+			frames = int64(binary.BigEndian.Uint32(header[4+32+14:]))
+		}
+
+		audioSize := size - offset - int64(i)
+		if frames > 0 {
+			props.Duration = samplesDuration(frames*frame.samples(), frame.sampleRate)
+		} else {
+			props.Bitrate = frame.bitrate
+			props.Duration = ratioDuration(audioSize*8, int64(frame.bitrate)*1000)
+		}
+		if props.Bitrate == 0 && props.Duration > 0 {
+			props.Bitrate = int(float64(audioSize*8) / props.Duration.Seconds() / 1000)
+		}
+		return props, nil
+	}
+
+	return AudioProperties{}, errInvalidStream
+}
+
+// oggTailSize is how much of the end of an Ogg file is searched for the last page
+const oggTailSize = 64 << 10
+
+func readOgg(r io.ReadSeeker, size int64) (AudioProperties, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return AudioProperties{}, err
+	}
+
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return AudioProperties{}, err
+	}
+	if string(header[:4]) != "OggS" {
+		return AudioProperties{}, errInvalidStream
+	}
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r, segments); err != nil {
+		return AudioProperties{}, err
+	}
+	var packetSize int
+	for _, segment := range segments {
+		packetSize += int(segment)
+	}
+	packet := make([]byte, packetSize)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return AudioProperties{}, err
+	}
+
+	var (
+		props   AudioProperties
+		opus    bool
+		preSkip int64
+	)
+	switch {
+	case len(packet) >= 30 && bytes.Equal(packet[:7], []byte("\x01vorbis")):
+		props.Channels = int(packet[11])
+		props.SampleRate = int(binary.LittleEndian.Uint32(packet[12:]))
+		props.Bitrate = int(int32(binary.LittleEndian.Uint32(packet[20:]))) / 1000
+		props.Codec = "vorbis"
+	case len(packet) >= 19 && bytes.Equal(packet[:8], []byte("OpusHead")):
+		props.Channels = int(packet[9])
+		props.SampleRate = int(binary.LittleEndian.Uint32(packet[12:]))
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:]))
+		props.Codec = "opus"
+		opus = true
+	default:
+		return AudioProperties{}, ErrUnsupportedFormat
+	}
+
+	// the granule position of the last page is the total number of samples,
+	// always counted at 48kHz for Opus
+	tail := min(size, oggTailSize)
+	if _, err := r.Seek(size-tail, io.SeekStart); err != nil {
+		return AudioProperties{}, err
+	}
+	buf := make([]byte, tail)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return AudioProperties{}, err
+	}
+	last := bytes.LastIndex(buf, []byte("OggS"))
+	if last < 0 || last+14 > len(buf) {
+		return AudioProperties{}, errInvalidStream
+	}
+	granule := int64(binary.LittleEndian.Uint64(buf[last+6:]))
+
+	rate := props.SampleRate
+	if opus {
+		rate = 48000
+	}
+	props.Duration = samplesDuration(granule-preSkip, rate)
+	// the nominal bitrate of vorbis streams is optional
+	props.Bitrate = max(props.Bitrate, 0)
+	return props, nil
+}
+
+// mp4Containers are the atoms on the way to the movie header and sample descriptions
+var mp4Containers = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true}
+
+func readMP4(r io.ReadSeeker, size int64) (AudioProperties, error) {
+	var (
+		props     AudioProperties
+		foundMvhd bool
+	)
+
+	var walk func(start, end int64) error
+	walk = func(start, end int64) error {
+		header := make([]byte, 8)
+		for pos := start; pos+8 <= end; {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(r, header); err != nil {
+				return err
+			}
+			atomSize := int64(binary.BigEndian.Uint32(header))
+			typ := string(header[4:])
+			headerSize := int64(8)
+			switch atomSize {
+			case 0:
+				atomSize = end - pos
+			case 1:
+				if _, err := io.ReadFull(r, header); err != nil {
+					return err
+				}
+				atomSize = int64(binary.BigEndian.Uint64(header))
+				headerSize = 16
+			}
+			if atomSize < headerSize || pos+atomSize > end {
+				return errInvalidStream
+			}
+
+			body := pos + headerSize
+			switch {
+			case mp4Containers[typ]:
+				if err := walk(body, pos+atomSize); err != nil {
+					return err
+				}
+			case typ == "mvhd":
+				if err := readMvhd(r, &props); err != nil {
+					return err
+				}
+				foundMvhd = true
+			case typ == "stsd" && props.SampleRate == 0:
+				if err := readStsd(r, atomSize-headerSize, &props); err != nil {
+					return err
+				}
+			}
+			pos += atomSize
+		}
+		return nil
+	}
+
+	if err := walk(0, size); err != nil {
+		return AudioProperties{}, err
+	}
+	if !foundMvhd {
+		return AudioProperties{}, errInvalidStream
+	}
+	return props, nil
+}
+
+func readMvhd(r io.Reader, props *AudioProperties) error {
+	buf := make([]byte, 4+8+8+4+8)
+	if _, err := io.ReadFull(r, buf[:4+4+4+4+4]); err != nil {
+		return err
+	}
+
+	var timescale, duration int64
+	if buf[0] == 1 {
+		// 64 bit creation and modification times and duration
+		if _, err := io.ReadFull(r, buf[20:]); err != nil {
+			return err
+		}
+		timescale = int64(binary.BigEndian.Uint32(buf[20:]))
+		duration = int64(binary.BigEndian.Uint64(buf[24:]))
+	} else {
+		timescale = int64(binary.BigEndian.Uint32(buf[12:]))
+		duration = int64(binary.BigEndian.Uint32(buf[16:]))
+	}
+	props.Duration = ratioDuration(duration, timescale)
+	return nil
+}
+
+// mp4Codecs maps the audio sample entry formats to codec names
+var mp4Codecs = map[string]string{
+	"mp4a": "aac",
+	"alac": "alac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+}
+
+// readStsd reads the codec, channels and sample rate from the first audio sample entry
+func readStsd(r io.Reader, size int64, props *AudioProperties) error {
+	// version and flags, entry count, then the entry: size, format, 6
+	// reserved bytes, data reference index, version, revision, vendor,
+	// channels, sample size, compression id, packet size, 16.16 sample rate
+	const entryEnd = 8 + 8 + 6 + 2 + 2 + 2 + 4 + 2 + 2 + 2 + 2 + 4
+	if size < entryEnd {
+		return nil
+	}
+	buf := make([]byte, entryEnd)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+
+	format := string(buf[12:16])
+	codec, ok := mp4Codecs[format]
+	if !ok {
+		return nil
+	}
+	props.Codec = codec
+	props.Channels = int(binary.BigEndian.Uint16(buf[32:]))
+	props.SampleRate = int(binary.BigEndian.Uint32(buf[40:]) >> 16)
+	if format == "alac" || format == "fLaC" {
+		props.BitDepth = int(binary.BigEndian.Uint16(buf[34:]))
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Package scanner walks a music directory and reads the tags and stream
+// properties of its audio files into models.MusicFile records.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+	"github.com/supperdoggy/spot-models"
+)
+
+// DefaultExtensions are the file extensions scanned when Options.Extensions is empty
+var DefaultExtensions = []string{".mp3", ".flac", ".ogg", ".oga", ".opus", ".m4a", ".m4b", ".mp4"}
+
+// Options configures Scan
+type Options struct {
+	// Extensions are the lower case file extensions to read, DefaultExtensions if empty
+	Extensions []string
+	// Since makes the scan incremental: files not modified after it (unix
+	// seconds, usually IndexStatus.LastIndexed) are reported as unchanged
+	// instead of being read
+	Since int64
+	// Sizes are the sizes of the indexed files by path, see MusicFile.Size.
+	// With Since set, files that are missing from Sizes or changed size are
+	// read regardless of mtime.
+	Sizes map[string]int64
+}
+
+// Result is the outcome of Scan
+type Result struct {
+	// Files are the files read by the scan
+	Files []models.MusicFile
+	// Unchanged are the paths of files skipped by an incremental scan. They
+	// still exist on disk, so they should be touched for the index generation.
+	Unchanged []string
+	// Errors are the files and directories that could not be read
+	Errors []FileError
+	// StartedAt is when the scan started, to be stored as
+	// IndexStatus.LastIndexed for the next incremental scan
+	StartedAt int64
+}
+
+// FileError is a file that could not be scanned
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("scan %s: %v", e.Path, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// Scan walks root and reads every audio file in it. Hidden files and
+// directories are skipped. Files that cannot be read are reported in
+// Result.Errors; the returned error is only set when root cannot be walked or
+// ctx is done.
+func Scan(ctx context.Context, root string, opts Options) (Result, error) {
+	result := Result{
+		Files:     make([]models.MusicFile, 0),
+		Unchanged: make([]string, 0),
+		StartedAt: time.Now().Unix(),
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return Result{}, err
+	}
+	if _, err := os.Stat(root); err != nil {
+		return Result{}, err
+	}
+
+	extensions := opts.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, FileError{Path: path, Err: err})
+			return nil
+		}
+
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || !slices.Contains(extensions, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			result.Errors = append(result.Errors, FileError{Path: path, Err: err})
+			return nil
+		}
+		if opts.unchanged(path, info) {
+			result.Unchanged = append(result.Unchanged, path)
+			return nil
+		}
+
+		file, err := readFile(path, info)
+		if err != nil {
+			result.Errors = append(result.Errors, FileError{Path: path, Err: err})
+			return nil
+		}
+		result.Files = append(result.Files, file)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (o Options) unchanged(path string, info fs.FileInfo) bool {
+	if o.Since == 0 || info.ModTime().Unix() > o.Since {
+		return false
+	}
+	if o.Sizes == nil {
+		return true
+	}
+	size, ok := o.Sizes[path]
+	return ok && size == info.Size()
+}
+
+// ReadFile reads the tags and stream properties of a single audio file
+func ReadFile(path string) (models.MusicFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.MusicFile{}, err
+	}
+	return readFile(path, info)
+}
+
+func readFile(path string, info fs.FileInfo) (models.MusicFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return models.MusicFile{}, err
+	}
+	defer f.Close()
+
+	file := models.MusicFile{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime().Unix(),
+	}
+
+	meta, err := tag.ReadFrom(f)
+	switch {
+	case errors.Is(err, tag.ErrNoTagsFound):
+		// untagged files are indexed by their file name
+	case err != nil:
+		return models.MusicFile{}, fmt.Errorf("read tags: %w", err)
+	default:
+		readTags(&file, meta)
+	}
+	if file.Title == "" {
+		file.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	props, err := ReadAudioProperties(f, info.Size(), strings.ToLower(filepath.Ext(path)))
+	if err != nil {
+		return models.MusicFile{}, fmt.Errorf("read audio properties: %w", err)
+	}
+	file.Audio.DurationMs = props.Duration.Milliseconds()
+	file.Audio.Bitrate = props.Bitrate
+	file.Audio.SampleRate = props.SampleRate
+	file.Audio.Channels = props.Channels
+	file.Audio.Codec = props.Codec
+	file.Audio.BitDepth = props.BitDepth
+
+	return file, nil
+}
@@ -0,0 +1,286 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/spot-models"
+)
+
+func flacFile(sampleRate, channels int, samples int64, comments ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+
+	info := make([]byte, 34)
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(15)<<36 | uint64(samples)
+	binary.BigEndian.PutUint64(info[10:], packed)
+	buf.Write([]byte{0, 0, 0, 34})
+	buf.Write(info)
+
+	var vorbis bytes.Buffer
+	binary.Write(&vorbis, binary.LittleEndian, uint32(4))
+	vorbis.WriteString("test")
+	binary.Write(&vorbis, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		binary.Write(&vorbis, binary.LittleEndian, uint32(len(comment)))
+		vorbis.WriteString(comment)
+	}
+	size := vorbis.Len()
+	buf.Write([]byte{0x80 | 4, byte(size >> 16), byte(size >> 8), byte(size)})
+	buf.Write(vorbis.Bytes())
+
+	buf.Write(make([]byte, 1024))
+	return buf.Bytes()
+}
+
+// mp3File is an ID3v2.3 tag followed by frames of 128kbit/s 44.1kHz stereo MPEG-1 layer III
+func mp3File(frames int, tags map[string]string) []byte {
+	var frameData bytes.Buffer
+	for id, value := range tags {
+		frameData.WriteString(id)
+		binary.Write(&frameData, binary.BigEndian, uint32(len(value)+1))
+		frameData.Write([]byte{0, 0, 0})
+		frameData.WriteString(value)
+	}
+	size := frameData.Len()
+
+	var buf bytes.Buffer
+	buf.WriteString("ID3")
+	buf.Write([]byte{3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	buf.Write(frameData.Bytes())
+
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	for range frames {
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func oggPage(granule int64, payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("OggS")
+	buf.Write([]byte{0, 0})
+	binary.Write(&buf, binary.LittleEndian, granule)
+	buf.Write(make([]byte, 12))
+	buf.WriteByte(1)
+	buf.WriteByte(byte(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func vorbisFile(sampleRate int, samples int64) []byte {
+	ident := make([]byte, 30)
+	copy(ident, "\x01vorbis")
+	ident[11] = 2
+	binary.LittleEndian.PutUint32(ident[12:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(ident[20:], 192000)
+	return append(oggPage(0, ident), oggPage(samples, make([]byte, 100))...)
+}
+
+func opusFile(preSkip int, samples int64) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[9] = 2
+	binary.LittleEndian.PutUint16(head[10:], uint16(preSkip))
+	binary.LittleEndian.PutUint32(head[12:], 44100)
+	return append(oggPage(0, head), oggPage(samples+int64(preSkip), make([]byte, 100))...)
+}
+
+func atom(typ string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+func mp4File(timescale, duration uint32, sampleRate int) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+
+	entry := make([]byte, 36)
+	copy(entry[4:], "mp4a")
+	binary.BigEndian.PutUint32(entry, uint32(len(entry)))
+	binary.BigEndian.PutUint16(entry[24:], 2)
+	binary.BigEndian.PutUint32(entry[32:], uint32(sampleRate)<<16)
+	stsd := append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, entry...)
+
+	return bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A \x00\x00\x00\x00")),
+		atom("moov", atom("mvhd", mvhd), atom("trak", atom("mdia", atom("minf", atom("stbl", atom("stsd", stsd)))))),
+		atom("mdat", make([]byte, 4096)),
+	}, nil)
+}
+
+func TestReadAudioProperties(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+		data []byte
+		want AudioProperties
+	}{
+		{
+			name: "flac",
+			ext:  ".flac",
+			data: flacFile(44100, 2, 44100*200),
+			want: AudioProperties{Duration: 200 * time.Second, SampleRate: 44100, Channels: 2, Codec: "flac", BitDepth: 16},
+		},
+		{
+			name: "mp3 cbr",
+			ext:  ".mp3",
+			data: mp3File(100, nil),
+			want: AudioProperties{Duration: 2606250 * time.Microsecond, Bitrate: 128, SampleRate: 44100, Channels: 2, Codec: "mp3"},
+		},
+		{
+			name: "vorbis",
+			ext:  ".ogg",
+			data: vorbisFile(48000, 48000*90),
+			want: AudioProperties{Duration: 90 * time.Second, Bitrate: 192, SampleRate: 48000, Channels: 2, Codec: "vorbis"},
+		},
+		{
+			name: "opus counts samples at 48kHz",
+			ext:  ".opus",
+			data: opusFile(312, 48000*60),
+			want: AudioProperties{Duration: 60 * time.Second, SampleRate: 44100, Channels: 2, Codec: "opus"},
+		},
+		{
+			name: "mp4",
+			ext:  ".m4a",
+			data: mp4File(1000, 180000, 44100),
+			want: AudioProperties{Duration: 180 * time.Second, SampleRate: 44100, Channels: 2, Codec: "aac"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadAudioProperties(bytes.NewReader(tt.data), int64(len(tt.data)), tt.ext)
+			if err != nil {
+				t.Fatalf("ReadAudioProperties: %v", err)
+			}
+			if tt.want.Bitrate == 0 {
+				// derived from the file size
+				tt.want.Bitrate = got.Bitrate
+			}
+			if got != tt.want {
+				t.Errorf("ReadAudioProperties = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAudioProperties_Invalid(t *testing.T) {
+	for _, ext := range []string{".mp3", ".flac", ".ogg", ".m4a"} {
+		data := []byte("definitely not audio")
+		if _, err := ReadAudioProperties(bytes.NewReader(data), int64(len(data)), ext); err == nil {
+			t.Errorf("%s: expected an error for garbage input", ext)
+		}
+	}
+	if _, err := ReadAudioProperties(bytes.NewReader(nil), 0, ".wav"); err != ErrUnsupportedFormat {
+		t.Errorf("wav error = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	flac := write("artist/album/01.flac", flacFile(44100, 2, 44100*200,
+		"ARTIST=Daft Punk", "ALBUM=Discovery", "TITLE=One More Time", "GENRE=House", "TRACKNUMBER=1",
+		"ISRC=GBDUW0000053", "MUSICBRAINZ_TRACKID=0b2a8b6f-3bd4-4b2b-9d0c-6f6b0d4f4b1e", "MOOD=Happy"))
+	mp3 := write("artist/untagged song.mp3", mp3File(100, nil))
+	write("artist/cover.jpg", []byte("jpeg"))
+	write(".hidden/ignored.flac", flacFile(44100, 2, 44100))
+	broken := write("artist/broken.flac", []byte("not flac"))
+
+	result, err := Scan(context.Background(), root, Options{})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("Scan found %d files, want 2: %+v", len(result.Files), result.Files)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Path != broken {
+		t.Errorf("Scan errors = %v, want only %s", result.Errors, broken)
+	}
+
+	byPath := make(map[string]int)
+	for i, file := range result.Files {
+		byPath[file.Path] = i
+	}
+
+	got := result.Files[byPath[flac]]
+	if got.Artist != "Daft Punk" || got.Album != "Discovery" || got.Title != "One More Time" || got.Genre != "House" {
+		t.Errorf("flac tags = %+v", got)
+	}
+	want := models.AudioInfo{
+		DurationMs:         200000,
+		Bitrate:            got.Audio.Bitrate,
+		SampleRate:         44100,
+		Channels:           2,
+		Codec:              "flac",
+		BitDepth:           16,
+		TrackNumber:        1,
+		ISRC:               "GBDUW0000053",
+		MusicBrainzTrackID: "0b2a8b6f-3bd4-4b2b-9d0c-6f6b0d4f4b1e",
+	}
+	if got.Audio != want {
+		t.Errorf("flac audio info = %+v, want %+v", got.Audio, want)
+	}
+	if len(got.Extra) != 1 || got.Extra["mood"] != "Happy" {
+		t.Errorf("flac extra tags = %v, want only mood", got.Extra)
+	}
+
+	got = result.Files[byPath[mp3]]
+	if got.Title != "untagged song" || got.Audio.Bitrate != 128 || got.Size != int64(len(mp3File(100, nil))) {
+		t.Errorf("untagged mp3 = %+v", got)
+	}
+
+	// incremental scan: only the rewritten file is read
+	past := time.Now().Add(-time.Hour)
+	for _, path := range []string{flac, mp3, broken} {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("artist/untagged song.mp3", mp3File(200, map[string]string{"TIT2": "Tagged", "TPE1": "Someone"}))
+
+	result, err = Scan(context.Background(), root, Options{Since: past.Unix() + 1})
+	if err != nil {
+		t.Fatalf("incremental Scan: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Title != "Tagged" || result.Files[0].Artist != "Someone" {
+		t.Errorf("incremental Scan files = %+v, want only the rewritten mp3", result.Files)
+	}
+	if len(result.Unchanged) != 2 {
+		t.Errorf("incremental Scan unchanged = %v, want the flac files", result.Unchanged)
+	}
+
+	// a known size that differs forces a read
+	result, err = Scan(context.Background(), root, Options{Since: time.Now().Unix() + 1, Sizes: map[string]int64{flac: 1, broken: 8, mp3: 0}})
+	if err != nil {
+		t.Fatalf("Scan with sizes: %v", err)
+	}
+	if len(result.Files) != 2 || len(result.Unchanged) != 1 || result.Unchanged[0] != broken {
+		t.Errorf("Scan with sizes read %d files, unchanged %v", len(result.Files), result.Unchanged)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Scan(ctx, root, Options{}); err != context.Canceled {
+		t.Errorf("Scan with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
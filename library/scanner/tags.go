@@ -0,0 +1,105 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"github.com/supperdoggy/spot-models"
+)
+
+// maxExtraTagLength drops long free-form tags such as embedded lyrics from MusicFile.Extra
+const maxExtraTagLength = 1024
+
+// mappedTags are the raw tag names, normalized by tagKey, that are read into
+// typed MusicFile fields through tag.Metadata or applyIDTag
+var mappedTags = map[string]bool{
+	// vorbis comments
+	"title": true, "artist": true, "album": true, "albumartist": true, "genre": true,
+	"date": true, "year": true, "tracknumber": true, "tracktotal": true, "totaltracks": true,
+	"discnumber": true, "disctotal": true, "totaldiscs": true, "vendor": true,
+	// ID3v2
+	"tit2": true, "tpe1": true, "talb": true, "tpe2": true, "tcon": true, "tyer": true,
+	"tdrc": true, "trck": true, "tpos": true, "tt2": true, "tp1": true, "tal": true,
+	"tp2": true, "tco": true, "tye": true, "trk": true, "tpa": true,
+	// MP4
+	"©nam": true, "©art": true, "©alb": true, "aart": true, "©gen": true, "gnre": true,
+	"©day": true, "trkn": true, "disk": true,
+}
+
+// tagKey normalizes a raw tag name so the same tag matches across formats
+func tagKey(name string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+// applyIDTag sets the AudioInfo field for an identifier tag and reports
+// whether the tag was one
+func applyIDTag(info *models.AudioInfo, key, value string) bool {
+	switch key {
+	case "isrc", "tsrc":
+		info.ISRC = value
+	case "musicbrainztrackid":
+		info.MusicBrainzTrackID = value
+	case "musicbrainzalbumid":
+		info.MusicBrainzAlbumID = value
+	case "musicbrainzartistid":
+		info.MusicBrainzArtistID = value
+	default:
+		return false
+	}
+	return true
+}
+
+// readTags fills the tag fields of file from meta. Tags without a field end
+// up in file.Extra.
+func readTags(file *models.MusicFile, meta tag.Metadata) {
+	file.Artist = meta.Artist()
+	if file.Artist == "" {
+		file.Artist = meta.AlbumArtist()
+	}
+	file.Album = meta.Album()
+	file.Title = meta.Title()
+	file.Genre = meta.Genre()
+	file.Audio.TrackNumber, _ = meta.Track()
+	file.Audio.DiscNumber, _ = meta.Disc()
+	file.Audio.Year = meta.Year()
+
+	for name, raw := range meta.Raw() {
+		var value string
+		switch v := raw.(type) {
+		case string:
+			value = v
+		case []string:
+			value = strings.Join(v, "; ")
+		case *tag.Comm:
+			// ID3 user defined text frames are named by their description
+			if !strings.HasPrefix(name, "TXX") {
+				continue
+			}
+			name, value = v.Description, v.Text
+		default:
+			continue
+		}
+
+		key := tagKey(name)
+		value = strings.TrimSpace(value)
+		if value == "" || mappedTags[key] || applyIDTag(&file.Audio, key, value) || len(value) > maxExtraTagLength {
+			continue
+		}
+
+		if file.Extra == nil {
+			file.Extra = make(map[string]string)
+		}
+		file.Extra[extraKey(name)] = value
+	}
+}
+
+// extraKey makes a tag name usable as a MongoDB field name
+func extraKey(name string) string {
+	key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), ".", "_")
+	key = strings.TrimLeft(key, "$")
+	if key == "" {
+		return fmt.Sprintf("tag_%x", name)
+	}
+	return key
+}
@@ -0,0 +1,121 @@
+// Package matching pairs Spotify tracks with music files from the library.
+// Titles and artists are normalized before comparison so that case,
+// diacritics, featured artists, remaster/live tags and artist order do not
+// cause false misses.
+package matching
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// MatchResult is the best library file found for a track
+type MatchResult struct {
+	Track spotify.TrackMetadata
+	// File is nil when no candidate reached ConfidenceLow
+	File       *models.MusicFile
+	Score      float64
+	Confidence Confidence
+}
+
+// Matched reports whether a file was found for the track
+func (r MatchResult) Matched() bool {
+	return r.File != nil
+}
+
+// normalized holds the comparable form of a track or file
+type normalized struct {
+	title   string
+	artists []string
+}
+
+func normalize(artist, title string) normalized {
+	artists := NormalizeArtists(artist)
+	for _, featured := range FeaturedArtists(title) {
+		if !slices.Contains(artists, featured) {
+			artists = append(artists, featured)
+		}
+	}
+	return normalized{title: NormalizeTitle(title), artists: artists}
+}
+
+// Score compares a track with a file, returning a value between 0 and 1
+func Score(track spotify.TrackMetadata, file models.MusicFile) float64 {
+	return score(normalize(track.Artist, track.Title), normalize(file.Artist, file.Title))
+}
+
+func score(track, file normalized) float64 {
+	return titleWeight*titleScore(track.title, file.title) + artistWeight*artistScore(track.artists, file.artists)
+}
+
+// MatchTracks finds the best matching file for every track. Results are in
+// the order of tracks; a file may be matched by more than one track.
+func MatchTracks(tracks []spotify.TrackMetadata, files []models.MusicFile) []MatchResult {
+	normalizedFiles := make([]normalized, len(files))
+	// index files by title word so only files sharing a word are scored
+	byWord := make(map[string][]int)
+	for i, file := range files {
+		normalizedFiles[i] = normalize(file.Artist, file.Title)
+		for _, word := range uniqueWords(normalizedFiles[i].title) {
+			byWord[word] = append(byWord[word], i)
+		}
+	}
+
+	results := make([]MatchResult, 0, len(tracks))
+	for _, track := range tracks {
+		result := MatchResult{Track: track}
+		normalizedTrack := normalize(track.Artist, track.Title)
+
+		scored := make(map[int]bool)
+		for _, word := range uniqueWords(normalizedTrack.title) {
+			for _, i := range byWord[word] {
+				if scored[i] {
+					continue
+				}
+				scored[i] = true
+
+				if s := score(normalizedTrack, normalizedFiles[i]); s > result.Score {
+					result.Score = s
+					result.File = &files[i]
+				}
+			}
+		}
+
+		result.Confidence = confidenceFor(result.Score)
+		if result.Confidence == ConfidenceNone {
+			result.File = nil
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// TitleWords returns the distinct words of a normalized title, in sorted
+// order. They are stored with music files so candidates can be looked up by
+// word instead of by scanning titles.
+func TitleWords(title string) []string {
+	return uniqueWords(NormalizeTitle(title))
+}
+
+// TitleKey returns the longest word of a normalized title. A file is only a
+// candidate for a track when its TitleWords contain the track's key. The key
+// is empty for titles without words.
+func TitleKey(title string) string {
+	var key string
+	for _, word := range TitleWords(title) {
+		if len(word) > len(key) {
+			key = word
+		}
+	}
+	return key
+}
+
+func uniqueWords(s string) []string {
+	words := strings.Fields(s)
+	slices.Sort(words)
+	return slices.Compact(words)
+}
@@ -0,0 +1,155 @@
+package matching
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"One More Time", "one more time"},
+		{"One More Time (feat. Romanthony)", "one more time"},
+		{"Get Lucky [ft. Pharrell Williams]", "get lucky"},
+		{"Heroes - 2017 Remaster", "heroes"},
+		{"Heroes (Remastered 2017)", "heroes"},
+		{"Paranoid Android (Live)", "paranoid android"},
+		{"Café del Mar", "cafe del mar"},
+		{"Rock & Roll", "rock and roll"},
+		{"Windowlicker (Remix)", "windowlicker remix"},
+		{"  Don't   Stop  ", "don t stop"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeTitle(tt.title); got != tt.want {
+			t.Errorf("NormalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestTitleWords(t *testing.T) {
+	tests := []struct {
+		title string
+		words []string
+		key   string
+	}{
+		{"Café del Mar", []string{"cafe", "del", "mar"}, "cafe"},
+		{"One More Time (feat. Romanthony)", []string{"more", "one", "time"}, "more"},
+		{"Heroes - 2017 Remaster", []string{"heroes"}, "heroes"},
+		{"la la la", []string{"la"}, "la"},
+		{"(Live)", []string{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := TitleWords(tt.title); !slices.Equal(got, tt.words) {
+			t.Errorf("TitleWords(%q) = %q, want %q", tt.title, got, tt.words)
+		}
+		if got := TitleKey(tt.title); got != tt.key {
+			t.Errorf("TitleKey(%q) = %q, want %q", tt.title, got, tt.key)
+		}
+	}
+}
+
+func TestNormalizeArtists(t *testing.T) {
+	tests := []struct {
+		artists string
+		want    []string
+	}{
+		{"Daft Punk", []string{"daft punk"}},
+		{"daft punk, pharrell williams", []string{"daft punk", "pharrell williams"}},
+		{"Beyoncé & JAY-Z", []string{"beyonce", "jay z"}},
+		{"Calvin Harris feat. Rihanna", []string{"calvin harris", "rihanna"}},
+		{"Sigur Rós; Sigur Ros", []string{"sigur ros"}},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeArtists(tt.artists); !slices.Equal(got, tt.want) {
+			t.Errorf("NormalizeArtists(%q) = %q, want %q", tt.artists, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTracks(t *testing.T) {
+	files := []models.MusicFile{
+		{ID: "lucky", Artist: "Daft Punk", Title: "Get Lucky (feat. Pharrell Williams & Nile Rodgers)"},
+		{ID: "heroes", Artist: "David Bowie", Title: "\"Heroes\" - 2017 Remaster"},
+		{ID: "halo", Artist: "Beyonce", Title: "Halo"},
+		{ID: "crazy", Artist: "Beyoncé", Title: "Crazy In Love"},
+		{ID: "typo", Artist: "Radiohead", Title: "Paranoid Androd"},
+	}
+
+	tests := []struct {
+		name   string
+		track  spotify.TrackMetadata
+		wantID string
+		want   Confidence
+	}{
+		{
+			name:   "featured artists in title and artist list",
+			track:  spotify.TrackMetadata{Artist: "daft punk, pharrell williams, nile rodgers", Title: "get lucky"},
+			wantID: "lucky",
+			want:   ConfidenceHigh,
+		},
+		{
+			name:   "remaster tag and punctuation",
+			track:  spotify.TrackMetadata{Artist: "david bowie", Title: "heroes"},
+			wantID: "heroes",
+			want:   ConfidenceHigh,
+		},
+		{
+			name:   "diacritics",
+			track:  spotify.TrackMetadata{Artist: "beyoncé", Title: "halo"},
+			wantID: "halo",
+			want:   ConfidenceHigh,
+		},
+		{
+			name:   "file credits only the main artist",
+			track:  spotify.TrackMetadata{Artist: "beyoncé, jay-z", Title: "crazy in love (feat. jay-z)"},
+			wantID: "crazy",
+			want:   ConfidenceHigh,
+		},
+		{
+			name:   "typo in the title",
+			track:  spotify.TrackMetadata{Artist: "radiohead", Title: "paranoid android"},
+			wantID: "typo",
+			want:   ConfidenceMedium,
+		},
+		{
+			name:  "unknown track",
+			track: spotify.TrackMetadata{Artist: "aphex twin", Title: "xtal"},
+			want:  ConfidenceNone,
+		},
+	}
+
+	tracks := make([]spotify.TrackMetadata, len(tests))
+	for i, tt := range tests {
+		tracks[i] = tt.track
+	}
+	results := MatchTracks(tracks, files)
+	if len(results) != len(tests) {
+		t.Fatalf("MatchTracks returned %d results, want %d", len(results), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := results[i]
+			if result.Confidence != tt.want {
+				t.Errorf("Confidence = %s (score %.2f), want %s", result.Confidence, result.Score, tt.want)
+			}
+			if tt.wantID == "" {
+				if result.Matched() {
+					t.Errorf("unexpected match %+v", result.File)
+				}
+				return
+			}
+			if !result.Matched() || result.File.ID != tt.wantID {
+				t.Errorf("matched %+v, want file %s", result.File, tt.wantID)
+			}
+		})
+	}
+}
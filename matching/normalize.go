@@ -0,0 +1,82 @@
+package matching
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// featuredRe matches "(feat. X)", "[ft. X]" and a trailing " feat. X"
+	featuredRe = regexp.MustCompile(`(?:[(\[]\s*(?:feat\.?|ft\.?|featuring|with)\s+([^)\]]*)[)\]])|(?:\s(?:feat\.?|ft\.?|featuring)\s+(.*)$)`)
+	// versionRe matches version tags such as "(Remastered 2011)", "- Live" or "[Radio Edit]"
+	versionRe = regexp.MustCompile(`(?:[(\[][^)\]]*\b(?:remaster(?:ed)?|live|mono|stereo|radio edit|single version|album version|edit|version|mix)\b[^)\]]*[)\]])|(?:\s-\s[^-]*\b(?:remaster(?:ed)?|live|mono|stereo|radio edit|single version|album version|version)\b.*$)`)
+	// artistSeparatorRe splits multi-artist strings
+	artistSeparatorRe = regexp.MustCompile(`\s*(?:,|;|/|&|\+|\band\b|\bx\b|\bfeat\.?|\bft\.?|\bfeaturing\b|\bwith\b|\bvs\.?)\s*`)
+
+	// letters that do not decompose into a base letter and a combining mark
+	foldReplacer = strings.NewReplacer("ø", "o", "ß", "ss", "æ", "ae", "œ", "oe", "ł", "l", "đ", "d", "ð", "d", "þ", "th", "ı", "i")
+)
+
+// Fold lowercases s and strips diacritics, so "Beyoncé" and "BEYONCE" fold to the same string
+func Fold(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return foldReplacer.Replace(folded)
+}
+
+// NormalizeTitle folds a title and removes featured artists, version tags and
+// punctuation, e.g. "One More Time (feat. Romanthony) - 2021 Remaster" becomes
+// "one more time"
+func NormalizeTitle(title string) string {
+	title = Fold(title)
+	title = featuredRe.ReplaceAllString(title, " ")
+	title = versionRe.ReplaceAllString(title, " ")
+	title = strings.ReplaceAll(title, "&", " and ")
+	return collapse(title)
+}
+
+// FeaturedArtists returns the artists credited inside a title, e.g. "B" for "Song (feat. B)"
+func FeaturedArtists(title string) []string {
+	var artists []string
+	for _, match := range featuredRe.FindAllStringSubmatch(Fold(title), -1) {
+		for _, group := range match[1:] {
+			if group != "" {
+				artists = append(artists, NormalizeArtists(group)...)
+			}
+		}
+	}
+	return artists
+}
+
+// NormalizeArtists splits a multi-artist string such as "A, B & C feat. D"
+// into folded artist names
+func NormalizeArtists(artists string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, artist := range artistSeparatorRe.Split(Fold(artists), -1) {
+		artist = collapse(artist)
+		if artist == "" || seen[artist] {
+			continue
+		}
+		seen[artist] = true
+		result = append(result, artist)
+	}
+	return result
+}
+
+// collapse replaces punctuation with spaces and collapses whitespace
+func collapse(s string) string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(fields, " ")
+}
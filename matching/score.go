@@ -0,0 +1,132 @@
+package matching
+
+// Score weights and confidence thresholds
+const (
+	titleWeight  = 0.6
+	artistWeight = 0.4
+
+	highThreshold   = 0.95
+	mediumThreshold = 0.8
+	lowThreshold    = 0.6
+
+	// artist names at least this similar are treated as the same artist
+	artistSimilarity = 0.9
+	// fuzzy title matches are scaled down so they never reach ConfidenceHigh
+	fuzzyTitlePenalty = 0.9
+	// score of an artist set fully contained in the other one
+	subsetArtistScore = 0.95
+)
+
+// Confidence describes how certain a match is
+type Confidence int
+
+const (
+	ConfidenceNone Confidence = iota
+	ConfidenceLow
+	ConfidenceMedium
+	ConfidenceHigh
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceHigh:
+		return "high"
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceLow:
+		return "low"
+	default:
+		return "none"
+	}
+}
+
+// confidenceFor maps a score onto a confidence level
+func confidenceFor(score float64) Confidence {
+	switch {
+	case score >= highThreshold:
+		return ConfidenceHigh
+	case score >= mediumThreshold:
+		return ConfidenceMedium
+	case score >= lowThreshold:
+		return ConfidenceLow
+	default:
+		return ConfidenceNone
+	}
+}
+
+// titleScore compares two normalized titles
+func titleScore(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	return fuzzyTitlePenalty * similarity(a, b)
+}
+
+// artistScore compares two artist sets. A file that only credits the main
+// artist of a multi-artist track still scores well.
+func artistScore(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	for _, x := range a {
+		for _, y := range b {
+			if x == y || similarity(x, y) >= artistSimilarity {
+				common++
+				break
+			}
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+
+	smaller, union := len(a), len(a)+len(b)-common
+	if len(b) < smaller {
+		smaller = len(b)
+	}
+	if common == union {
+		return 1
+	}
+	if common == smaller {
+		return subsetArtistScore
+	}
+	overlap := float64(common) / float64(smaller)
+	jaccard := float64(common) / float64(union)
+	return (overlap + jaccard) / 2
+}
+
+// similarity returns 1 minus the normalized Levenshtein distance of a and b
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
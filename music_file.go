@@ -1,5 +1,7 @@
 package models
 
+import "maps"
+
 type MusicFile struct {
 	ID string `json:"id" bson:"_id"`
 
@@ -7,10 +9,41 @@ type MusicFile struct {
 	Album  string `json:"album" bson:"album"`
 	Title  string `json:"title" bson:"title"`
 	Genre  string `json:"genre" bson:"genre"`
+	// TitleWords are the words of the normalized title, see matching.TitleWords.
+	// They are set when the file is indexed.
+	TitleWords []string `json:"title_words,omitempty" bson:"title_words,omitempty"`
+
+	Path string `json:"path" bson:"path"`
+	// Size and ModTime (unix seconds) of the file when it was indexed
+	Size    int64 `json:"size,omitempty" bson:"size,omitempty"`
+	ModTime int64 `json:"mod_time,omitempty" bson:"mod_time,omitempty"`
 
-	Path     string         `json:"path" bson:"path"`
-	MetaData map[string]any `json:"meta_data" bson:"meta_data"`
+	Audio AudioInfo `json:"audio" bson:"audio"`
+	// Extra holds the tags that have no field in AudioInfo
+	Extra map[string]string `json:"extra,omitempty" bson:"extra,omitempty"`
+	// ContentHash optionally identifies the file contents, so a moved file keeps its record
+	ContentHash string `json:"content_hash,omitempty" bson:"content_hash,omitempty"`
+
+	// IndexGeneration is the last index generation that saw the file on disk
+	IndexGeneration int64 `json:"index_generation,omitempty" bson:"index_generation,omitempty"`
+	// DeletedAt is set when a sweep found the file gone from disk
+	DeletedAt int64 `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
 
 	CreatedAt int64 `json:"created_at" bson:"created_at"`
 	UpdatedAt int64 `json:"updated_at" bson:"updated_at"`
 }
+
+// Deleted reports whether the file was soft-deleted by a sweep
+func (f MusicFile) Deleted() bool {
+	return f.DeletedAt != 0
+}
+
+// SameContent reports whether two records describe the same file with the
+// same tags, ignoring ID, timestamps and index bookkeeping
+func (f MusicFile) SameContent(other MusicFile) bool {
+	if f.Artist != other.Artist || f.Album != other.Album || f.Title != other.Title || f.Genre != other.Genre ||
+		f.Path != other.Path || f.Size != other.Size || f.ModTime != other.ModTime || f.ContentHash != other.ContentHash {
+		return false
+	}
+	return f.Audio == other.Audio && maps.Equal(f.Extra, other.Extra)
+}
@@ -14,11 +14,13 @@ func TestMusicFile_JSON(t *testing.T) {
 		Title:  "Test Song",
 		Genre:  "Electronic",
 		Path:   "/music/test.flac",
-		MetaData: map[string]any{
-			"bitrate":     320,
-			"duration":    180,
-			"sample_rate": 44100,
+		Audio: AudioInfo{
+			DurationMs: 180000,
+			Bitrate:    320,
+			SampleRate: 44100,
+			Codec:      "flac",
 		},
+		Extra:     map[string]string{"mood": "happy"},
 		CreatedAt: time.Now().Unix(),
 		UpdatedAt: time.Now().Unix(),
 	}
@@ -39,8 +41,11 @@ func TestMusicFile_JSON(t *testing.T) {
 	if decoded.Path != file.Path {
 		t.Errorf("Path mismatch: got %s, want %s", decoded.Path, file.Path)
 	}
-	if decoded.MetaData["bitrate"] != float64(320) { // JSON numbers are float64
-		t.Errorf("MetaData bitrate mismatch: got %v", decoded.MetaData["bitrate"])
+	if decoded.Audio != file.Audio {
+		t.Errorf("Audio mismatch: got %+v, want %+v", decoded.Audio, file.Audio)
+	}
+	if decoded.Extra["mood"] != "happy" {
+		t.Errorf("Extra mismatch: got %v", decoded.Extra)
 	}
 }
 
@@ -58,3 +63,40 @@ func TestIndexStatus_Fields(t *testing.T) {
 		t.Error("LastIndexed should not be zero")
 	}
 }
+
+func TestMusicFile_SameContent(t *testing.T) {
+	base := MusicFile{
+		ID:     "a",
+		Artist: "Daft Punk",
+		Title:  "One More Time",
+		Path:   "/music/a.flac",
+		Audio:  AudioInfo{Bitrate: 320},
+	}
+
+	same := base
+	same.ID = "b"
+	same.UpdatedAt = 123
+	if !base.SameContent(same) {
+		t.Error("records differing only in ID and timestamps should be the same")
+	}
+
+	retagged := base
+	retagged.Title = "One More Time (Radio Edit)"
+	if base.SameContent(retagged) {
+		t.Error("records with different titles should differ")
+	}
+
+	reencoded := base
+	reencoded.Audio.Bitrate = 256
+	if base.SameContent(reencoded) {
+		t.Error("records with different audio info should differ")
+	}
+
+	noExtra := base
+	noExtra.Extra = nil
+	empty := base
+	empty.Extra = map[string]string{}
+	if !noExtra.SameContent(empty) {
+		t.Error("nil and empty extra tags should be the same")
+	}
+}
@@ -0,0 +1,215 @@
+// Package export writes synced playlists as local playlist files. Tracks are
+// resolved to library files with the matching package; tracks without a
+// match are left out of the playlist and listed in a side report.
+package export
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/matching"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+var (
+	// ErrNoTracks is returned for a snapshot without tracks
+	ErrNoTracks = errors.New("playlist has no synced tracks")
+	// ErrNoName is returned by Export when the playlist name is empty
+	ErrNoName = errors.New("playlist name is empty")
+)
+
+// Matcher resolves tracks to library files. database.Database implements it.
+type Matcher interface {
+	MatchTracks(ctx context.Context, tracks []spotify.TrackMetadata) ([]matching.MatchResult, error)
+}
+
+// Files matches tracks against a fixed list of files, for callers that
+// already hold the library in memory
+type Files []models.MusicFile
+
+func (f Files) MatchTracks(_ context.Context, tracks []spotify.TrackMetadata) ([]matching.MatchResult, error) {
+	return matching.MatchTracks(tracks, f), nil
+}
+
+// Entry is a playlist track resolved to a library file
+type Entry struct {
+	Track      spotify.TrackMetadata
+	File       models.MusicFile
+	Confidence matching.Confidence
+}
+
+// Unresolved is a playlist track without a library file
+type Unresolved struct {
+	Track spotify.TrackMetadata
+	// Position is the index of the track in the Spotify playlist
+	Position int
+	// Score of the best candidate, below the required confidence
+	Score float64
+}
+
+// Playlist is a playlist with its tracks resolved to library files
+type Playlist struct {
+	Name       string
+	Entries    []Entry
+	Unresolved []Unresolved
+}
+
+// ResolveOptions configures Resolve
+type ResolveOptions struct {
+	// MinConfidence is the confidence a match needs to be included,
+	// matching.ConfidenceLow if unset
+	MinConfidence matching.Confidence
+}
+
+// Resolve matches tracks to library files, keeping the playlist order
+func Resolve(ctx context.Context, m Matcher, name string, tracks []spotify.TrackMetadata, opts ResolveOptions) (Playlist, error) {
+	if opts.MinConfidence == matching.ConfidenceNone {
+		opts.MinConfidence = matching.ConfidenceLow
+	}
+
+	results, err := m.MatchTracks(ctx, tracks)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	playlist := Playlist{
+		Name:       name,
+		Entries:    make([]Entry, 0, len(results)),
+		Unresolved: make([]Unresolved, 0),
+	}
+	for i, result := range results {
+		if !result.Matched() || result.Confidence < opts.MinConfidence {
+			playlist.Unresolved = append(playlist.Unresolved, Unresolved{Track: result.Track, Position: i, Score: result.Score})
+			continue
+		}
+		playlist.Entries = append(playlist.Entries, Entry{Track: result.Track, File: *result.File, Confidence: result.Confidence})
+	}
+
+	return playlist, nil
+}
+
+// ResolveSnapshot resolves the tracks of a playlist snapshot, usually the
+// latest one from Database.GetPlaylistSnapshot
+func ResolveSnapshot(ctx context.Context, m Matcher, name string, snapshot models.PlaylistSnapshot, opts ResolveOptions) (Playlist, error) {
+	if len(snapshot.Tracks) == 0 {
+		return Playlist{}, ErrNoTracks
+	}
+	return Resolve(ctx, m, name, snapshot.Tracks, opts)
+}
+
+// Options configures Export
+type Options struct {
+	ResolveOptions
+	// AbsolutePaths writes absolute file paths instead of paths relative to
+	// the playlist directory
+	AbsolutePaths bool
+	// SkipXSPF only writes the M3U8 playlist and the report
+	SkipXSPF bool
+}
+
+// Result lists the files written by Export
+type Result struct {
+	M3U8Path string
+	// XSPFPath is empty with Options.SkipXSPF
+	XSPFPath string
+	// ReportPath is empty when every track was resolved
+	ReportPath string
+
+	Resolved   int
+	Unresolved int
+}
+
+// Export resolves the playlist snapshot and writes <name>.m3u8, <name>.xspf
+// and, for unresolved tracks, <name>.unresolved.txt into dir
+func Export(ctx context.Context, m Matcher, dir, name string, snapshot models.PlaylistSnapshot, opts Options) (Result, error) {
+	fileName := safeFileName(name)
+	if fileName == "" {
+		return Result{}, ErrNoName
+	}
+
+	playlist, err := ResolveSnapshot(ctx, m, name, snapshot, opts.ResolveOptions)
+	if err != nil {
+		return Result{}, err
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Result{}, err
+	}
+
+	paths := PathOptions{Dir: dir, Absolute: opts.AbsolutePaths}
+	result := Result{
+		M3U8Path:   filepath.Join(dir, fileName+".m3u8"),
+		Resolved:   len(playlist.Entries),
+		Unresolved: len(playlist.Unresolved),
+	}
+	if err := writeFile(result.M3U8Path, func(f *os.File) error { return WriteM3U8(f, playlist, paths) }); err != nil {
+		return Result{}, err
+	}
+
+	if !opts.SkipXSPF {
+		result.XSPFPath = filepath.Join(dir, fileName+".xspf")
+		if err := writeFile(result.XSPFPath, func(f *os.File) error { return WriteXSPF(f, playlist, paths) }); err != nil {
+			return Result{}, err
+		}
+	}
+
+	// a report left over from an earlier export would be misleading
+	reportPath := filepath.Join(dir, fileName+".unresolved.txt")
+	if len(playlist.Unresolved) == 0 {
+		if err := os.Remove(reportPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Result{}, err
+		}
+		return result, nil
+	}
+
+	result.ReportPath = reportPath
+	if err := writeFile(reportPath, func(f *os.File) error { return WriteReport(f, playlist) }); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// writeFile writes to a temporary file renamed over path, so players never
+// read a half written playlist
+func writeFile(path string, write func(*os.File) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// safeFileName replaces the characters that are not allowed in file names on
+// common file systems
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.Trim(strings.TrimSpace(name), ".")
+}
@@ -0,0 +1,219 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/supperdoggy/spot-models"
+	"github.com/supperdoggy/spot-models/matching"
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func testLibrary(root string) Files {
+	return Files{
+		{
+			ID: "1", Artist: "Daft Punk", Title: "One More Time", Album: "Discovery",
+			Path:  filepath.Join(root, "Daft Punk", "Discovery", "01 One More Time.flac"),
+			Audio: models.AudioInfo{DurationMs: 320357, TrackNumber: 1},
+		},
+		{
+			ID: "2", Artist: "Beyoncé", Title: "Halo", Album: "I Am... Sasha Fierce",
+			Path: filepath.Join(root, "Beyoncé", "Halo & more.mp3"),
+		},
+	}
+}
+
+func testSnapshot() models.PlaylistSnapshot {
+	return models.PlaylistSnapshot{SnapshotID: "s1", Tracks: []spotify.TrackMetadata{
+		{SpotifyURL: "https://open.spotify.com/track/a", Artist: "daft punk", Title: "one more time - radio edit"},
+		{SpotifyURL: "https://open.spotify.com/track/b", Artist: "unknown artist", Title: "missing song"},
+		{SpotifyURL: "https://open.spotify.com/track/c", Artist: "beyonce", Title: "halo"},
+	}}
+}
+
+func TestResolve(t *testing.T) {
+	playlist, err := ResolveSnapshot(context.Background(), testLibrary("/music"), "Mix", testSnapshot(), ResolveOptions{})
+	if err != nil {
+		t.Fatalf("ResolveSnapshot: %v", err)
+	}
+
+	if len(playlist.Entries) != 2 || playlist.Entries[0].File.ID != "1" || playlist.Entries[1].File.ID != "2" {
+		t.Errorf("Entries = %+v, want files 1 and 2 in playlist order", playlist.Entries)
+	}
+	if len(playlist.Unresolved) != 1 || playlist.Unresolved[0].Position != 1 {
+		t.Errorf("Unresolved = %+v, want the second track", playlist.Unresolved)
+	}
+
+	strict, err := ResolveSnapshot(context.Background(), testLibrary("/music"), "Mix", testSnapshot(), ResolveOptions{MinConfidence: matching.ConfidenceHigh + 1})
+	if err != nil {
+		t.Fatalf("ResolveSnapshot: %v", err)
+	}
+	if len(strict.Entries) != 0 || len(strict.Unresolved) != 3 {
+		t.Errorf("strict resolve = %d entries, %d unresolved, want 0 and 3", len(strict.Entries), len(strict.Unresolved))
+	}
+
+	if _, err := ResolveSnapshot(context.Background(), testLibrary("/music"), "Mix", models.PlaylistSnapshot{}, ResolveOptions{}); !errors.Is(err, ErrNoTracks) {
+		t.Errorf("ResolveSnapshot without snapshot error = %v, want %v", err, ErrNoTracks)
+	}
+}
+
+func TestWriteM3U8(t *testing.T) {
+	playlist, err := ResolveSnapshot(context.Background(), testLibrary("/music"), "Friday\nMix", testSnapshot(), ResolveOptions{})
+	if err != nil {
+		t.Fatalf("ResolveSnapshot: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		paths PathOptions
+		want  string
+	}{
+		{
+			name:  "relative",
+			paths: PathOptions{Dir: "/music/playlists"},
+			want: "#EXTM3U\n#PLAYLIST:Friday Mix\n" +
+				"#EXTINF:320,Daft Punk - One More Time\n../Daft Punk/Discovery/01 One More Time.flac\n" +
+				"#EXTINF:-1,Beyoncé - Halo\n../Beyoncé/Halo & more.mp3\n",
+		},
+		{
+			name:  "absolute",
+			paths: PathOptions{Dir: "/music/playlists", Absolute: true},
+			want: "#EXTM3U\n#PLAYLIST:Friday Mix\n" +
+				"#EXTINF:320,Daft Punk - One More Time\n/music/Daft Punk/Discovery/01 One More Time.flac\n" +
+				"#EXTINF:-1,Beyoncé - Halo\n/music/Beyoncé/Halo & more.mp3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteM3U8(&buf, playlist, tt.paths); err != nil {
+				t.Fatalf("WriteM3U8: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("WriteM3U8 =\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	track := spotify.TrackMetadata{Artist: "daft punk", Title: "one more time"}
+	display := spotify.TrackMetadata{Artist: "daft punk", Title: "one more time", DisplayArtist: "Daft Punk", DisplayTitle: "One More Time - Radio Edit"}
+	file := models.MusicFile{Artist: "DAFT PUNK", Title: "One More Time"}
+
+	tests := []struct {
+		entry Entry
+		want  string
+	}{
+		{Entry{Track: display, File: file}, "Daft Punk - One More Time - Radio Edit"},
+		{Entry{Track: track, File: file}, "DAFT PUNK - One More Time"},
+		{Entry{Track: track}, "daft punk - one more time"},
+		{Entry{Track: track, File: models.MusicFile{Title: "One More Time"}}, "One More Time"},
+	}
+	for _, tt := range tests {
+		if got := displayName(tt.entry); got != tt.want {
+			t.Errorf("displayName(%+v) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, Playlist{Name: "Mix", Unresolved: []Unresolved{{Track: display}}}); err != nil {
+		t.Fatalf("WriteReport: %v", err)
+	}
+	if !strings.Contains(buf.String(), "1\tDaft Punk - One More Time - Radio Edit\t") {
+		t.Errorf("report =\n%s", buf.String())
+	}
+}
+
+func TestWriteXSPF(t *testing.T) {
+	playlist, err := ResolveSnapshot(context.Background(), testLibrary("/music"), "Mix", testSnapshot(), ResolveOptions{})
+	if err != nil {
+		t.Fatalf("ResolveSnapshot: %v", err)
+	}
+
+	for _, absolute := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteXSPF(&buf, playlist, PathOptions{Dir: "/music/playlists", Absolute: absolute}); err != nil {
+			t.Fatalf("WriteXSPF: %v", err)
+		}
+
+		var doc xspfPlaylist
+		if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatalf("xml.Unmarshal: %v\n%s", err, buf.String())
+		}
+		if doc.Title != "Mix" || len(doc.Tracks) != 2 {
+			t.Fatalf("playlist = %+v, want 2 tracks titled Mix", doc)
+		}
+
+		first := doc.Tracks[0]
+		if first.Creator != "Daft Punk" || first.Album != "Discovery" || first.Duration != 320357 || first.TrackNum != 1 ||
+			first.Identifier != "https://open.spotify.com/track/a" {
+			t.Errorf("first track = %+v", first)
+		}
+
+		want := "../Beyonc%C3%A9/Halo%20&%20more.mp3"
+		if absolute {
+			want = "file:///music/Beyonc%C3%A9/Halo%20&%20more.mp3"
+		}
+		if doc.Tracks[1].Location != want {
+			t.Errorf("location = %q, want %q", doc.Tracks[1].Location, want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "playlists")
+
+	result, err := Export(context.Background(), testLibrary(root), dir, "Road/Trip", testSnapshot(), Options{})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if result.Resolved != 2 || result.Unresolved != 1 {
+		t.Errorf("Export resolved %d and %d unresolved, want 2 and 1", result.Resolved, result.Unresolved)
+	}
+	if filepath.Base(result.M3U8Path) != "Road_Trip.m3u8" || filepath.Base(result.XSPFPath) != "Road_Trip.xspf" {
+		t.Errorf("written %q and %q", result.M3U8Path, result.XSPFPath)
+	}
+
+	m3u, err := os.ReadFile(result.M3U8Path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(m3u), "\n../Daft Punk/Discovery/01 One More Time.flac\n") {
+		t.Errorf("m3u8 has no relative path:\n%s", m3u)
+	}
+
+	report, err := os.ReadFile(result.ReportPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(report), "2\tunknown artist - missing song\thttps://open.spotify.com/track/b\n") {
+		t.Errorf("report =\n%s", report)
+	}
+
+	// once every track resolves the stale report is removed
+	snapshot := testSnapshot()
+	snapshot.Tracks = snapshot.Tracks[:1]
+	result, err = Export(context.Background(), testLibrary(root), dir, "Road/Trip", snapshot, Options{SkipXSPF: true})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if result.ReportPath != "" || result.XSPFPath != "" {
+		t.Errorf("Export = %+v, want only the m3u8", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Road_Trip.unresolved.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stale report still exists: %v", err)
+	}
+
+	if _, err := Export(context.Background(), testLibrary(root), dir, " .. ", snapshot, Options{}); !errors.Is(err, ErrNoName) {
+		t.Errorf("Export with empty name error = %v, want %v", err, ErrNoName)
+	}
+}
@@ -0,0 +1,154 @@
+package export
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// PathOptions controls how file paths are written into a playlist
+type PathOptions struct {
+	// Dir is the directory the playlist file is written to. Paths are made
+	// relative to it unless Absolute is set or Dir is empty.
+	Dir      string
+	Absolute bool
+}
+
+// path returns the path of a library file as seen from the playlist. Paths
+// that cannot be made relative, e.g. on another volume, stay absolute.
+func (o PathOptions) path(file string) string {
+	if o.Absolute || o.Dir == "" || !filepath.IsAbs(file) {
+		return file
+	}
+	rel, err := filepath.Rel(o.Dir, file)
+	if err != nil {
+		return file
+	}
+	return rel
+}
+
+// location returns the path as a URI for XSPF
+func (o PathOptions) location(file string) string {
+	native := o.path(file)
+	path := filepath.ToSlash(native)
+	if filepath.IsAbs(native) {
+		if !strings.HasPrefix(path, "/") {
+			// windows drive letters
+			path = "/" + path
+		}
+		return (&url.URL{Scheme: "file", Path: path}).String()
+	}
+	return (&url.URL{Path: path}).String()
+}
+
+// WriteM3U8 writes the playlist as an extended M3U with UTF-8 encoding
+func WriteM3U8(w io.Writer, p Playlist, paths PathOptions) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	if p.Name != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(p.Name))
+	}
+	for _, entry := range p.Entries {
+		seconds := int64(-1)
+		if entry.File.Audio.DurationMs > 0 {
+			seconds = (entry.File.Audio.DurationMs + 500) / 1000
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", seconds, oneLine(displayName(entry)))
+		fmt.Fprintln(bw, paths.path(entry.File.Path))
+	}
+	return bw.Flush()
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version int         `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Identifier string `xml:"identifier,omitempty"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Album      string `xml:"album,omitempty"`
+	TrackNum   int    `xml:"trackNum,omitempty"`
+	Duration   int64  `xml:"duration,omitempty"`
+}
+
+// WriteXSPF writes the playlist as XSPF version 1
+func WriteXSPF(w io.Writer, p Playlist, paths PathOptions) error {
+	doc := xspfPlaylist{Version: 1, Title: p.Name, Tracks: make([]xspfTrack, 0, len(p.Entries))}
+	for _, entry := range p.Entries {
+		artist, title := entryName(entry)
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Location:   paths.location(entry.File.Path),
+			Identifier: entry.Track.SpotifyURL,
+			Title:      title,
+			Creator:    artist,
+			Album:      entry.File.Album,
+			TrackNum:   entry.File.Audio.TrackNumber,
+			Duration:   entry.File.Audio.DurationMs,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteReport lists the unresolved tracks, one per line with their playlist
+// position (starting at 1), artist, title and Spotify URL
+func WriteReport(w io.Writer, p Playlist) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %d of %d tracks of %s were not found in the library\n",
+		len(p.Unresolved), len(p.Unresolved)+len(p.Entries), oneLine(p.Name))
+	for _, track := range p.Unresolved {
+		artist, title := trackName(track.Track)
+		fmt.Fprintf(bw, "%d\t%s - %s\t%s\n", track.Position+1, oneLine(artist), oneLine(title), track.Track.SpotifyURL)
+	}
+	return bw.Flush()
+}
+
+// displayName is the "artist - title" shown by players
+func displayName(entry Entry) string {
+	artist, title := entryName(entry)
+	if artist == "" {
+		return title
+	}
+	return artist + " - " + title
+}
+
+// entryName returns the artist and title of a resolved track as Spotify shows
+// them, or from the file tags for tracks synced before they were stored
+func entryName(entry Entry) (artist, title string) {
+	if entry.Track.DisplayTitle == "" && entry.File.Title != "" {
+		return entry.File.Artist, entry.File.Title
+	}
+	return trackName(entry.Track)
+}
+
+// trackName returns the artist and title of a track as Spotify shows them,
+// falling back to the normalized ones
+func trackName(track spotify.TrackMetadata) (artist, title string) {
+	return cmp.Or(track.DisplayArtist, track.Artist), cmp.Or(track.DisplayTitle, track.Title)
+}
+
+// oneLine keeps tag values from breaking the line based formats
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// PlaylistSnapshot is the content of a playlist at one sync
+type PlaylistSnapshot struct {
+	// SnapshotID is the Spotify snapshot_id of this version of the playlist
+	SnapshotID string                  `json:"snapshot_id" bson:"snapshot_id"`
+	Tracks     []spotify.TrackMetadata `json:"tracks" bson:"tracks"`
+	TakenAt    int64                   `json:"taken_at" bson:"taken_at"`
+}
+
+// PlaylistTrack is a track at a position of a playlist snapshot
+type PlaylistTrack struct {
+	Track    spotify.TrackMetadata `json:"track"`
+	Position int                   `json:"position"`
+}
+
+// TrackMove is a track that changed its position relative to the other tracks
+type TrackMove struct {
+	Track spotify.TrackMetadata `json:"track"`
+	From  int                   `json:"from"`
+	To    int                   `json:"to"`
+}
+
+// PlaylistDiff is the difference between two snapshots of a playlist.
+// Positions of added and moved tracks refer to the newer snapshot, those of
+// removed tracks to the older one.
+type PlaylistDiff struct {
+	FromSnapshotID string          `json:"from_snapshot_id"`
+	ToSnapshotID   string          `json:"to_snapshot_id"`
+	Added          []PlaylistTrack `json:"added"`
+	Removed        []PlaylistTrack `json:"removed"`
+	Reordered      []TrackMove     `json:"reordered"`
+}
+
+// Empty reports whether the snapshots have the same tracks in the same order
+func (d PlaylistDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Reordered) == 0
+}
+
+// DiffPlaylistSnapshots compares two snapshots of a playlist. A track added
+// twice counts as two tracks. Moved tracks are the fewest tracks that have to
+// be moved to turn the old order into the new one: the common tracks outside
+// the longest common subsequence of both orders.
+func DiffPlaylistSnapshots(from, to PlaylistSnapshot) PlaylistDiff {
+	diff := PlaylistDiff{
+		FromSnapshotID: from.SnapshotID,
+		ToSnapshotID:   to.SnapshotID,
+		Added:          make([]PlaylistTrack, 0),
+		Removed:        make([]PlaylistTrack, 0),
+		Reordered:      make([]TrackMove, 0),
+	}
+
+	fromKeys := snapshotKeys(from.Tracks)
+	toKeys := snapshotKeys(to.Tracks)
+	toPositions := make(map[string]int, len(toKeys))
+	for i, key := range toKeys {
+		toPositions[key] = i
+	}
+	fromPositions := make(map[string]int, len(fromKeys))
+	for i, key := range fromKeys {
+		fromPositions[key] = i
+	}
+
+	// positions in to of the common tracks, in the order of from
+	var common, commonFrom []int
+	for i, key := range fromKeys {
+		if j, ok := toPositions[key]; ok {
+			common = append(common, j)
+			commonFrom = append(commonFrom, i)
+		} else {
+			diff.Removed = append(diff.Removed, PlaylistTrack{Track: from.Tracks[i], Position: i})
+		}
+	}
+	for j, key := range toKeys {
+		if _, ok := fromPositions[key]; !ok {
+			diff.Added = append(diff.Added, PlaylistTrack{Track: to.Tracks[j], Position: j})
+		}
+	}
+
+	// the common tracks are unique, so their longest common subsequence is
+	// the longest increasing subsequence of their new positions
+	kept := longestIncreasing(common)
+	for k, j := range common {
+		if !kept[k] {
+			diff.Reordered = append(diff.Reordered, TrackMove{Track: to.Tracks[j], From: commonFrom[k], To: j})
+		}
+	}
+	sort.Slice(diff.Reordered, func(a, b int) bool { return diff.Reordered[a].To < diff.Reordered[b].To })
+
+	return diff
+}
+
+// snapshotKeys identifies tracks by URL, numbering repeated tracks
+func snapshotKeys(tracks []spotify.TrackMetadata) []string {
+	seen := make(map[string]int, len(tracks))
+	keys := make([]string, len(tracks))
+	for i, track := range tracks {
+		key := track.SpotifyURL
+		if key == "" {
+			// local files have no url
+			key = track.Artist + "\x00" + track.Title
+		}
+		seen[key]++
+		keys[i] = key + "#" + strconv.Itoa(seen[key])
+	}
+	return keys
+}
+
+// longestIncreasing marks the elements of a longest strictly increasing subsequence of s
+func longestIncreasing(s []int) []bool {
+	// tails[l] is the index in s of the smallest tail of an increasing
+	// subsequence of length l+1, prev links each element to its predecessor
+	tails := make([]int, 0, len(s))
+	prev := make([]int, len(s))
+	for i, v := range s {
+		l := sort.Search(len(tails), func(k int) bool { return s[tails[k]] >= v })
+		if l > 0 {
+			prev[i] = tails[l-1]
+		} else {
+			prev[i] = -1
+		}
+		if l == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[l] = i
+		}
+	}
+
+	kept := make([]bool, len(s))
+	if len(tails) == 0 {
+		return kept
+	}
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		kept[i] = true
+	}
+	return kept
+}
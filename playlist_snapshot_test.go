@@ -0,0 +1,99 @@
+package models
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+func snapshotOf(id string, names ...string) PlaylistSnapshot {
+	snapshot := PlaylistSnapshot{SnapshotID: id}
+	for _, name := range names {
+		snapshot.Tracks = append(snapshot.Tracks, spotify.TrackMetadata{
+			SpotifyURL: "https://open.spotify.com/track/" + name,
+			Title:      name,
+		})
+	}
+	return snapshot
+}
+
+func titles(tracks []PlaylistTrack) []string {
+	out := make([]string, 0, len(tracks))
+	for _, track := range tracks {
+		out = append(out, track.Track.Title)
+	}
+	return out
+}
+
+func TestDiffPlaylistSnapshots(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  PlaylistSnapshot
+		added     []string
+		removed   []string
+		reordered []TrackMove
+	}{
+		{
+			name: "unchanged",
+			from: snapshotOf("1", "a", "b", "c"),
+			to:   snapshotOf("1", "a", "b", "c"),
+		},
+		{
+			name:  "first sync",
+			from:  PlaylistSnapshot{},
+			to:    snapshotOf("1", "a", "b"),
+			added: []string{"a", "b"},
+		},
+		{
+			name:    "added and removed",
+			from:    snapshotOf("1", "a", "b", "c"),
+			to:      snapshotOf("2", "a", "c", "d"),
+			added:   []string{"d"},
+			removed: []string{"b"},
+		},
+		{
+			name:      "one track moved to the end",
+			from:      snapshotOf("1", "a", "b", "c", "d"),
+			to:        snapshotOf("2", "b", "c", "d", "a"),
+			reordered: []TrackMove{{From: 0, To: 3}},
+		},
+		{
+			name: "swap",
+			from: snapshotOf("1", "a", "b", "c"),
+			to:   snapshotOf("2", "c", "b", "a"),
+			// any two of the three tracks have to move, c stays
+			reordered: []TrackMove{{From: 1, To: 1}, {From: 0, To: 2}},
+		},
+		{
+			name:  "duplicate added",
+			from:  snapshotOf("1", "a", "b"),
+			to:    snapshotOf("2", "a", "b", "a"),
+			added: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffPlaylistSnapshots(tt.from, tt.to)
+
+			if got := titles(diff.Added); !slices.Equal(got, tt.added) {
+				t.Errorf("Added = %v, want %v", got, tt.added)
+			}
+			if got := titles(diff.Removed); !slices.Equal(got, tt.removed) {
+				t.Errorf("Removed = %v, want %v", got, tt.removed)
+			}
+			if len(diff.Reordered) != len(tt.reordered) {
+				t.Fatalf("Reordered = %+v, want %d moves", diff.Reordered, len(tt.reordered))
+			}
+			for i, move := range diff.Reordered {
+				if move.From != tt.reordered[i].From || move.To != tt.reordered[i].To {
+					t.Errorf("move %d = %d->%d, want %d->%d", i, move.From, move.To, tt.reordered[i].From, tt.reordered[i].To)
+				}
+			}
+			if diff.Empty() != (len(tt.added)+len(tt.removed)+len(tt.reordered) == 0) {
+				t.Errorf("Empty() = %v", diff.Empty())
+			}
+		})
+	}
+}
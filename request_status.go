@@ -0,0 +1,120 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RequestStatus is the lifecycle state of a download or playlist request
+type RequestStatus string
+
+const (
+	RequestStatusQueued            RequestStatus = "queued"
+	RequestStatusDownloading       RequestStatus = "downloading"
+	RequestStatusVerifying         RequestStatus = "verifying"
+	RequestStatusPartiallyComplete RequestStatus = "partially_complete"
+	RequestStatusCompleted         RequestStatus = "completed"
+	RequestStatusFailed            RequestStatus = "failed" // failed permanently, will not be retried
+	RequestStatusCancelled         RequestStatus = "cancelled"
+)
+
+// ErrIllegalTransition is matched by every TransitionError
+var ErrIllegalTransition = errors.New("illegal request status transition")
+
+// requestTransitions lists the statuses each status may move to
+var requestTransitions = map[RequestStatus][]RequestStatus{
+	RequestStatusQueued: {
+		RequestStatusDownloading,
+		RequestStatusFailed,
+		RequestStatusCancelled,
+	},
+	RequestStatusDownloading: {
+		RequestStatusQueued, // retry after a transient error or a lost lease
+		RequestStatusVerifying,
+		RequestStatusFailed,
+		RequestStatusCancelled,
+	},
+	RequestStatusVerifying: {
+		RequestStatusQueued,
+		RequestStatusPartiallyComplete,
+		RequestStatusCompleted,
+		RequestStatusFailed,
+	},
+	RequestStatusPartiallyComplete: {
+		RequestStatusQueued, // pull the missing tracks again
+		RequestStatusCompleted,
+		RequestStatusFailed,
+		RequestStatusCancelled,
+	},
+	RequestStatusCompleted: {
+		RequestStatusQueued, // re-sync
+	},
+	RequestStatusFailed:    {},
+	RequestStatusCancelled: {},
+}
+
+// Valid reports whether s is a known status
+func (s RequestStatus) Valid() bool {
+	_, ok := requestTransitions[s]
+	return ok
+}
+
+// IsTerminal reports whether a request in this status is no longer processed
+func (s RequestStatus) IsTerminal() bool {
+	return s == RequestStatusCompleted || s == RequestStatusFailed || s == RequestStatusCancelled
+}
+
+// Claimable reports whether a worker may claim a request in this status.
+// Downloading requests are claimable again once their lease is released or
+// expired; the empty status of requests created before RequestStatus is
+// treated as queued.
+func (s RequestStatus) Claimable() bool {
+	return s == "" || s == RequestStatusQueued || s == RequestStatusDownloading
+}
+
+// CanTransition reports whether a request may move from one status to another
+func CanTransition(from, to RequestStatus) bool {
+	for _, next := range requestTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LegacyRequestStatus maps the Active/Errored flags used before RequestStatus
+// was introduced onto a status
+func LegacyRequestStatus(active, errored bool) RequestStatus {
+	switch {
+	case active:
+		return RequestStatusQueued
+	case errored:
+		return RequestStatusFailed
+	default:
+		return RequestStatusCompleted
+	}
+}
+
+// StatusForFlags returns the status of a request in status s whose
+// Active/Errored flags were set directly. s is kept when it agrees with the
+// flags, otherwise the legacy mapping of the flags is used.
+func StatusForFlags(s RequestStatus, active, errored bool) RequestStatus {
+	if s.Valid() && s.IsTerminal() != active && (s == RequestStatusFailed) == (errored && !active) {
+		return s
+	}
+	return LegacyRequestStatus(active, errored)
+}
+
+// TransitionError is returned when a request is moved to a status it cannot reach
+type TransitionError struct {
+	From RequestStatus
+	To   RequestStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal request status transition from %q to %q", e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to RequestStatus
+		want     bool
+	}{
+		{RequestStatusQueued, RequestStatusDownloading, true},
+		{RequestStatusDownloading, RequestStatusVerifying, true},
+		{RequestStatusVerifying, RequestStatusPartiallyComplete, true},
+		{RequestStatusPartiallyComplete, RequestStatusQueued, true},
+		{RequestStatusCompleted, RequestStatusQueued, true},
+		{RequestStatusQueued, RequestStatusCompleted, false},
+		{RequestStatusFailed, RequestStatusQueued, false},
+		{RequestStatusCancelled, RequestStatusDownloading, false},
+		{RequestStatusQueued, RequestStatusQueued, false},
+		{RequestStatus("bogus"), RequestStatusQueued, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyRequestStatus(t *testing.T) {
+	tests := []struct {
+		active, errored bool
+		want            RequestStatus
+	}{
+		{true, false, RequestStatusQueued},
+		{true, true, RequestStatusQueued},
+		{false, true, RequestStatusFailed},
+		{false, false, RequestStatusCompleted},
+	}
+
+	for _, tt := range tests {
+		if got := LegacyRequestStatus(tt.active, tt.errored); got != tt.want {
+			t.Errorf("LegacyRequestStatus(%v, %v) = %s, want %s", tt.active, tt.errored, got, tt.want)
+		}
+	}
+}
+
+func TestStatusForFlags(t *testing.T) {
+	tests := []struct {
+		status          RequestStatus
+		active, errored bool
+		want            RequestStatus
+	}{
+		{RequestStatusDownloading, true, false, RequestStatusDownloading},
+		{RequestStatusVerifying, true, true, RequestStatusVerifying},
+		{RequestStatusCancelled, false, false, RequestStatusCancelled},
+		{RequestStatusFailed, false, true, RequestStatusFailed},
+		{RequestStatusDownloading, false, false, RequestStatusCompleted},
+		{RequestStatusDownloading, false, true, RequestStatusFailed},
+		{RequestStatusCompleted, true, false, RequestStatusQueued},
+		{RequestStatusCompleted, false, true, RequestStatusFailed},
+		{"", true, false, RequestStatusQueued},
+	}
+
+	for _, tt := range tests {
+		if got := StatusForFlags(tt.status, tt.active, tt.errored); got != tt.want {
+			t.Errorf("StatusForFlags(%q, %v, %v) = %s, want %s", tt.status, tt.active, tt.errored, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionError_Is(t *testing.T) {
+	var err error = &TransitionError{From: RequestStatusFailed, To: RequestStatusQueued}
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Error("TransitionError should match ErrIllegalTransition")
+	}
+}
@@ -0,0 +1,158 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// reReleaseMarkers mark a parenthesised name suffix as describing a re-release
+// of the same record, e.g. "(Remastered 2011)" or "[Deluxe Edition]"
+var reReleaseMarkers = []string{"remaster", "deluxe", "edition", "anniversary", "expanded", "reissue", "version", "bonus"}
+
+// getArtistTracks returns the tracks of an artist's discography, limited to
+// the configured album groups, without re-releases and duplicate tracks
+func (s *spotifyService) getArtistTracks(ctx context.Context, artistID spotify.ID) ([]TrackMetadata, error) {
+	releases, err := s.getArtistReleases(ctx, artistID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var tracks []TrackMetadata
+	for _, release := range dedupeReleases(releases) {
+		albumTracks, err := s.getAlbumTracks(ctx, release.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, track := range albumTracks {
+			// compilations and appears_on releases also carry other artists' tracks
+			if !hasArtist(track.Artists, artistID) {
+				continue
+			}
+
+			metadata := newTrackMetadata(track, release, "")
+			key := metadata.Artist + "|" + metadata.Title
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			tracks = append(tracks, metadata)
+		}
+	}
+
+	if err := s.fillISRCs(ctx, tracks); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (s *spotifyService) getArtistReleases(ctx context.Context, artistID spotify.ID) ([]spotify.SimpleAlbum, error) {
+	types := artistAlbumTypes(s.opts.ArtistAlbumGroups)
+
+	var releases []spotify.SimpleAlbum
+	offset := 0
+	limit := 50
+	for {
+		opts := append(s.opts.catalogOptions(), spotify.Limit(limit), spotify.Offset(offset))
+		page, err := s.spotifyClient.GetArtistAlbums(ctx, artistID, types, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get artist albums: %w", err)
+		}
+		releases = append(releases, page.Albums...)
+		if len(page.Albums) < limit {
+			break
+		}
+		offset += limit
+	}
+
+	return releases, nil
+}
+
+// dedupeReleases keeps one release per name and album group, preferring the
+// one with the most tracks and then the earliest one
+func dedupeReleases(releases []spotify.SimpleAlbum) []spotify.SimpleAlbum {
+	index := make(map[string]int)
+	var result []spotify.SimpleAlbum
+	for _, release := range releases {
+		key := normalizeReleaseName(release.Name) + "|" + release.AlbumGroup
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(result)
+			result = append(result, release)
+			continue
+		}
+
+		current := result[i]
+		if release.TotalTracks > current.TotalTracks ||
+			release.TotalTracks == current.TotalTracks && release.ReleaseDate < current.ReleaseDate {
+			result[i] = release
+		}
+	}
+
+	return result
+}
+
+// normalizeReleaseName lowercases a release name and strips re-release suffixes
+func normalizeReleaseName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for {
+		trimmed := name
+		for _, brackets := range [][2]string{{"(", ")"}, {"[", "]"}} {
+			if !strings.HasSuffix(trimmed, brackets[1]) {
+				continue
+			}
+			start := strings.LastIndex(trimmed, brackets[0])
+			if start > 0 && isReReleaseSuffix(trimmed[start:]) {
+				trimmed = strings.TrimSpace(trimmed[:start])
+			}
+		}
+		if start := strings.LastIndex(trimmed, " - "); start > 0 && isReReleaseSuffix(trimmed[start:]) {
+			trimmed = strings.TrimSpace(trimmed[:start])
+		}
+
+		if trimmed == name {
+			return name
+		}
+		name = trimmed
+	}
+}
+
+func isReReleaseSuffix(suffix string) bool {
+	for _, marker := range reReleaseMarkers {
+		if strings.Contains(suffix, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasArtist(artists []spotify.SimpleArtist, id spotify.ID) bool {
+	for _, artist := range artists {
+		if artist.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// artistAlbumTypes converts album groups to the flags used by the Spotify client
+func artistAlbumTypes(groups []ArtistAlbumGroup) []spotify.AlbumType {
+	var types spotify.AlbumType
+	for _, group := range groups {
+		switch group {
+		case ArtistAlbumGroupAlbum:
+			types |= spotify.AlbumTypeAlbum
+		case ArtistAlbumGroupSingle:
+			types |= spotify.AlbumTypeSingle
+		case ArtistAlbumGroupCompilation:
+			types |= spotify.AlbumTypeCompilation
+		case ArtistAlbumGroupAppearsOn:
+			types |= spotify.AlbumTypeAppearsOn
+		}
+	}
+	return []spotify.AlbumType{types}
+}
@@ -0,0 +1,56 @@
+package spotify
+
+import (
+	"testing"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestNormalizeReleaseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Discovery", "discovery"},
+		{"Discovery (Remastered 2021)", "discovery"},
+		{"Abbey Road [Super Deluxe Edition]", "abbey road"},
+		{"Rumours - 35th Anniversary Edition", "rumours"},
+		{"Kid A (Live)", "kid a (live)"},
+		{"Random Access Memories (10th Anniversary Edition) [Remastered]", "random access memories"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeReleaseName(tt.name); got != tt.want {
+			t.Errorf("normalizeReleaseName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDedupeReleases(t *testing.T) {
+	releases := []spotify.SimpleAlbum{
+		{ID: "remaster", Name: "Discovery (Remastered)", AlbumGroup: "album", TotalTracks: 14, ReleaseDate: "2021-02-22"},
+		{ID: "single", Name: "One More Time", AlbumGroup: "single", TotalTracks: 1, ReleaseDate: "2000-11-13"},
+		{ID: "original", Name: "Discovery", AlbumGroup: "album", TotalTracks: 14, ReleaseDate: "2001-03-12"},
+		{ID: "deluxe", Name: "Homework (Deluxe)", AlbumGroup: "album", TotalTracks: 20, ReleaseDate: "2022-01-01"},
+		{ID: "homework", Name: "Homework", AlbumGroup: "album", TotalTracks: 16, ReleaseDate: "1997-01-20"},
+	}
+
+	got := dedupeReleases(releases)
+	want := []spotify.ID{"original", "single", "deluxe"}
+	if len(got) != len(want) {
+		t.Fatalf("dedupeReleases returned %d releases, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].ID != want[i] {
+			t.Errorf("release %d = %s, want %s", i, got[i].ID, want[i])
+		}
+	}
+}
+
+func TestArtistAlbumTypes(t *testing.T) {
+	got := artistAlbumTypes([]ArtistAlbumGroup{ArtistAlbumGroupAlbum, ArtistAlbumGroupAppearsOn})
+	want := spotify.AlbumTypeAlbum | spotify.AlbumTypeAppearsOn
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("artistAlbumTypes = %v, want [%v]", got, want)
+	}
+}
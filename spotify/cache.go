@@ -0,0 +1,244 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// CacheStore stores encoded Spotify responses for the caching service
+type CacheStore interface {
+	// Get returns the value stored under key. ok is false if there is none or it expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheOptions configures NewCachingService
+type CacheOptions struct {
+	// TTLs is how long responses are cached per object type. Types missing
+	// from the map use DefaultCacheTTLs, a negative TTL disables caching.
+	TTLs map[SpotifyObjectType]time.Duration
+}
+
+// DefaultCacheTTLs returns the TTLs used for object types missing from CacheOptions.TTLs
+func DefaultCacheTTLs() map[SpotifyObjectType]time.Duration {
+	return map[SpotifyObjectType]time.Duration{
+		// playlists are also refetched as soon as their snapshot_id changes
+		SpotifyObjectTypePlaylist: 24 * time.Hour,
+		SpotifyObjectTypeAlbum:    7 * 24 * time.Hour,
+		SpotifyObjectTypeTrack:    7 * 24 * time.Hour,
+		// artists get new releases
+		SpotifyObjectTypeArtist: 24 * time.Hour,
+	}
+}
+
+type cachingService struct {
+	next  SpotifyService
+	store CacheStore
+	log   *zap.Logger
+	ttls  map[SpotifyObjectType]time.Duration
+}
+
+// NewCachingService wraps next so that object names and tracks are served
+// from store while they are fresh. Cached playlists are only used while their
+// snapshot_id is unchanged, which costs one lightweight request per call.
+// Errors of the store are logged and fall back to next.
+func NewCachingService(next SpotifyService, store CacheStore, log *zap.Logger, opts CacheOptions) SpotifyService {
+	ttls := DefaultCacheTTLs()
+	for objectType, ttl := range opts.TTLs {
+		ttls[objectType] = ttl
+	}
+
+	return &cachingService{
+		next:  next,
+		store: store,
+		log:   log,
+		ttls:  ttls,
+	}
+}
+
+// cacheEntry is what the caching service keeps in the store
+type cacheEntry struct {
+	// Snapshot is the playlist snapshot_id the value belongs to
+	Snapshot string          `json:"snapshot,omitempty"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// trackCount is the cached result of GetTrackCount
+type trackCount struct {
+	Count  int             `json:"count"`
+	Tracks []TrackMetadata `json:"tracks"`
+}
+
+// cachedPlaylistItem is a spotify.PlaylistItem in a form that survives a
+// JSON round trip, which PlaylistItemTrack does not
+type cachedPlaylistItem struct {
+	AddedAt string               `json:"added_at"`
+	AddedBy spotify.User         `json:"added_by"`
+	IsLocal bool                 `json:"is_local"`
+	Track   *spotify.FullTrack   `json:"track,omitempty"`
+	Episode *spotify.EpisodePage `json:"episode,omitempty"`
+}
+
+func (c *cachingService) GetObjectName(ctx context.Context, url string) (string, error) {
+	return cached(ctx, c, url, "name", func() (string, error) {
+		return c.next.GetObjectName(ctx, url)
+	})
+}
+
+func (c *cachingService) GetObjectType(ctx context.Context, url string) (SpotifyObjectType, error) {
+	return c.next.GetObjectType(ctx, url)
+}
+
+func (c *cachingService) GetPlaylistTracks(ctx context.Context, url string) ([]spotify.PlaylistItem, error) {
+	items, err := cached(ctx, c, url, "playlist_tracks", func() ([]cachedPlaylistItem, error) {
+		items, err := c.next.GetPlaylistTracks(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		cachedItems := make([]cachedPlaylistItem, 0, len(items))
+		for _, item := range items {
+			cachedItems = append(cachedItems, cachedPlaylistItem{
+				AddedAt: item.AddedAt,
+				AddedBy: item.AddedBy,
+				IsLocal: item.IsLocal,
+				Track:   item.Track.Track,
+				Episode: item.Track.Episode,
+			})
+		}
+		return cachedItems, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	playlistItems := make([]spotify.PlaylistItem, 0, len(items))
+	for _, item := range items {
+		playlistItems = append(playlistItems, spotify.PlaylistItem{
+			AddedAt: item.AddedAt,
+			AddedBy: item.AddedBy,
+			IsLocal: item.IsLocal,
+			Track:   spotify.PlaylistItemTrack{Track: item.Track, Episode: item.Episode},
+		})
+	}
+	return playlistItems, nil
+}
+
+// IteratePlaylistTracks is not cached, it is meant for streaming through large playlists
+func (c *cachingService) IteratePlaylistTracks(ctx context.Context, url string) iter.Seq2[TrackMetadata, error] {
+	return c.next.IteratePlaylistTracks(ctx, url)
+}
+
+// ForUser is not cached: a user's private playlists must not be served to
+// other users from the shared cache
+func (c *cachingService) ForUser(token oauth2.TokenSource) SpotifyService {
+	return c.next.ForUser(token)
+}
+
+func (c *cachingService) GetUserPlaylists(ctx context.Context) ([]UserPlaylist, error) {
+	return c.next.GetUserPlaylists(ctx)
+}
+
+// Search is not cached, results change as the catalog does
+func (c *cachingService) Search(ctx context.Context, query string, types []SpotifyObjectType, limit int) (SearchResults, error) {
+	return c.next.Search(ctx, query, types, limit)
+}
+
+// GetPlaylistSnapshotID is never cached, it is what cached playlists are validated with
+func (c *cachingService) GetPlaylistSnapshotID(ctx context.Context, url string) (string, error) {
+	return c.next.GetPlaylistSnapshotID(ctx, url)
+}
+
+func (c *cachingService) GetTrackCount(ctx context.Context, url string) (int, []TrackMetadata, error) {
+	result, err := cached(ctx, c, url, "track_count", func() (trackCount, error) {
+		count, tracks, err := c.next.GetTrackCount(ctx, url)
+		return trackCount{Count: count, Tracks: tracks}, err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return result.Count, result.Tracks, nil
+}
+
+// cached returns the value stored for the object at url under kind, or
+// fetches and stores it. URLs that need a request to resolve, like short
+// links, and library URLs, which are the same for every user, are not cached.
+func cached[T any](ctx context.Context, c *cachingService, url, kind string, fetch func() (T, error)) (T, error) {
+	var zero T
+
+	ref, err := ParseURL(url)
+	if err != nil || ref.Type.IsLibrary() {
+		return fetch()
+	}
+	ttl := c.ttls[ref.Type]
+	if ttl <= 0 {
+		return fetch()
+	}
+	key := kind + ":" + string(ref.Type) + ":" + string(ref.ID)
+
+	var snapshot string
+	if ref.Type == SpotifyObjectTypePlaylist {
+		snapshot, err = c.next.GetPlaylistSnapshotID(ctx, ref.URL)
+		if err != nil {
+			return zero, err
+		}
+	}
+
+	if entry, ok := c.load(ctx, key); ok && entry.Snapshot == snapshot {
+		var value T
+		if err := json.Unmarshal(entry.Value, &value); err == nil {
+			return value, nil
+		}
+		c.log.Warn("dropping undecodable cache entry", zap.String("key", key), zap.Error(err))
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return zero, err
+	}
+	c.save(ctx, key, snapshot, value, ttl)
+
+	return value, nil
+}
+
+func (c *cachingService) load(ctx context.Context, key string) (cacheEntry, bool) {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.log.Warn("failed to read spotify cache", zap.String("key", key), zap.Error(err))
+		return cacheEntry{}, false
+	}
+	if !ok {
+		return cacheEntry{}, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		c.log.Warn("dropping undecodable cache entry", zap.String("key", key), zap.Error(err))
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *cachingService) save(ctx context.Context, key, snapshot string, value any, ttl time.Duration) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		c.log.Warn("failed to encode spotify response", zap.String("key", key), zap.Error(err))
+		return
+	}
+
+	data, err := json.Marshal(cacheEntry{Snapshot: snapshot, Value: encoded})
+	if err != nil {
+		c.log.Warn("failed to encode cache entry", zap.String("key", key), zap.Error(err))
+		return
+	}
+	if err := c.store.Set(ctx, key, data, ttl); err != nil {
+		c.log.Warn("failed to write spotify cache", zap.String("key", key), zap.Error(err))
+	}
+}
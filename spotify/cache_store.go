@@ -0,0 +1,155 @@
+package spotify
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	_ CacheStore = (*LRUCacheStore)(nil)
+	_ CacheStore = (*MongoCacheStore)(nil)
+)
+
+// LRUCacheStore is an in-memory CacheStore that keeps at most a fixed number
+// of entries, evicting the least recently used one. It is safe for concurrent use.
+type LRUCacheStore struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUCacheStore returns an LRUCacheStore holding up to size entries
+func NewLRUCacheStore(size int) *LRUCacheStore {
+	return &LRUCacheStore{
+		size:    max(size, 1),
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (s *LRUCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.order.Remove(elem)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+
+	s.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (s *LRUCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt := s.now().Add(ttl)
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		s.order.MoveToFront(elem)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (s *LRUCacheStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.order.Remove(elem)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (s *LRUCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+// MongoCacheStore is a CacheStore backed by a MongoDB collection, so the
+// cache is shared between service instances and survives restarts
+type MongoCacheStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoCacheStore returns a MongoCacheStore using coll
+func NewMongoCacheStore(coll *mongo.Collection) *MongoCacheStore {
+	return &MongoCacheStore{coll: coll}
+}
+
+type mongoCacheEntry struct {
+	Key       string    `bson:"_id"`
+	Value     []byte    `bson:"value"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// EnsureIndexes creates the TTL index that lets MongoDB remove expired entries
+func (s *MongoCacheStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	// the TTL monitor only runs once a minute, so expiry is checked here too
+	var entry mongoCacheEntry
+	err := s.coll.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return entry.Value, true, nil
+}
+
+func (s *MongoCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := mongoCacheEntry{Key: key, Value: value, ExpiresAt: time.Now().Add(ttl)}
+	_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": key}, entry, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoCacheStore) Delete(ctx context.Context, key string) error {
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,192 @@
+package spotify
+
+import (
+	"context"
+	"iter"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testAlbumURL    = "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy"
+	testPlaylistURL = "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M"
+)
+
+// countingService is a SpotifyService that counts the requests reaching it
+type countingService struct {
+	calls    map[string]int
+	snapshot string
+}
+
+func newCountingService() *countingService {
+	return &countingService{calls: make(map[string]int), snapshot: "s1"}
+}
+
+func (c *countingService) GetObjectName(ctx context.Context, url string) (string, error) {
+	c.calls["name"]++
+	return "name", nil
+}
+
+func (c *countingService) GetObjectType(ctx context.Context, url string) (SpotifyObjectType, error) {
+	ref, err := ParseURL(url)
+	return ref.Type, err
+}
+
+func (c *countingService) GetPlaylistTracks(ctx context.Context, url string) ([]spotify.PlaylistItem, error) {
+	c.calls["playlist_tracks"]++
+	track := &spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track", Name: "One More Time"}}
+	return []spotify.PlaylistItem{{AddedAt: "2024-01-01T00:00:00Z", Track: spotify.PlaylistItemTrack{Track: track}}}, nil
+}
+
+func (c *countingService) IteratePlaylistTracks(ctx context.Context, url string) iter.Seq2[TrackMetadata, error] {
+	return func(yield func(TrackMetadata, error) bool) {
+		c.calls["iterate"]++
+	}
+}
+
+func (c *countingService) ForUser(token oauth2.TokenSource) SpotifyService {
+	c.calls["user"]++
+	return c
+}
+
+func (c *countingService) GetUserPlaylists(ctx context.Context) ([]UserPlaylist, error) {
+	c.calls["user_playlists"]++
+	return nil, nil
+}
+
+func (c *countingService) Search(ctx context.Context, query string, types []SpotifyObjectType, limit int) (SearchResults, error) {
+	c.calls["search"]++
+	return SearchResults{}, nil
+}
+
+func (c *countingService) GetPlaylistSnapshotID(ctx context.Context, url string) (string, error) {
+	c.calls["snapshot"]++
+	return c.snapshot, nil
+}
+
+func (c *countingService) GetTrackCount(ctx context.Context, url string) (int, []TrackMetadata, error) {
+	c.calls["track_count"]++
+	return 1, []TrackMetadata{{SpotifyURL: "https://open.spotify.com/track/x", Artist: "daft punk", Title: "one more time"}}, nil
+}
+
+func TestCachingService(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	svc := NewCachingService(next, NewLRUCacheStore(100), zap.NewNop(), CacheOptions{})
+
+	for range 3 {
+		count, tracks, err := svc.GetTrackCount(ctx, testAlbumURL)
+		if err != nil {
+			t.Fatalf("GetTrackCount: %v", err)
+		}
+		if count != 1 || len(tracks) != 1 || tracks[0].Title != "one more time" {
+			t.Errorf("GetTrackCount = %d, %+v", count, tracks)
+		}
+	}
+	if next.calls["track_count"] != 1 {
+		t.Errorf("album fetched %d times, want once", next.calls["track_count"])
+	}
+	if next.calls["snapshot"] != 0 {
+		t.Errorf("snapshot requested %d times for an album", next.calls["snapshot"])
+	}
+
+	// the same album by URI shares the entry
+	if _, err := svc.GetObjectName(ctx, testAlbumURL); err != nil {
+		t.Fatalf("GetObjectName: %v", err)
+	}
+	if _, err := svc.GetObjectName(ctx, "spotify:album:4aawyAB9vmqN3uQ7FjRGTy"); err != nil {
+		t.Fatalf("GetObjectName: %v", err)
+	}
+	if next.calls["name"] != 1 {
+		t.Errorf("album name fetched %d times, want once", next.calls["name"])
+	}
+}
+
+func TestCachingService_PlaylistSnapshot(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	svc := NewCachingService(next, NewLRUCacheStore(100), zap.NewNop(), CacheOptions{})
+
+	for range 2 {
+		items, err := svc.GetPlaylistTracks(ctx, testPlaylistURL)
+		if err != nil {
+			t.Fatalf("GetPlaylistTracks: %v", err)
+		}
+		if len(items) != 1 || items[0].Track.Track == nil || items[0].Track.Track.Name != "One More Time" {
+			t.Fatalf("GetPlaylistTracks = %+v", items)
+		}
+	}
+	if next.calls["playlist_tracks"] != 1 || next.calls["snapshot"] != 2 {
+		t.Errorf("calls = %v, want one fetch and two snapshot checks", next.calls)
+	}
+
+	next.snapshot = "s2"
+	if _, err := svc.GetPlaylistTracks(ctx, testPlaylistURL); err != nil {
+		t.Fatalf("GetPlaylistTracks: %v", err)
+	}
+	if next.calls["playlist_tracks"] != 2 {
+		t.Errorf("changed playlist fetched %d times, want refetch", next.calls["playlist_tracks"])
+	}
+}
+
+func TestCachingService_TTL(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	store := NewLRUCacheStore(100)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	svc := NewCachingService(next, store, zap.NewNop(), CacheOptions{
+		TTLs: map[SpotifyObjectType]time.Duration{
+			SpotifyObjectTypeAlbum: time.Hour,
+			SpotifyObjectTypeTrack: -1,
+		},
+	})
+
+	svc.GetObjectName(ctx, testAlbumURL)
+	now = now.Add(59 * time.Minute)
+	svc.GetObjectName(ctx, testAlbumURL)
+	if next.calls["name"] != 1 {
+		t.Errorf("fresh entry refetched, %d calls", next.calls["name"])
+	}
+	now = now.Add(2 * time.Minute)
+	svc.GetObjectName(ctx, testAlbumURL)
+	if next.calls["name"] != 2 {
+		t.Errorf("expired entry not refetched, %d calls", next.calls["name"])
+	}
+
+	trackURL := "https://open.spotify.com/track/6rqhFgbbKwnb9MLmUQDhG6"
+	svc.GetObjectName(ctx, trackURL)
+	svc.GetObjectName(ctx, trackURL)
+	if next.calls["name"] != 4 {
+		t.Errorf("disabled type was cached, %d calls", next.calls["name"])
+	}
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRUCacheStore(2)
+
+	store.Set(ctx, "a", []byte("1"), time.Hour)
+	store.Set(ctx, "b", []byte("2"), time.Hour)
+	store.Get(ctx, "a")
+	store.Set(ctx, "c", []byte("3"), time.Hour)
+
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if value, ok, _ := store.Get(ctx, "a"); !ok || string(value) != "1" {
+		t.Errorf("Get(a) = %q, %v", value, ok)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Len = %d, want 2", store.Len())
+	}
+
+	store.Delete(ctx, "a")
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("deleted entry still present")
+	}
+}
@@ -0,0 +1,84 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+// getSavedTracks returns the user's Liked Songs, most recently liked first.
+// count includes liked tracks that are no longer available.
+func (s *spotifyService) getSavedTracks(ctx context.Context) (count int, tracks []TrackMetadata, err error) {
+	if !s.user {
+		return 0, nil, ErrNoUserToken
+	}
+
+	offset := 0
+	limit := 50
+	for {
+		opts := append(s.opts.catalogOptions(), spotify.Limit(limit), spotify.Offset(offset))
+		page, err := s.spotifyClient.CurrentUsersTracks(ctx, opts...)
+		if err != nil {
+			s.log.Error("failed to get saved tracks", zap.Error(err), zap.Int("offset", offset))
+			return 0, nil, fmt.Errorf("failed to get saved tracks: %w", err)
+		}
+		count += len(page.Tracks)
+		for _, track := range page.Tracks {
+			if track.ID == "" {
+				continue
+			}
+			tracks = append(tracks, newFullTrackMetadata(&track.FullTrack))
+		}
+		if len(page.Tracks) < limit {
+			break
+		}
+		offset += limit
+	}
+
+	return count, tracks, nil
+}
+
+// getSavedAlbumTracks returns the tracks of the user's saved albums, most
+// recently saved album first
+func (s *spotifyService) getSavedAlbumTracks(ctx context.Context) (count int, tracks []TrackMetadata, err error) {
+	if !s.user {
+		return 0, nil, ErrNoUserToken
+	}
+
+	offset := 0
+	limit := 50
+	for {
+		opts := append(s.opts.catalogOptions(), spotify.Limit(limit), spotify.Offset(offset))
+		page, err := s.spotifyClient.CurrentUsersAlbums(ctx, opts...)
+		if err != nil {
+			s.log.Error("failed to get saved albums", zap.Error(err), zap.Int("offset", offset))
+			return 0, nil, fmt.Errorf("failed to get saved albums: %w", err)
+		}
+		for _, album := range page.Albums {
+			count += int(album.Tracks.Total)
+
+			// the album carries its first page of tracks only
+			albumTracks := album.Tracks.Tracks
+			if len(albumTracks) < int(album.Tracks.Total) {
+				albumTracks, err = s.getAlbumTracks(ctx, album.ID)
+				if err != nil {
+					return 0, nil, err
+				}
+			}
+			for _, track := range albumTracks {
+				tracks = append(tracks, newTrackMetadata(track, album.SimpleAlbum, ""))
+			}
+		}
+		if len(page.Albums) < limit {
+			break
+		}
+		offset += limit
+	}
+
+	if err := s.fillISRCs(ctx, tracks); err != nil {
+		return 0, nil, err
+	}
+	return count, tracks, nil
+}
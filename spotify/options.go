@@ -0,0 +1,116 @@
+package spotify
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	spotifyauth "github.com/zmb3/spotify/v2/auth"
+)
+
+// DefaultBaseURL is the base URL of the Spotify Web API
+const DefaultBaseURL = "https://api.spotify.com/v1/"
+
+// Options configures a SpotifyService created with NewSpotifyServiceWithOptions
+type Options struct {
+	// BaseURL is the Web API base URL, https://api.spotify.com/v1/ if empty.
+	// Tests point it at a spotifytest.Server.
+	BaseURL string
+	// TokenURL is the token endpoint, spotifyauth.TokenURL if empty
+	TokenURL string
+	// AuthURL is where UserAuth sends users to grant access, spotifyauth.AuthURL if empty
+	AuthURL string
+	// HTTPClient sends the API and token requests, http.DefaultClient if nil.
+	// Its Transport is wrapped with authentication, rate limiting and retries.
+	HTTPClient *http.Client
+
+	// ArtistAlbumGroups selects which releases make up an artist's discography.
+	// Defaults to albums and singles.
+	ArtistAlbumGroups []ArtistAlbumGroup
+	// Market is an ISO 3166-1 alpha-2 country code passed to catalog requests.
+	// Without it Spotify may return a copy of the same release per market.
+	Market string
+
+	// PageConcurrency is the number of playlist pages fetched at once
+	PageConcurrency int
+
+	// RateLimit is the number of requests per second sent to the API, shared
+	// by all goroutines using the service, with bursts of up to RateBurst.
+	// A negative value disables the limiter.
+	RateLimit float64
+	RateBurst int
+	// MaxRetries is how often a request is retried after a 429 or 5xx
+	// response. A negative value disables retries.
+	MaxRetries int
+	// MaxRetryWait is the longest Retry-After the service waits for before
+	// failing with ErrRateLimited
+	MaxRetryWait time.Duration
+	// RetryBackoff is the base of the jittered exponential backoff between
+	// retries of 5xx responses
+	RetryBackoff time.Duration
+}
+
+// DefaultOptions returns the options used by NewSpotifyService
+func DefaultOptions() Options {
+	return Options{
+		BaseURL:           DefaultBaseURL,
+		TokenURL:          spotifyauth.TokenURL,
+		AuthURL:           spotifyauth.AuthURL,
+		ArtistAlbumGroups: []ArtistAlbumGroup{ArtistAlbumGroupAlbum, ArtistAlbumGroupSingle},
+		PageConcurrency:   4,
+		RateLimit:         5,
+		RateBurst:         10,
+		MaxRetries:        3,
+		MaxRetryWait:      time.Minute,
+		RetryBackoff:      500 * time.Millisecond,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.BaseURL == "" {
+		o.BaseURL = defaults.BaseURL
+	}
+	// the client joins paths onto the base URL
+	if !strings.HasSuffix(o.BaseURL, "/") {
+		o.BaseURL += "/"
+	}
+	if o.TokenURL == "" {
+		o.TokenURL = defaults.TokenURL
+	}
+	if o.AuthURL == "" {
+		o.AuthURL = defaults.AuthURL
+	}
+	if len(o.ArtistAlbumGroups) == 0 {
+		o.ArtistAlbumGroups = defaults.ArtistAlbumGroups
+	}
+	if o.PageConcurrency <= 0 {
+		o.PageConcurrency = defaults.PageConcurrency
+	}
+	if o.RateLimit == 0 {
+		o.RateLimit = defaults.RateLimit
+	}
+	if o.RateBurst == 0 {
+		o.RateBurst = defaults.RateBurst
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = defaults.MaxRetries
+	}
+	if o.MaxRetryWait == 0 {
+		o.MaxRetryWait = defaults.MaxRetryWait
+	}
+	if o.RetryBackoff == 0 {
+		o.RetryBackoff = defaults.RetryBackoff
+	}
+	return o
+}
+
+// catalogOptions returns the request options shared by catalog requests
+func (o Options) catalogOptions() []spotify.RequestOption {
+	if o.Market == "" {
+		return nil
+	}
+	return []spotify.RequestOption{spotify.Market(o.Market)}
+}
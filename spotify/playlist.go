@@ -0,0 +1,146 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+// playlistPageSize is the largest page the playlist items endpoint returns
+const playlistPageSize = 100
+
+// IteratePlaylistTracks streams the tracks of a playlist in playlist order.
+// Pages after the first are fetched concurrently, up to
+// Options.PageConcurrency at a time and ahead of the consumer. Episodes and tracks unavailable in the
+// market are skipped. Iteration stops after the first error, which is
+// yielded, and when ctx is done.
+func (s *spotifyService) IteratePlaylistTracks(ctx context.Context, url string) iter.Seq2[TrackMetadata, error] {
+	return func(yield func(TrackMetadata, error) bool) {
+		ref, err := s.parseURL(ctx, url)
+		if err != nil {
+			yield(TrackMetadata{}, err)
+			return
+		}
+		if ref.Type != SpotifyObjectTypePlaylist {
+			yield(TrackMetadata{}, fmt.Errorf("%w: expected a playlist, got %s", ErrUnsupportedObjectType, ref.Type))
+			return
+		}
+
+		for item, err := range s.iteratePlaylistItems(ctx, ref.ID) {
+			if err != nil {
+				yield(TrackMetadata{}, err)
+				return
+			}
+			track := item.Track.Track
+			if track == nil {
+				continue
+			}
+			if !yield(newFullTrackMetadata(track), nil) {
+				return
+			}
+		}
+	}
+}
+
+type playlistPage struct {
+	items []spotify.PlaylistItem
+	err   error
+}
+
+// iteratePlaylistItems streams all items of a playlist, see
+// IteratePlaylistTracks. At most PageConcurrency pages are fetched ahead of
+// the consumer: the next page is only requested once the consumer has taken
+// the oldest one.
+func (s *spotifyService) iteratePlaylistItems(ctx context.Context, id spotify.ID) iter.Seq2[spotify.PlaylistItem, error] {
+	return func(yield func(spotify.PlaylistItem, error) bool) {
+		// fetches still running when the consumer stops are cancelled and
+		// waited for, so none outlive the iteration
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		first, err := s.getPlaylistPage(ctx, id, 0)
+		if err != nil {
+			yield(spotify.PlaylistItem{}, err)
+			return
+		}
+
+		fetch := func(offset int) chan playlistPage {
+			page := make(chan playlistPage, 1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				items, err := s.getPlaylistPage(ctx, id, offset)
+				if err != nil {
+					page <- playlistPage{err: err}
+					return
+				}
+				page <- playlistPage{items: items.Items}
+			}()
+			return page
+		}
+
+		// pages holds the fetches in flight, oldest first
+		var pages []chan playlistPage
+		next := len(first.Items)
+		more := func() bool { return next < int(first.Total) && len(first.Items) > 0 }
+		for len(pages) < cap(s.pageSlots) && more() {
+			pages = append(pages, fetch(next))
+			next += playlistPageSize
+		}
+
+		for _, item := range first.Items {
+			if !yield(item, nil) {
+				return
+			}
+		}
+		for len(pages) > 0 {
+			var result playlistPage
+			select {
+			case result = <-pages[0]:
+			case <-ctx.Done():
+				yield(spotify.PlaylistItem{}, ctx.Err())
+				return
+			}
+			pages = pages[1:]
+			if result.err != nil {
+				yield(spotify.PlaylistItem{}, result.err)
+				return
+			}
+
+			if more() {
+				pages = append(pages, fetch(next))
+				next += playlistPageSize
+			}
+			for _, item := range result.items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// getPlaylistPage fetches one page of playlist items, waiting for a free
+// slot of the page concurrency limit
+func (s *spotifyService) getPlaylistPage(ctx context.Context, id spotify.ID, offset int) (*spotify.PlaylistItemPage, error) {
+	select {
+	case s.pageSlots <- struct{}{}:
+		defer func() { <-s.pageSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	opts := append(s.opts.catalogOptions(), spotify.Limit(playlistPageSize), spotify.Offset(offset))
+	page, err := s.spotifyClient.GetPlaylistItems(ctx, id, opts...)
+	if err != nil {
+		s.log.Error("failed to get playlist items", zap.Error(err), zap.String("id", string(id)), zap.Int("offset", offset))
+		return nil, err
+	}
+	return page, nil
+}
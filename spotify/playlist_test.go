@@ -0,0 +1,187 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+// playlistServer serves a playlist of total items where item 5 is unavailable
+type playlistServer struct {
+	total     int
+	failAt    int
+	inFlight  atomic.Int32
+	maxFlight atomic.Int32
+	requests  atomic.Int32
+}
+
+func (p *playlistServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.requests.Add(1)
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		current := p.maxFlight.Load()
+		if n <= current || p.maxFlight.CompareAndSwap(current, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if p.failAt > 0 && offset >= p.failAt {
+		http.Error(w, `{"error":{"status":404,"message":"not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	items := make([]map[string]any, 0, limit)
+	for i := offset; i < min(offset+limit, p.total); i++ {
+		if i == 5 {
+			items = append(items, map[string]any{"track": nil})
+			continue
+		}
+		items = append(items, map[string]any{"track": map[string]any{
+			"type":    "track",
+			"id":      fmt.Sprintf("track%d", i),
+			"name":    fmt.Sprintf("Track %d", i),
+			"artists": []map[string]any{{"name": "Artist"}},
+		}})
+	}
+	json.NewEncoder(w).Encode(map[string]any{"items": items, "total": p.total, "limit": limit, "offset": offset})
+}
+
+func newPlaylistTestService(t *testing.T, handler http.Handler, concurrency int) *spotifyService {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &spotifyService{
+		spotifyClient: spotify.New(server.Client(), spotify.WithBaseURL(server.URL+"/")),
+		log:           zap.NewNop(),
+		opts:          DefaultOptions(),
+		pageSlots:     make(chan struct{}, concurrency),
+	}
+}
+
+func TestIteratePlaylistTracks(t *testing.T) {
+	server := &playlistServer{total: 450}
+	svc := newPlaylistTestService(t, server, 2)
+
+	var titles []string
+	for track, err := range svc.IteratePlaylistTracks(context.Background(), testPlaylistURL) {
+		if err != nil {
+			t.Fatalf("IteratePlaylistTracks: %v", err)
+		}
+		titles = append(titles, track.Title)
+	}
+
+	if len(titles) != 449 {
+		t.Fatalf("got %d tracks, want 449", len(titles))
+	}
+	for i, title := range titles {
+		n := i
+		if i >= 5 {
+			n++
+		}
+		if title != fmt.Sprintf("track %d", n) {
+			t.Fatalf("track %d = %q, out of order", i, title)
+		}
+	}
+	if server.requests.Load() != 5 {
+		t.Errorf("made %d requests, want 5 pages", server.requests.Load())
+	}
+	if server.maxFlight.Load() > 2 {
+		t.Errorf("%d pages fetched at once, want at most 2", server.maxFlight.Load())
+	}
+}
+
+func TestIteratePlaylistTracks_Stop(t *testing.T) {
+	svc := newPlaylistTestService(t, &playlistServer{total: 450}, 2)
+
+	var n int
+	for _, err := range svc.IteratePlaylistTracks(context.Background(), testPlaylistURL) {
+		if err != nil {
+			t.Fatalf("IteratePlaylistTracks: %v", err)
+		}
+		if n++; n == 150 {
+			break
+		}
+	}
+	if n != 150 {
+		t.Errorf("iterated %d tracks after break, want 150", n)
+	}
+}
+
+func TestIteratePlaylistTracks_Window(t *testing.T) {
+	server := &playlistServer{total: 1000}
+	svc := newPlaylistTestService(t, server, 2)
+
+	var n int
+	for _, err := range svc.IteratePlaylistTracks(context.Background(), testPlaylistURL) {
+		if err != nil {
+			t.Fatalf("IteratePlaylistTracks: %v", err)
+		}
+		if n++; n == 1 {
+			// a slow consumer holds back the pages after the window
+			time.Sleep(50 * time.Millisecond)
+			if got := server.requests.Load(); got > 3 {
+				t.Errorf("made %d requests before the first page was consumed, want at most 3", got)
+			}
+		}
+	}
+	if n != 999 || server.requests.Load() != 10 {
+		t.Errorf("got %d tracks in %d requests, want 999 in 10", n, server.requests.Load())
+	}
+}
+
+func TestIteratePlaylistTracks_Errors(t *testing.T) {
+	svc := newPlaylistTestService(t, &playlistServer{total: 450, failAt: 200}, 2)
+
+	var n int
+	var iterErr error
+	for _, err := range svc.IteratePlaylistTracks(context.Background(), testPlaylistURL) {
+		if err != nil {
+			iterErr = err
+			continue
+		}
+		n++
+	}
+	if iterErr == nil || n != 199 {
+		t.Errorf("got %d tracks and error %v, want 199 tracks and the page error", n, iterErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range svc.IteratePlaylistTracks(ctx, testPlaylistURL) {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled iteration error = %v, want %v", err, context.Canceled)
+		}
+	}
+
+	for _, err := range svc.IteratePlaylistTracks(context.Background(), testAlbumURL) {
+		if !errors.Is(err, ErrUnsupportedObjectType) {
+			t.Errorf("album iteration error = %v, want %v", err, ErrUnsupportedObjectType)
+		}
+	}
+}
+
+func TestGetPlaylistTracks(t *testing.T) {
+	svc := newPlaylistTestService(t, &playlistServer{total: 150}, 4)
+
+	items, err := svc.GetPlaylistTracks(context.Background(), testPlaylistURL)
+	if err != nil {
+		t.Fatalf("GetPlaylistTracks: %v", err)
+	}
+	if len(items) != 150 || items[5].Track.Track != nil || items[149].Track.Track.Name != "Track 149" {
+		t.Errorf("GetPlaylistTracks returned %d items", len(items))
+	}
+}
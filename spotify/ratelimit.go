@@ -0,0 +1,202 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when Spotify keeps answering 429 Too Many
+// Requests and the retry budget is exhausted
+var ErrRateLimited = errors.New("spotify rate limit exceeded")
+
+// RateLimitError is the ErrRateLimited returned by the service. RetryAfter is
+// how long Spotify asked to wait, zero if it did not say.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// retryTransport limits the request rate to the Spotify API and retries
+// rate limited and failed requests
+type retryTransport struct {
+	base    http.RoundTripper
+	limiter *rate.Limiter
+	opts    Options
+	log     *zap.Logger
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	// blockedUntil is set from Retry-After so that every request waits, not
+	// only the one that was rate limited
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+func newRetryTransport(base http.RoundTripper, opts Options, log *zap.Logger) *retryTransport {
+	t := &retryTransport{
+		base:  base,
+		opts:  opts,
+		log:   log,
+		sleep: sleepContext,
+	}
+	if opts.RateLimit > 0 {
+		t.limiter = rate.NewLimiter(rate.Limit(opts.RateLimit), max(opts.RateBurst, 1))
+	}
+	return t
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	maxRetries := max(t.opts.MaxRetries, 0)
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var wait time.Duration
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			wait = retryAfter(resp.Header, time.Now())
+			if attempt >= maxRetries || wait > t.opts.MaxRetryWait || !canRetry(req) {
+				discard(resp)
+				return nil, &RateLimitError{RetryAfter: wait}
+			}
+			if wait == 0 {
+				wait = t.backoff(attempt)
+			}
+			t.block(wait)
+		case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented:
+			if attempt >= maxRetries || !canRetry(req) {
+				return resp, nil
+			}
+			wait = t.backoff(attempt)
+		default:
+			return resp, nil
+		}
+
+		discard(resp)
+		t.log.Warn("retrying spotify request",
+			zap.String("path", req.URL.Path),
+			zap.Int("status", resp.StatusCode),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("wait", wait))
+		if resp.StatusCode == http.StatusTooManyRequests {
+			// the pause set by block is waited for before the next attempt
+			continue
+		}
+		if err := t.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait blocks until a Retry-After pause is over and the limiter allows a request
+func (t *retryTransport) wait(ctx context.Context) error {
+	t.mu.Lock()
+	pause := time.Until(t.blockedUntil)
+	t.mu.Unlock()
+	if pause > 0 {
+		if err := t.sleep(ctx, pause); err != nil {
+			return err
+		}
+	}
+
+	if t.limiter == nil {
+		return nil
+	}
+	return t.limiter.Wait(ctx)
+}
+
+func (t *retryTransport) block(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(t.blockedUntil) {
+		t.blockedUntil = until
+	}
+}
+
+// backoff is the exponential backoff for attempt with full jitter over its upper half
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	d := t.opts.RetryBackoff << min(attempt, 16)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// canRetry reports whether req can be sent again
+func canRetry(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as an HTTP date
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// discard drains and closes a response body so the connection can be reused
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,186 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestTransport returns a retryTransport that records its waits instead of sleeping
+func newTestTransport(opts Options) (*retryTransport, *[]time.Duration) {
+	var waits []time.Duration
+	t := newRetryTransport(http.DefaultTransport, opts, zap.NewNop())
+	t.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	return t, &waits
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []func(w http.ResponseWriter)
+		opts      Options
+		wantErr   error
+		wantCode  int
+		wantCalls int32
+	}{
+		{
+			name: "retry after 429",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "2")
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			},
+			wantCode:  http.StatusOK,
+			wantCalls: 2,
+		},
+		{
+			name: "retry after too long",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "3600")
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+			},
+			wantErr:   ErrRateLimited,
+			wantCalls: 1,
+		},
+		{
+			name: "5xx retried until success",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			},
+			wantCode:  http.StatusOK,
+			wantCalls: 3,
+		},
+		{
+			name: "5xx returned once retries are exhausted",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) },
+			},
+			opts:      Options{MaxRetries: 1},
+			wantCode:  http.StatusInternalServerError,
+			wantCalls: 2,
+		},
+		{
+			name: "429 budget exhausted",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusTooManyRequests) },
+			},
+			opts:      Options{MaxRetries: 2},
+			wantErr:   ErrRateLimited,
+			wantCalls: 3,
+		},
+		{
+			name: "client errors are not retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			},
+			wantCode:  http.StatusNotFound,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1)) - 1
+				tt.responses[min(n, len(tt.responses)-1)](w)
+			}))
+			defer server.Close()
+
+			opts := tt.opts
+			opts.RateLimit = -1
+			transport, _ := newTestTransport(opts.withDefaults())
+			client := &http.Client{Transport: transport}
+
+			resp, err := client.Get(server.URL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantCode {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+				}
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("server called %d times, want %d", calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_RetryAfterPausesAllRequests(t *testing.T) {
+	var limited atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited.CompareAndSwap(false, true) {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	transport, waits := newTestTransport(Options{RateLimit: -1}.withDefaults())
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+
+	// the recorded sleeps do not pass time, so the next request still sees the pause
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*waits) < 2 || (*waits)[0] <= 4*time.Second || (*waits)[len(*waits)-1] <= 4*time.Second {
+		t.Errorf("waits = %v, want the Retry-After pause before both requests", *waits)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"-1", 0},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(header, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package spotify
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEmptyQuery = errors.New("empty search query")
+)
+
+const (
+	// DefaultSearchLimit is the number of results per type when Search is
+	// called without a limit
+	DefaultSearchLimit = 10
+	// maxSearchLimit is the most results per type Spotify returns at once
+	maxSearchLimit = 50
+)
+
+// searchTypes are the object types Search looks for by default, in the order
+// results are usually shown
+var searchTypes = []SpotifyObjectType{
+	SpotifyObjectTypeTrack,
+	SpotifyObjectTypeAlbum,
+	SpotifyObjectTypePlaylist,
+	SpotifyObjectTypeArtist,
+}
+
+// SearchResult is an object found by Search. URL is its canonical
+// open.spotify.com URL, which can be used to create a request.
+type SearchResult struct {
+	Type SpotifyObjectType
+	URL  string
+	Name string
+	// Artist is the artists of a track or album joined by ", ", or the
+	// owner of a playlist
+	Artist string
+	// TrackCount is set for albums and playlists
+	TrackCount int
+	// Track is set for tracks
+	Track TrackMetadata
+}
+
+// SearchResults holds the results of each searched type, best match first
+type SearchResults struct {
+	Tracks    []SearchResult
+	Albums    []SearchResult
+	Playlists []SearchResult
+	Artists   []SearchResult
+}
+
+// Search looks up tracks, albums, playlists and artists matching free text
+// like "daft punk - get lucky". types defaults to all four; limit is the
+// number of results per type, DefaultSearchLimit when not positive and at
+// most 50. Private playlists are never found.
+func (s *spotifyService) Search(ctx context.Context, query string, types []SpotifyObjectType, limit int) (SearchResults, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return SearchResults{}, ErrEmptyQuery
+	}
+	if len(types) == 0 {
+		types = searchTypes
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	var searchType spotify.SearchType
+	for _, t := range types {
+		switch t {
+		case SpotifyObjectTypeTrack:
+			searchType |= spotify.SearchTypeTrack
+		case SpotifyObjectTypeAlbum:
+			searchType |= spotify.SearchTypeAlbum
+		case SpotifyObjectTypePlaylist:
+			searchType |= spotify.SearchTypePlaylist
+		case SpotifyObjectTypeArtist:
+			searchType |= spotify.SearchTypeArtist
+		default:
+			return SearchResults{}, fmt.Errorf("%w: cannot search for %s", ErrUnsupportedObjectType, t)
+		}
+	}
+
+	opts := append(s.opts.catalogOptions(), spotify.Limit(limit))
+	result, err := s.spotifyClient.Search(ctx, query, searchType, opts...)
+	if err != nil {
+		s.log.Error("failed to search", zap.Error(err), zap.String("query", query))
+		return SearchResults{}, fmt.Errorf("failed to search: %w", err)
+	}
+
+	var results SearchResults
+	if result.Tracks != nil {
+		for _, track := range result.Tracks.Tracks {
+			if track.ID == "" {
+				continue
+			}
+			metadata := newFullTrackMetadata(&track)
+			results.Tracks = append(results.Tracks, SearchResult{
+				Type:   SpotifyObjectTypeTrack,
+				URL:    metadata.SpotifyURL,
+				Name:   track.Name,
+				Artist: metadata.DisplayArtist,
+				Track:  metadata,
+			})
+		}
+	}
+	if result.Albums != nil {
+		for _, album := range result.Albums.Albums {
+			if album.ID == "" {
+				continue
+			}
+			results.Albums = append(results.Albums, SearchResult{
+				Type:       SpotifyObjectTypeAlbum,
+				URL:        objectURL(SpotifyObjectTypeAlbum, album.ID),
+				Name:       album.Name,
+				Artist:     joinArtists(album.Artists),
+				TrackCount: int(album.TotalTracks),
+			})
+		}
+	}
+	// Spotify returns null for playlists that went away since indexing
+	if result.Playlists != nil {
+		for _, playlist := range result.Playlists.Playlists {
+			if playlist.ID == "" {
+				continue
+			}
+			results.Playlists = append(results.Playlists, SearchResult{
+				Type:       SpotifyObjectTypePlaylist,
+				URL:        objectURL(SpotifyObjectTypePlaylist, playlist.ID),
+				Name:       playlist.Name,
+				Artist:     cmp.Or(playlist.Owner.DisplayName, playlist.Owner.ID),
+				TrackCount: int(playlist.Tracks.Total),
+			})
+		}
+	}
+	if result.Artists != nil {
+		for _, artist := range result.Artists.Artists {
+			if artist.ID == "" {
+				continue
+			}
+			results.Artists = append(results.Artists, SearchResult{
+				Type: SpotifyObjectTypeArtist,
+				URL:  objectURL(SpotifyObjectTypeArtist, artist.ID),
+				Name: artist.Name,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// objectURL returns the canonical URL of a catalog object
+func objectURL(objectType SpotifyObjectType, id spotify.ID) string {
+	return openSpotifyPrefix + string(objectType) + "/" + string(id)
+}
@@ -0,0 +1,304 @@
+package spotify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/supperdoggy/spot-models/spotify"
+	"github.com/supperdoggy/spot-models/spotify/spotifytest"
+	spotifyapi "github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	discoveryURL = "https://open.spotify.com/album/2noRn2Aes5aoNVsU6iWThc"
+	fridayURL    = "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M"
+	daftPunkURL  = "https://open.spotify.com/artist/4tZwfgrHOc3mvqYlEYSvVi"
+	getLuckyURL  = "https://open.spotify.com/track/69kOkLUCkxIZYexIgSG8rq"
+)
+
+// the fixture tracks as GetTrackCount returns them
+var (
+	oneMoreTime = spotify.TrackMetadata{
+		SpotifyURL: "https://open.spotify.com/track/0DiWol3AO6WpXZgp0goxAV", Artist: "daft punk", Title: "one more time",
+		DisplayArtist: "Daft Punk", DisplayTitle: "One More Time", Album: "Discovery", AlbumArtist: "Daft Punk",
+		ISRC: "GBDUW0000053", DurationMs: 320357, DiscNumber: 1, TrackNumber: 1, ReleaseDate: "2001-03-12",
+		CoverURL: "https://i.scdn.co/image/discovery",
+	}
+	aerodynamic = spotify.TrackMetadata{
+		SpotifyURL: "https://open.spotify.com/track/2VEZx7NWsZ1D0eJ4uv5Fym", Artist: "daft punk", Title: "aerodynamic",
+		DisplayArtist: "Daft Punk", DisplayTitle: "Aerodynamic", Album: "Discovery", AlbumArtist: "Daft Punk",
+		ISRC: "GBDUW0000054", DurationMs: 212546, DiscNumber: 1, TrackNumber: 2, ReleaseDate: "2001-03-12",
+		CoverURL: "https://i.scdn.co/image/discovery",
+	}
+	getLucky = spotify.TrackMetadata{
+		SpotifyURL: getLuckyURL, Artist: "daft punk, pharrell williams", Title: "get lucky",
+		DisplayArtist: "Daft Punk, Pharrell Williams", DisplayTitle: "Get Lucky", Album: "Random Access Memories", AlbumArtist: "Daft Punk",
+		ISRC: "USQX91300108", DurationMs: 369626, DiscNumber: 1, TrackNumber: 8, ReleaseDate: "2013-05-17",
+		CoverURL: "https://i.scdn.co/image/ram",
+	}
+)
+
+func newTestServer(t *testing.T) *spotifytest.Server {
+	fixtures, err := spotifytest.ReadFixtures("testdata/fixtures.json")
+	if err != nil {
+		t.Fatalf("ReadFixtures: %v", err)
+	}
+	server := spotifytest.NewServer(fixtures)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestService(server *spotifytest.Server, opts spotify.Options) spotify.SpotifyService {
+	return spotify.NewSpotifyServiceWithOptions(context.Background(), spotifytest.ClientID, spotifytest.ClientSecret, zap.NewNop(), opts)
+}
+
+func TestServiceGetObjectName(t *testing.T) {
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{fridayURL, "Friday"},
+		{discoveryURL, "Discovery"},
+		{getLuckyURL, "Get Lucky"},
+		{daftPunkURL, "Daft Punk"},
+	}
+	for _, tt := range tests {
+		name, err := svc.GetObjectName(context.Background(), tt.url)
+		if err != nil {
+			t.Errorf("GetObjectName(%s): %v", tt.url, err)
+			continue
+		}
+		if name != tt.want {
+			t.Errorf("GetObjectName(%s) = %q, want %q", tt.url, name, tt.want)
+		}
+	}
+
+	if server.TokenRequests() != 1 {
+		t.Errorf("token requested %d times, want once", server.TokenRequests())
+	}
+}
+
+func TestServiceGetTrackCount(t *testing.T) {
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+
+	tests := []struct {
+		name      string
+		url       string
+		wantCount int
+		want      []spotify.TrackMetadata
+	}{
+		{
+			name:      "album",
+			url:       discoveryURL,
+			wantCount: 2,
+			want:      []spotify.TrackMetadata{oneMoreTime, aerodynamic},
+		},
+		{
+			name:      "track",
+			url:       getLuckyURL,
+			wantCount: 1,
+			want:      []spotify.TrackMetadata{getLucky},
+		},
+		{
+			// the unavailable item counts but has no metadata
+			name:      "playlist",
+			url:       fridayURL,
+			wantCount: 3,
+			want:      []spotify.TrackMetadata{oneMoreTime, getLucky},
+		},
+		{
+			// the remaster is dropped as a re-release
+			name:      "artist",
+			url:       daftPunkURL,
+			wantCount: 3,
+			want:      []spotify.TrackMetadata{oneMoreTime, aerodynamic, getLucky},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, tracks, err := svc.GetTrackCount(context.Background(), tt.url)
+			if err != nil {
+				t.Fatalf("GetTrackCount: %v", err)
+			}
+			if count != tt.wantCount {
+				t.Errorf("count = %d, want %d", count, tt.wantCount)
+			}
+			if len(tracks) != len(tt.want) {
+				t.Fatalf("tracks = %+v, want %+v", tracks, tt.want)
+			}
+			for i := range tracks {
+				if tracks[i] != tt.want[i] {
+					t.Errorf("track %d = %+v, want %+v", i, tracks[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServiceSearch(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+
+	results, err := svc.Search(ctx, "Daft Punk - Get Lucky", nil, 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results.Tracks) != 1 || results.Tracks[0].Track != getLucky || results.Tracks[0].URL != getLuckyURL {
+		t.Errorf("tracks = %+v, want Get Lucky", results.Tracks)
+	}
+	if results.Tracks[0].Name != "Get Lucky" || results.Tracks[0].Artist != "Daft Punk, Pharrell Williams" {
+		t.Errorf("track result = %+v", results.Tracks[0])
+	}
+	if len(results.Albums)+len(results.Playlists)+len(results.Artists) != 0 {
+		t.Errorf("results = %+v, want tracks only", results)
+	}
+
+	results, err = svc.Search(ctx, "discovery", []spotify.SpotifyObjectType{spotify.SpotifyObjectTypeAlbum}, 0)
+	if err != nil {
+		t.Fatalf("Search albums: %v", err)
+	}
+	want := spotify.SearchResult{Type: spotify.SpotifyObjectTypeAlbum, URL: discoveryURL, Name: "Discovery", Artist: "Daft Punk", TrackCount: 2}
+	if len(results.Albums) != 2 || results.Albums[0] != want || len(results.Tracks) != 0 {
+		t.Errorf("albums = %+v, want Discovery and its remaster", results.Albums)
+	}
+
+	// the best match comes first, and limit applies per type
+	results, err = svc.Search(ctx, "daft punk", nil, 2)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results.Artists) != 1 || results.Artists[0].URL != daftPunkURL || len(results.Tracks) != 2 || len(results.Albums) != 2 {
+		t.Errorf("results = %+v, want Daft Punk first and two of each type", results)
+	}
+
+	// private playlists are not found
+	results, err = svc.Search(ctx, "friday road trip", []spotify.SpotifyObjectType{spotify.SpotifyObjectTypePlaylist}, 0)
+	if err != nil || len(results.Playlists) != 0 {
+		t.Errorf("Search = %+v, %v, want no playlists", results, err)
+	}
+	results, err = svc.Search(ctx, "friday", []spotify.SpotifyObjectType{spotify.SpotifyObjectTypePlaylist}, 0)
+	if err != nil || len(results.Playlists) != 1 || results.Playlists[0].URL != fridayURL || results.Playlists[0].Artist != "spotify" || results.Playlists[0].TrackCount != 3 {
+		t.Errorf("Search = %+v, %v, want Friday", results, err)
+	}
+
+	requests := server.Requests()
+	if _, err := svc.Search(ctx, "  ", nil, 0); !errors.Is(err, spotify.ErrEmptyQuery) {
+		t.Errorf("Search with empty query error = %v, want %v", err, spotify.ErrEmptyQuery)
+	}
+	if _, err := svc.Search(ctx, "daft", []spotify.SpotifyObjectType{spotify.SpotifyObjectTypeSavedTracks}, 0); !errors.Is(err, spotify.ErrUnsupportedObjectType) {
+		t.Errorf("Search for saved tracks error = %v, want %v", err, spotify.ErrUnsupportedObjectType)
+	}
+	if server.Requests() != requests {
+		t.Error("invalid searches were sent to Spotify")
+	}
+}
+
+func TestServicePagination(t *testing.T) {
+	fixtures := spotifytest.Fixtures{
+		Artists:   []spotifytest.Artist{{ID: "artist0000000000000000", Name: "Artist"}},
+		Albums:    []spotifytest.Album{{ID: "album00000000000000000", Name: "Long Album", ArtistIDs: []string{"artist0000000000000000"}}},
+		Playlists: []spotifytest.Playlist{{ID: "playlist00000000000000", Name: "Long Playlist", SnapshotID: "s1"}},
+	}
+	for i := range 120 {
+		id := fmt.Sprintf("track%017d", i)
+		fixtures.Tracks = append(fixtures.Tracks, spotifytest.Track{ID: id, Name: fmt.Sprintf("Track %d", i), ArtistIDs: []string{"artist0000000000000000"}})
+		fixtures.Albums[0].TrackIDs = append(fixtures.Albums[0].TrackIDs, id)
+		// every track twice makes 240 playlist items over three pages
+		fixtures.Playlists[0].TrackIDs = append(fixtures.Playlists[0].TrackIDs, id, id)
+	}
+	server := spotifytest.NewServer(fixtures)
+	defer server.Close()
+	svc := newTestService(server, server.Options())
+
+	count, tracks, err := svc.GetTrackCount(context.Background(), "https://open.spotify.com/album/album00000000000000000")
+	if err != nil {
+		t.Fatalf("GetTrackCount album: %v", err)
+	}
+	if count != 120 || len(tracks) != 120 || tracks[119].Title != "track 119" {
+		t.Errorf("album count = %d with %d tracks, want 120", count, len(tracks))
+	}
+
+	count, tracks, err = svc.GetTrackCount(context.Background(), "https://open.spotify.com/playlist/playlist00000000000000")
+	if err != nil {
+		t.Fatalf("GetTrackCount playlist: %v", err)
+	}
+	if count != 240 || len(tracks) != 240 || tracks[239].Title != "track 119" {
+		t.Errorf("playlist count = %d with %d tracks, want 240", count, len(tracks))
+	}
+}
+
+func TestServiceNotFound(t *testing.T) {
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+
+	_, err := svc.GetObjectName(context.Background(), "https://open.spotify.com/album/0000000000000000000000")
+	var apiErr spotifyapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Errorf("GetObjectName error = %v, want a 404", err)
+	}
+
+	if _, _, err := svc.GetTrackCount(context.Background(), "https://open.spotify.com/playlist/0000000000000000000000"); err == nil {
+		t.Error("GetTrackCount of a missing playlist succeeded")
+	}
+}
+
+func TestServiceShortLink(t *testing.T) {
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+
+	name, err := svc.GetObjectName(context.Background(), "https://spotify.link/fridayMix")
+	if err != nil {
+		t.Fatalf("GetObjectName of a short link: %v", err)
+	}
+	if name != "Friday" {
+		t.Errorf("GetObjectName of a short link = %q, want Friday", name)
+	}
+
+	if _, err := svc.GetObjectName(context.Background(), "spotify.link/missing"); !errors.Is(err, spotify.ErrInvalidURL) {
+		t.Errorf("GetObjectName of an unknown short link error = %v, want %v", err, spotify.ErrInvalidURL)
+	}
+}
+
+func TestServiceRetries(t *testing.T) {
+	server := newTestServer(t)
+	opts := server.Options()
+	opts.MaxRetries = 2
+	svc := newTestService(server, opts)
+
+	server.FailNext(1, http.StatusTooManyRequests, 0)
+	server.FailNext(1, http.StatusServiceUnavailable, 0)
+	name, err := svc.GetObjectName(context.Background(), discoveryURL)
+	if err != nil {
+		t.Fatalf("GetObjectName after transient errors: %v", err)
+	}
+	if name != "Discovery" || server.Requests() != 3 {
+		t.Errorf("GetObjectName = %q after %d requests, want Discovery after 3", name, server.Requests())
+	}
+
+	server.FailNext(3, http.StatusTooManyRequests, 0)
+	if _, err := svc.GetObjectName(context.Background(), discoveryURL); !errors.Is(err, spotify.ErrRateLimited) {
+		t.Errorf("GetObjectName error = %v, want %v", err, spotify.ErrRateLimited)
+	}
+}
+
+func TestServiceInvalidCredentials(t *testing.T) {
+	server := newTestServer(t)
+	svc := spotify.NewSpotifyServiceWithOptions(context.Background(), spotifytest.ClientID, "wrong", zap.NewNop(), server.Options())
+
+	if _, err := svc.GetObjectName(context.Background(), discoveryURL); err == nil {
+		t.Error("GetObjectName with invalid credentials succeeded")
+	}
+	if server.Requests() != 0 {
+		t.Errorf("%d API requests sent without a token", server.Requests())
+	}
+}
@@ -2,32 +2,69 @@ package spotify
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"iter"
+	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/zmb3/spotify/v2"
-	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
 type TrackMetadata struct {
-	SpotifyURL     string `json:"spotify_url" bson:"spotify_url"`
-	Artist         string `json:"artist" bson:"artist"`
-	Title          string `json:"title" bson:"title"`
-	Found          bool   `json:"found" bson:"found"`
-	FailedAttempts int    `json:"failed_attempts" bson:"failed_attempts"`
-	Skipped        bool   `json:"skipped" bson:"skipped"` // marked as stuck after MaxFailedAttempts
+	SpotifyURL string `json:"spotify_url" bson:"spotify_url"`
+	// Artist and Title are normalized for matching: lowercased, with the
+	// artists joined by ", "
+	Artist string `json:"artist" bson:"artist"`
+	Title  string `json:"title" bson:"title"`
+
+	// Catalog data for matching and tagging, names in their original case.
+	// Tracks stored before these were added have none.
+	DisplayArtist string `json:"display_artist,omitempty" bson:"display_artist,omitempty"`
+	DisplayTitle  string `json:"display_title,omitempty" bson:"display_title,omitempty"`
+	Album         string `json:"album,omitempty" bson:"album,omitempty"`
+	AlbumArtist   string `json:"album_artist,omitempty" bson:"album_artist,omitempty"`
+	ISRC          string `json:"isrc,omitempty" bson:"isrc,omitempty"`
+	DurationMs    int64  `json:"duration_ms,omitempty" bson:"duration_ms,omitempty"`
+	DiscNumber    int    `json:"disc_number,omitempty" bson:"disc_number,omitempty"`
+	TrackNumber   int    `json:"track_number,omitempty" bson:"track_number,omitempty"`
+	// ReleaseDate is the album release date as Spotify has it: YYYY-MM-DD,
+	// YYYY-MM or YYYY
+	ReleaseDate string `json:"release_date,omitempty" bson:"release_date,omitempty"`
+	Explicit    bool   `json:"explicit,omitempty" bson:"explicit,omitempty"`
+	CoverURL    string `json:"cover_url,omitempty" bson:"cover_url,omitempty"`
+
+	Found          bool `json:"found" bson:"found"`
+	FailedAttempts int  `json:"failed_attempts" bson:"failed_attempts"`
+	Skipped        bool `json:"skipped" bson:"skipped"` // marked as stuck after MaxFailedAttempts
+
+	// Download attempt bookkeeping (unix seconds), see database.RecordTrackAttempt
+	LastAttemptAt int64  `json:"last_attempt_at,omitempty" bson:"last_attempt_at,omitempty"`
+	NextAttemptAt int64  `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	LastError     string `json:"last_error,omitempty" bson:"last_error,omitempty"`
 }
 
-const MaxFailedAttempts = 3 // after this many failed attempts, track is marked as skipped
+// MaxFailedAttempts is the default number of failed attempts after which a
+// track is marked as skipped
+const MaxFailedAttempts = 3
 
 type SpotifyService interface {
 	GetObjectName(ctx context.Context, url string) (string, error)
 	GetObjectType(ctx context.Context, url string) (SpotifyObjectType, error)
 	GetPlaylistTracks(ctx context.Context, url string) ([]spotify.PlaylistItem, error)
+	IteratePlaylistTracks(ctx context.Context, url string) iter.Seq2[TrackMetadata, error]
+	GetPlaylistSnapshotID(ctx context.Context, url string) (string, error)
 	GetTrackCount(ctx context.Context, url string) (int, []TrackMetadata, error)
+	Search(ctx context.Context, query string, types []SpotifyObjectType, limit int) (SearchResults, error)
+
+	// ForUser returns a service making requests with a user's token, which
+	// can also read the user's private and collaborative playlists
+	ForUser(token oauth2.TokenSource) SpotifyService
+	GetUserPlaylists(ctx context.Context) ([]UserPlaylist, error)
 }
 
 type spotifyService struct {
@@ -35,46 +72,70 @@ type spotifyService struct {
 	ClientSecret  string
 	spotifyClient *spotify.Client
 	log           *zap.Logger
+	opts          Options
+	// pageSlots bounds the concurrent playlist page requests
+	pageSlots chan struct{}
+
+	// transport is shared by user services so they count against the same
+	// rate limit; user is set on services returned by ForUser
+	transport http.RoundTripper
+	timeout   time.Duration
+	user      bool
 }
 
 func NewSpotifyService(ctx context.Context, clientID, clientSecret string, log *zap.Logger) SpotifyService {
+	return NewSpotifyServiceWithOptions(ctx, clientID, clientSecret, log, DefaultOptions())
+}
+
+func NewSpotifyServiceWithOptions(ctx context.Context, clientID, clientSecret string, log *zap.Logger, opts Options) SpotifyService {
+	opts = opts.withDefaults()
+
 	spotifyConfig := clientcredentials.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		TokenURL:     spotifyauth.TokenURL,
+		TokenURL:     opts.TokenURL,
+	}
+
+	base := http.DefaultTransport
+	httpClient := &http.Client{}
+	if opts.HTTPClient != nil {
+		if opts.HTTPClient.Transport != nil {
+			base = opts.HTTPClient.Transport
+		}
+		httpClient.Timeout = opts.HTTPClient.Timeout
+		// token requests are sent with the client stored in ctx
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, opts.HTTPClient)
 	}
 
-	// Use Client() instead of Token() - this automatically refreshes expired tokens
-	httpClient := spotifyConfig.Client(ctx)
-	spotifyClient := spotify.New(httpClient)
+	// the token source refreshes expired tokens, API requests go through the
+	// rate limiter and retries
+	transport := newRetryTransport(base, opts, log)
+	httpClient.Transport = &oauth2.Transport{
+		Source: spotifyConfig.TokenSource(ctx),
+		Base:   transport,
+	}
+	spotifyClient := spotify.New(httpClient, spotify.WithBaseURL(opts.BaseURL))
 
 	return &spotifyService{
 		spotifyClient: spotifyClient,
 		log:           log,
+		opts:          opts,
+		pageSlots:     make(chan struct{}, opts.PageConcurrency),
+		transport:     transport,
+		timeout:       httpClient.Timeout,
 	}
 }
 
 func (s *spotifyService) GetObjectName(ctx context.Context, url string) (string, error) {
-
-	if !s.isValidSpotifyURL(url) {
-		s.log.Error("invalid spotify url", zap.String("url", url))
-		return "", errors.New("invalid spotify url")
-	}
-
-	objectType, err := s.GetObjectType(ctx, url)
+	ref, err := s.parseURL(ctx, url)
 	if err != nil {
-		s.log.Error("failed to get object type", zap.Error(err))
+		s.log.Error("invalid spotify url", zap.String("url", url), zap.Error(err))
 		return "", err
 	}
-
-	id := s.getSpotifyID(url)
-	if id == "" {
-		s.log.Error("failed to get spotify id", zap.String("url", url))
-		return "", errors.New("invalid spotify url")
-	}
+	id := ref.ID
 
 	var name string
-	switch objectType {
+	switch ref.Type {
 	case SpotifyObjectTypePlaylist:
 		playlist, err := s.spotifyClient.GetPlaylist(ctx, id)
 		if err != nil {
@@ -96,101 +157,189 @@ func (s *spotifyService) GetObjectName(ctx context.Context, url string) (string,
 			return "", err
 		}
 		name = track.Name
+	case SpotifyObjectTypeArtist:
+		artist, err := s.spotifyClient.GetArtist(ctx, id)
+		if err != nil {
+			s.log.Error("failed to get artist", zap.Error(err), zap.String("id", string(id)))
+			return "", err
+		}
+		name = artist.Name
+	case SpotifyObjectTypeSavedTracks:
+		name = "Liked Songs"
+	case SpotifyObjectTypeSavedAlbums:
+		name = "Saved Albums"
 	default:
-		return "", errors.New("unknown object type")
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedObjectType, ref.Type)
 	}
 
 	return name, nil
 }
 
 func (s *spotifyService) GetObjectType(ctx context.Context, url string) (SpotifyObjectType, error) {
-	if strings.Contains(url, "playlist") {
-		return SpotifyObjectTypePlaylist, nil
-	}
-	if strings.Contains(url, "album") {
-		return SpotifyObjectTypeAlbum, nil
-	}
-	if strings.Contains(url, "track") {
-		return SpotifyObjectTypeTrack, nil
-	}
-	if strings.Contains(url, "artist") {
-		return SpotifyObjectTypeArtist, nil
+	ref, err := s.parseURL(ctx, url)
+	if err != nil {
+		return "", err
 	}
-	return "", errors.New("unknown object type")
+	return ref.Type, nil
 }
 
-func (s *spotifyService) isValidSpotifyURL(url string) bool {
-	// Check if the URL starts with "https://open.spotify.com/"
-	return strings.HasPrefix(url, "https://open.spotify.com/")
+// maxTracksPerRequest is the most tracks GET /tracks returns at once
+const maxTracksPerRequest = 50
+
+// getTrackURL converts a Spotify track ID to a full URL
+func getTrackURL(trackID spotify.ID) string {
+	return fmt.Sprintf("https://open.spotify.com/track/%s", string(trackID))
 }
 
-func (s *spotifyService) getSpotifyID(url string) spotify.ID {
-	id := strings.Split(strings.Split(url, "/")[4], "?")[0]
-	return spotify.ID(id)
+// newTrackMetadata builds the metadata stored for a track of album. Tracks
+// listed by an album do not carry their ISRC, see fillISRCs.
+func newTrackMetadata(track spotify.SimpleTrack, album spotify.SimpleAlbum, isrc string) TrackMetadata {
+	var coverURL string
+	// Spotify lists the largest image first
+	if len(album.Images) > 0 {
+		coverURL = album.Images[0].URL
+	}
+	artist := joinArtists(track.Artists)
+
+	return TrackMetadata{
+		SpotifyURL:    getTrackURL(track.ID),
+		Artist:        strings.ToLower(artist),
+		Title:         strings.ToLower(track.Name),
+		DisplayArtist: artist,
+		DisplayTitle:  track.Name,
+		Album:         album.Name,
+		AlbumArtist:   joinArtists(album.Artists),
+		ISRC:          isrc,
+		DurationMs:    int64(track.Duration),
+		DiscNumber:    int(track.DiscNumber),
+		TrackNumber:   int(track.TrackNumber),
+		ReleaseDate:   album.ReleaseDate,
+		Explicit:      track.Explicit,
+		CoverURL:      coverURL,
+	}
 }
 
-// getTrackURL converts a Spotify track ID to a full URL
-func (s *spotifyService) getTrackURL(trackID spotify.ID) string {
-	return fmt.Sprintf("https://open.spotify.com/track/%s", string(trackID))
+// newFullTrackMetadata builds the metadata stored for a track fetched on its own
+func newFullTrackMetadata(track *spotify.FullTrack) TrackMetadata {
+	return newTrackMetadata(track.SimpleTrack, track.Album, track.ExternalIDs["isrc"])
 }
 
-func (s *spotifyService) GetPlaylistTracks(ctx context.Context, url string) ([]spotify.PlaylistItem, error) {
+// joinArtists joins artist names with ", "
+func joinArtists(artists []spotify.SimpleArtist) string {
+	names := make([]string, 0, len(artists))
+	for _, artist := range artists {
+		names = append(names, artist.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// fillISRCs looks up the ISRCs of tracks that have none, fetching them 50 at
+// a time. Tracks that are no longer available keep an empty ISRC.
+func (s *spotifyService) fillISRCs(ctx context.Context, tracks []TrackMetadata) error {
+	var missing []int
+	for i, track := range tracks {
+		if track.ISRC == "" {
+			missing = append(missing, i)
+		}
+	}
 
-	if !s.isValidSpotifyURL(url) {
-		return nil, errors.New("invalid spotify url")
+	for batch := range slices.Chunk(missing, maxTracksPerRequest) {
+		ids := make([]spotify.ID, 0, len(batch))
+		for _, i := range batch {
+			ids = append(ids, spotify.ID(strings.TrimPrefix(tracks[i].SpotifyURL, getTrackURL(""))))
+		}
+		fullTracks, err := s.spotifyClient.GetTracks(ctx, ids, s.opts.catalogOptions()...)
+		if err != nil {
+			return fmt.Errorf("failed to get tracks: %w", err)
+		}
+		for j, track := range fullTracks {
+			if track != nil && j < len(batch) {
+				tracks[batch[j]].ISRC = track.ExternalIDs["isrc"]
+			}
+		}
 	}
 
-	id := s.getSpotifyID(url)
-	if id == "" {
-		return nil, errors.New("invalid spotify url")
+	return nil
+}
+
+// getAlbumTracks returns all tracks of an album, handling pagination
+func (s *spotifyService) getAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	var allTracks []spotify.SimpleTrack
+	offset := 0
+	limit := 50
+	for {
+		opts := append(s.opts.catalogOptions(), spotify.Limit(limit), spotify.Offset(offset))
+		albumTracks, err := s.spotifyClient.GetAlbumTracks(ctx, id, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get album tracks: %w", err)
+		}
+		allTracks = append(allTracks, albumTracks.Tracks...)
+		if len(albumTracks.Tracks) < limit {
+			break
+		}
+		offset += limit
 	}
 
-	var playlistItems []spotify.PlaylistItem
-	itemsPage, err := s.spotifyClient.GetPlaylistItems(context.Background(), id)
+	return allTracks, nil
+}
+
+// GetPlaylistTracks returns all items of a playlist, see IteratePlaylistTracks
+func (s *spotifyService) GetPlaylistTracks(ctx context.Context, url string) ([]spotify.PlaylistItem, error) {
+	ref, err := s.parseURL(ctx, url)
 	if err != nil {
-		fmt.Println("Error getting playlist items:", err)
 		return nil, err
 	}
+	if ref.Type != SpotifyObjectTypePlaylist {
+		return nil, fmt.Errorf("%w: expected a playlist, got %s", ErrUnsupportedObjectType, ref.Type)
+	}
 
-	if itemsPage.Total > spotify.Numeric(len(itemsPage.Items)) {
-		total := int(itemsPage.Total)
-		for i := 0; i < total; i += int(itemsPage.Limit) {
-			items, err := s.spotifyClient.GetPlaylistItems(context.Background(), id, spotify.Limit(int(itemsPage.Limit)), spotify.Offset(i))
-			if err != nil {
-				fmt.Println("Error getting playlist items:", err)
-				return nil, err
-			}
-			playlistItems = append(playlistItems, items.Items...)
+	playlistItems := make([]spotify.PlaylistItem, 0)
+	for item, err := range s.iteratePlaylistItems(ctx, ref.ID) {
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		playlistItems = itemsPage.Items
+		playlistItems = append(playlistItems, item)
 	}
 
 	return playlistItems, nil
 }
 
-// GetTrackCount returns the total track count and metadata for a Spotify URL (album, playlist, or track)
-func (s *spotifyService) GetTrackCount(ctx context.Context, url string) (int, []TrackMetadata, error) {
-	if !s.isValidSpotifyURL(url) {
-		return 0, nil, errors.New("invalid spotify url")
+// GetPlaylistSnapshotID returns the snapshot_id of a playlist, which changes
+// whenever the playlist is modified
+func (s *spotifyService) GetPlaylistSnapshotID(ctx context.Context, url string) (string, error) {
+	ref, err := s.parseURL(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	if ref.Type != SpotifyObjectTypePlaylist {
+		return "", fmt.Errorf("%w: expected a playlist, got %s", ErrUnsupportedObjectType, ref.Type)
 	}
 
-	objectType, err := s.GetObjectType(ctx, url)
+	playlist, err := s.spotifyClient.GetPlaylist(ctx, ref.ID, spotify.Fields("snapshot_id"))
 	if err != nil {
-		return 0, nil, err
+		s.log.Error("failed to get playlist snapshot", zap.Error(err), zap.String("id", string(ref.ID)))
+		return "", err
 	}
 
-	id := s.getSpotifyID(url)
-	if id == "" {
-		return 0, nil, errors.New("failed to get spotify id")
+	return playlist.SnapshotID, nil
+}
+
+// GetTrackCount returns the total track count and metadata for a Spotify URL
+// (album, playlist, track or artist). The library URLs LikedSongsURL and
+// SavedAlbumsURL need a service returned by ForUser.
+func (s *spotifyService) GetTrackCount(ctx context.Context, url string) (int, []TrackMetadata, error) {
+	ref, err := s.parseURL(ctx, url)
+	if err != nil {
+		return 0, nil, err
 	}
+	id := ref.ID
 
 	var count int
 	var tracks []TrackMetadata
 
-	switch objectType {
+	switch ref.Type {
 	case SpotifyObjectTypePlaylist:
-		playlistItems, err := s.GetPlaylistTracks(ctx, url)
+		playlistItems, err := s.GetPlaylistTracks(ctx, ref.URL)
 		if err != nil {
 			return 0, nil, fmt.Errorf("failed to get playlist tracks: %w", err)
 		}
@@ -199,15 +348,7 @@ func (s *spotifyService) GetTrackCount(ctx context.Context, url string) (int, []
 			if item.Track.Track == nil {
 				continue
 			}
-			artists := []string{}
-			for _, artist := range item.Track.Track.Artists {
-				artists = append(artists, strings.ToLower(artist.Name))
-			}
-			tracks = append(tracks, TrackMetadata{
-				SpotifyURL: s.getTrackURL(item.Track.Track.ID),
-				Artist:     strings.Join(artists, ", "),
-				Title:      strings.ToLower(item.Track.Track.Name),
-			})
+			tracks = append(tracks, newFullTrackMetadata(item.Track.Track))
 		}
 
 	case SpotifyObjectTypeAlbum:
@@ -217,32 +358,15 @@ func (s *spotifyService) GetTrackCount(ctx context.Context, url string) (int, []
 		}
 		count = int(album.Tracks.Total)
 
-		// Get all album tracks (handle pagination)
-		var allTracks []spotify.SimpleTrack
-		offset := 0
-		limit := 50
-		for {
-			albumTracks, err := s.spotifyClient.GetAlbumTracks(ctx, id, spotify.Limit(limit), spotify.Offset(offset))
-			if err != nil {
-				return 0, nil, fmt.Errorf("failed to get album tracks: %w", err)
-			}
-			allTracks = append(allTracks, albumTracks.Tracks...)
-			if len(albumTracks.Tracks) < limit {
-				break
-			}
-			offset += limit
+		albumTracks, err := s.getAlbumTracks(ctx, id)
+		if err != nil {
+			return 0, nil, err
 		}
-
-		for _, track := range allTracks {
-			artists := []string{}
-			for _, artist := range track.Artists {
-				artists = append(artists, strings.ToLower(artist.Name))
-			}
-			tracks = append(tracks, TrackMetadata{
-				SpotifyURL: s.getTrackURL(track.ID),
-				Artist:     strings.Join(artists, ", "),
-				Title:      strings.ToLower(track.Name),
-			})
+		for _, track := range albumTracks {
+			tracks = append(tracks, newTrackMetadata(track, album.SimpleAlbum, ""))
+		}
+		if err := s.fillISRCs(ctx, tracks); err != nil {
+			return 0, nil, err
 		}
 
 	case SpotifyObjectTypeTrack:
@@ -251,18 +375,29 @@ func (s *spotifyService) GetTrackCount(ctx context.Context, url string) (int, []
 			return 0, nil, fmt.Errorf("failed to get track: %w", err)
 		}
 		count = 1
-		artists := []string{}
-		for _, artist := range track.Artists {
-			artists = append(artists, strings.ToLower(artist.Name))
+		tracks = append(tracks, newFullTrackMetadata(track))
+
+	case SpotifyObjectTypeArtist:
+		tracks, err = s.getArtistTracks(ctx, id)
+		if err != nil {
+			return 0, nil, err
+		}
+		count = len(tracks)
+
+	case SpotifyObjectTypeSavedTracks:
+		count, tracks, err = s.getSavedTracks(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+
+	case SpotifyObjectTypeSavedAlbums:
+		count, tracks, err = s.getSavedAlbumTracks(ctx)
+		if err != nil {
+			return 0, nil, err
 		}
-		tracks = append(tracks, TrackMetadata{
-			SpotifyURL: s.getTrackURL(track.ID),
-			Artist:     strings.Join(artists, ", "),
-			Title:      strings.ToLower(track.Name),
-		})
 
 	default:
-		return 0, nil, fmt.Errorf("unsupported object type: %s", objectType)
+		return 0, nil, fmt.Errorf("%w: %s", ErrUnsupportedObjectType, ref.Type)
 	}
 
 	return count, tracks, nil
@@ -0,0 +1,153 @@
+package spotifytest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// authCode is an authorization code waiting to be exchanged
+type authCode struct {
+	user        string
+	challenge   string
+	redirectURI string
+	scope       string
+}
+
+type userKey struct{}
+
+// requestUser returns the user an API request was authenticated as, empty
+// for client credentials tokens
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
+
+// LoginAs sets the user who grants access on the next visit of the
+// authorization URL. It defaults to the first fixture user.
+func (s *Server) LoginAs(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loginUser = userID
+}
+
+// handleAuthorize grants access right away, as if the user logged in and
+// accepted, and redirects back with a code
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "Illegal redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != ClientID {
+		http.Error(w, "Invalid client", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	if state := query.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+
+	s.mu.Lock()
+	user := s.loginUser
+	switch {
+	case query.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		params.Set("error", "invalid_request")
+	case user == "":
+		params.Set("error", "access_denied")
+	default:
+		code := s.newToken("code")
+		s.codes[code] = authCode{
+			user:        user,
+			challenge:   query.Get("code_challenge"),
+			redirectURI: redirectURI.String(),
+			scope:       query.Get("scope"),
+		}
+		params.Set("code", code)
+	}
+	s.mu.Unlock()
+
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokenRequests++
+
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	// PKCE clients may leave out the secret, except for client credentials
+	grantType := r.PostFormValue("grant_type")
+	if id != ClientID || (secret != "" || grantType == "client_credentials") && secret != ClientSecret {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_client", "error_description": "Invalid client"})
+		return
+	}
+
+	switch grantType {
+	case "client_credentials":
+		writeJSON(w, http.StatusOK, s.issueToken("", false, ""))
+
+	case "authorization_code":
+		code, ok := s.codes[r.PostFormValue("code")]
+		if !ok || code.redirectURI != r.PostFormValue("redirect_uri") {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "Invalid authorization code"})
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "code_verifier was incorrect"})
+			return
+		}
+		delete(s.codes, r.PostFormValue("code"))
+		writeJSON(w, http.StatusOK, s.issueToken(code.user, true, code.scope))
+
+	case "refresh_token":
+		// refresh tokens are rotated, so each one works once; like Spotify the
+		// response may leave out the unchanged scope
+		user, ok := s.refreshTokens[r.PostFormValue("refresh_token")]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "Invalid refresh token"})
+			return
+		}
+		delete(s.refreshTokens, r.PostFormValue("refresh_token"))
+		writeJSON(w, http.StatusOK, s.issueToken(user, true, ""))
+
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "unsupported_grant_type"})
+	}
+}
+
+// issueToken returns a token response for user; s.mu must be held
+func (s *Server) issueToken(user string, refresh bool, scope string) map[string]any {
+	access := s.newToken("access")
+	s.accessTokens[access] = user
+
+	body := map[string]any{"access_token": access, "token_type": "Bearer", "expires_in": 3600}
+	if refresh {
+		token := s.newToken("refresh")
+		s.refreshTokens[token] = user
+		body["refresh_token"] = token
+	}
+	if scope != "" {
+		body["scope"] = scope
+	}
+	return body
+}
+
+// newToken returns a unique token; s.mu must be held
+func (s *Server) newToken(kind string) string {
+	s.tokenCounter++
+	return fmt.Sprintf("spotifytest-%s-%d", kind, s.tokenCounter)
+}
@@ -0,0 +1,95 @@
+package spotifytest
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Fixtures is the catalog served by a Server. Objects refer to each other by
+// ID; tracks listed by an album get that album.
+type Fixtures struct {
+	Artists   []Artist   `json:"artists"`
+	Albums    []Album    `json:"albums"`
+	Tracks    []Track    `json:"tracks"`
+	Playlists []Playlist `json:"playlists"`
+	Users     []User     `json:"users"`
+	// ShortLinks maps spotify.link codes to the URL they redirect to
+	ShortLinks map[string]string `json:"short_links,omitempty"`
+}
+
+// User is a fixture user who can grant access with the authorization code flow
+type User struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// PlaylistIDs are the playlists the user follows or collaborates on,
+	// besides the ones they own
+	PlaylistIDs []string `json:"playlists,omitempty"`
+	// SavedTrackIDs are the user's Liked Songs and SavedAlbumIDs their saved
+	// albums, most recently saved first
+	SavedTrackIDs []string `json:"saved_tracks,omitempty"`
+	SavedAlbumIDs []string `json:"saved_albums,omitempty"`
+}
+
+// Artist is a fixture artist
+type Artist struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Genres []string `json:"genres,omitempty"`
+}
+
+// Album is a fixture album
+type Album struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	ArtistIDs []string `json:"artists"`
+	// Group is the album_group of the album on its artists' pages: album,
+	// single, compilation or appears_on. Defaults to album.
+	Group       string `json:"group,omitempty"`
+	ReleaseDate string `json:"release_date,omitempty"`
+	CoverURL    string `json:"cover_url,omitempty"`
+	// TrackIDs are the tracks of the album in order
+	TrackIDs []string `json:"tracks"`
+}
+
+// Track is a fixture track
+type Track struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	ArtistIDs  []string `json:"artists"`
+	DurationMs int      `json:"duration_ms,omitempty"`
+	// DiscNumber defaults to 1, TrackNumber to the position on the album
+	DiscNumber  int    `json:"disc_number,omitempty"`
+	TrackNumber int    `json:"track_number,omitempty"`
+	Explicit    bool   `json:"explicit,omitempty"`
+	ISRC        string `json:"isrc,omitempty"`
+}
+
+// Playlist is a fixture playlist
+type Playlist struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	SnapshotID string `json:"snapshot_id"`
+	// Owner is the ID of the owning user
+	Owner string `json:"owner,omitempty"`
+	// Private playlists are only visible to their owner and the users
+	// listing them, and only with a user token
+	Private       bool `json:"private,omitempty"`
+	Collaborative bool `json:"collaborative,omitempty"`
+	// TrackIDs are the playlist items in order. An empty ID is an item whose
+	// track is no longer available, which Spotify returns as null.
+	TrackIDs []string `json:"tracks"`
+}
+
+// ReadFixtures reads fixtures from a JSON file
+func ReadFixtures(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, err
+	}
+
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Fixtures{}, err
+	}
+	return f, nil
+}
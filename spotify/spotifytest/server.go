@@ -0,0 +1,820 @@
+// Package spotifytest runs a fake Spotify Web API for tests. It issues client
+// credentials and user tokens and serves playlists, albums, tracks and
+// artists from fixtures with Spotify's pagination, as well as users' saved
+// tracks and albums, search results and spotify.link short links, and can be
+// told to answer with 429 or other errors.
+package spotifytest
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/supperdoggy/spot-models/spotify"
+)
+
+// Client credentials accepted by the token endpoint
+const (
+	ClientID     = "spotifytest-client"
+	ClientSecret = "spotifytest-secret"
+)
+
+// Server is a fake Spotify Web API. Requests to unknown objects get 404.
+type Server struct {
+	*httptest.Server
+
+	artists   map[string]Artist
+	albums    map[string]Album
+	tracks    map[string]Track
+	playlists map[string]Playlist
+	users     map[string]User
+	// shortLinks maps spotify.link codes to their target URL
+	shortLinks map[string]string
+	// the order slices keep the fixture order
+	artistOrder   []string
+	trackOrder    []string
+	playlistOrder []string
+	userOrder     []string
+	// trackAlbums maps a track to the album listing it
+	trackAlbums map[string]string
+
+	mu            sync.Mutex
+	failures      []failure
+	requests      int
+	tokenRequests int
+
+	// issued tokens and codes map to the user they were issued for, the
+	// empty string for client credentials tokens
+	accessTokens  map[string]string
+	refreshTokens map[string]string
+	codes         map[string]authCode
+	loginUser     string
+	tokenCounter  int
+}
+
+type failure struct {
+	status     int
+	retryAfter time.Duration
+}
+
+// NewServer starts a server serving f. Close it when done.
+func NewServer(f Fixtures) *Server {
+	s := &Server{
+		artists:     make(map[string]Artist),
+		albums:      make(map[string]Album),
+		tracks:      make(map[string]Track),
+		playlists:   make(map[string]Playlist),
+		users:       make(map[string]User),
+		trackAlbums: make(map[string]string),
+		shortLinks:  f.ShortLinks,
+
+		accessTokens:  make(map[string]string),
+		refreshTokens: make(map[string]string),
+		codes:         make(map[string]authCode),
+	}
+	for _, artist := range f.Artists {
+		s.artists[artist.ID] = artist
+		s.artistOrder = append(s.artistOrder, artist.ID)
+	}
+	for _, album := range f.Albums {
+		s.albums[album.ID] = album
+		for _, id := range album.TrackIDs {
+			s.trackAlbums[id] = album.ID
+		}
+	}
+	for _, track := range f.Tracks {
+		s.tracks[track.ID] = track
+		s.trackOrder = append(s.trackOrder, track.ID)
+	}
+	for _, playlist := range f.Playlists {
+		s.playlists[playlist.ID] = playlist
+		s.playlistOrder = append(s.playlistOrder, playlist.ID)
+	}
+	for _, user := range f.Users {
+		s.users[user.ID] = user
+		s.userOrder = append(s.userOrder, user.ID)
+	}
+	if len(s.userOrder) > 0 {
+		s.loginUser = s.userOrder[0]
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /api/token", s.handleToken)
+	mux.HandleFunc("GET /v1/me/playlists", s.api(s.handleMyPlaylists))
+	mux.HandleFunc("GET /v1/me/tracks", s.api(s.handleMyTracks))
+	mux.HandleFunc("GET /v1/me/albums", s.api(s.handleMyAlbums))
+	mux.HandleFunc("GET /v1/playlists/{id}", s.api(s.handlePlaylist))
+	mux.HandleFunc("GET /v1/playlists/{id}/tracks", s.api(s.handlePlaylistItems))
+	mux.HandleFunc("GET /v1/albums/{id}", s.api(s.handleAlbum))
+	mux.HandleFunc("GET /v1/albums/{id}/tracks", s.api(s.handleAlbumTracks))
+	mux.HandleFunc("GET /v1/tracks", s.api(s.handleTracks))
+	mux.HandleFunc("GET /v1/tracks/{id}", s.api(s.handleTrack))
+	mux.HandleFunc("GET /v1/artists/{id}", s.api(s.handleArtist))
+	mux.HandleFunc("GET /v1/artists/{id}/albums", s.api(s.handleArtistAlbums))
+	mux.HandleFunc("GET /v1/search", s.api(s.handleSearch))
+	mux.HandleFunc("GET "+shortLinkHost+"/{code}", s.handleShortLink)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Options returns DefaultOptions pointed at the server, with retry backoff
+// shortened and the rate limiter disabled so tests run fast. Its HTTPClient
+// also sends spotify.link requests to the server.
+func (s *Server) Options() spotify.Options {
+	opts := spotify.DefaultOptions()
+	opts.BaseURL = s.URL + "/v1/"
+	opts.TokenURL = s.URL + "/api/token"
+	opts.AuthURL = s.URL + "/authorize"
+	opts.HTTPClient = &http.Client{Transport: &shortLinkTransport{base: s.Client().Transport, server: s.Listener.Addr().String()}}
+	opts.RateLimit = -1
+	opts.RetryBackoff = time.Millisecond
+	return opts
+}
+
+// FailNext makes the next n API requests fail with status. Responses with
+// status 429 carry a Retry-After header when retryAfter is set; it is sent in
+// whole seconds like Spotify does.
+func (s *Server) FailNext(n, status int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for range n {
+		s.failures = append(s.failures, failure{status: status, retryAfter: retryAfter})
+	}
+}
+
+// Requests returns the number of API requests received, failed ones included
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// TokenRequests returns the number of token requests received
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokenRequests
+}
+
+// api wraps an API handler with authentication and the queued failures
+func (s *Server) api(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		var fail *failure
+		if len(s.failures) > 0 {
+			fail = &s.failures[0]
+			s.failures = s.failures[1:]
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		user, ok := s.accessTokens[token]
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+		if fail != nil {
+			if fail.status == http.StatusTooManyRequests && fail.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(fail.retryAfter.Seconds()))))
+			}
+			writeError(w, fail.status, http.StatusText(fail.status))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// shortLinkHost serves the short links Spotify's share menu creates
+const shortLinkHost = "spotify.link"
+
+// shortLinkTransport sends requests to spotify.link to the server, keeping
+// the Host header so they reach handleShortLink
+type shortLinkTransport struct {
+	base   http.RoundTripper
+	server string
+}
+
+func (t *shortLinkTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host != shortLinkHost {
+		return t.base.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context())
+	r.Host = shortLinkHost
+	r.URL.Scheme = "http"
+	r.URL.Host = t.server
+	return t.base.RoundTrip(r)
+}
+
+// handleShortLink redirects a short link to its target like spotify.link does
+func (s *Server) handleShortLink(w http.ResponseWriter, r *http.Request) {
+	target, ok := s.shortLinks[r.PathValue("code")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.visiblePlaylist(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	body := s.simplePlaylist(playlist)
+	body["followers"] = map[string]any{"total": 0}
+	body["tracks"] = s.playlistItems(r, playlist, 0, 100)
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) handlePlaylistItems(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.visiblePlaylist(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	offset, limit, ok := pageParams(w, r, 100)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.playlistItems(r, playlist, offset, limit))
+}
+
+func (s *Server) handleMyPlaylists(w http.ResponseWriter, r *http.Request) {
+	userID := requestUser(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, "This request requires user authentication")
+		return
+	}
+
+	offset, limit, ok := pageParams(w, r, 50)
+	if !ok {
+		return
+	}
+
+	var playlists []map[string]any
+	for _, id := range s.playlistOrder {
+		if playlist := s.playlists[id]; s.inLibrary(playlist, userID) {
+			body := s.simplePlaylist(playlist)
+			body["tracks"] = map[string]any{"total": len(playlist.TrackIDs)}
+			playlists = append(playlists, body)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, page(r, playlists, offset, limit))
+}
+
+func (s *Server) handleMyTracks(w http.ResponseWriter, r *http.Request) {
+	userID := requestUser(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, "This request requires user authentication")
+		return
+	}
+
+	offset, limit, ok := pageParams(w, r, 50)
+	if !ok {
+		return
+	}
+
+	var items []map[string]any
+	for _, id := range s.users[userID].SavedTrackIDs {
+		if track, ok := s.tracks[id]; ok {
+			items = append(items, map[string]any{"added_at": "2024-01-01T00:00:00Z", "track": s.fullTrack(track)})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, page(r, items, offset, limit))
+}
+
+func (s *Server) handleMyAlbums(w http.ResponseWriter, r *http.Request) {
+	userID := requestUser(r)
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, "This request requires user authentication")
+		return
+	}
+
+	offset, limit, ok := pageParams(w, r, 50)
+	if !ok {
+		return
+	}
+
+	var items []map[string]any
+	for _, id := range s.users[userID].SavedAlbumIDs {
+		if album, ok := s.albums[id]; ok {
+			body := s.simpleAlbum(album)
+			body["genres"] = []string{}
+			body["popularity"] = 0
+			body["tracks"] = s.albumTracks(r, album, 0, 50)
+			items = append(items, map[string]any{"added_at": "2024-01-01T00:00:00Z", "album": body})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, page(r, items, offset, limit))
+}
+
+// visiblePlaylist returns the playlist of the request path if the caller may see it
+func (s *Server) visiblePlaylist(r *http.Request) (Playlist, bool) {
+	playlist, ok := s.playlists[r.PathValue("id")]
+	if !ok || playlist.Private && !s.inLibrary(playlist, requestUser(r)) {
+		return Playlist{}, false
+	}
+	return playlist, true
+}
+
+// inLibrary reports whether a user owns or lists a playlist
+func (s *Server) inLibrary(playlist Playlist, userID string) bool {
+	if userID == "" {
+		return false
+	}
+	return playlist.Owner == userID || slices.Contains(s.users[userID].PlaylistIDs, playlist.ID)
+}
+
+func (s *Server) handleAlbum(w http.ResponseWriter, r *http.Request) {
+	album, ok := s.albums[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	body := s.simpleAlbum(album)
+	body["genres"] = []string{}
+	body["popularity"] = 0
+	body["tracks"] = s.albumTracks(r, album, 0, 50)
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) handleAlbumTracks(w http.ResponseWriter, r *http.Request) {
+	album, ok := s.albums[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	offset, limit, ok := pageParams(w, r, 50)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.albumTracks(r, album, offset, limit))
+}
+
+func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request) {
+	track, ok := s.tracks[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fullTrack(track))
+}
+
+// handleTracks returns several tracks at once, null for unknown IDs
+func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request) {
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	if len(ids) > 50 {
+		writeError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+
+	tracks := make([]any, 0, len(ids))
+	for _, id := range ids {
+		if track, ok := s.tracks[id]; ok {
+			tracks = append(tracks, s.fullTrack(track))
+		} else {
+			tracks = append(tracks, nil)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tracks": tracks})
+}
+
+func (s *Server) handleArtist(w http.ResponseWriter, r *http.Request) {
+	artist, ok := s.artists[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.fullArtist(artist.ID))
+}
+
+func (s *Server) handleArtistAlbums(w http.ResponseWriter, r *http.Request) {
+	artistID := r.PathValue("id")
+	if _, ok := s.artists[artistID]; !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	offset, limit, ok := pageParams(w, r, 50)
+	if !ok {
+		return
+	}
+
+	var groups []string
+	if include := r.URL.Query().Get("include_groups"); include != "" {
+		groups = strings.Split(include, ",")
+	}
+
+	var albums []map[string]any
+	for _, album := range s.sortedAlbums() {
+		group := albumGroup(album)
+		if !slices.Contains(album.ArtistIDs, artistID) && !s.appearsOn(album, artistID) {
+			continue
+		}
+		if !slices.Contains(album.ArtistIDs, artistID) {
+			group = "appears_on"
+		}
+		if len(groups) > 0 && !slices.Contains(groups, group) {
+			continue
+		}
+
+		body := s.simpleAlbum(album)
+		body["album_group"] = group
+		albums = append(albums, body)
+	}
+
+	writeJSON(w, http.StatusOK, page(r, albums, offset, limit))
+}
+
+// handleSearch finds the objects whose name, together with their artists or
+// owner, contains every word of the query. Objects with more of the words in
+// their name rank first, then fixture order. Private playlists are never found.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	terms := searchTerms(query.Get("q"))
+	if len(terms) == 0 {
+		writeError(w, http.StatusBadRequest, "No search query")
+		return
+	}
+	types := strings.Split(query.Get("type"), ",")
+	for _, t := range types {
+		if !slices.Contains([]string{"album", "artist", "playlist", "track"}, t) {
+			writeError(w, http.StatusBadRequest, "Bad search type field")
+			return
+		}
+	}
+
+	offset, limit, ok := pageParams(w, r, 50)
+	if !ok {
+		return
+	}
+
+	body := make(map[string]any)
+	if slices.Contains(types, "track") {
+		var results []searchMatch
+		for _, id := range s.trackOrder {
+			track := s.tracks[id]
+			results = append(results, searchMatch{track.Name, s.artistNames(track.ArtistIDs), s.fullTrack(track)})
+		}
+		body["tracks"] = page(r, rankMatches(results, terms), offset, limit)
+	}
+	if slices.Contains(types, "album") {
+		var results []searchMatch
+		for _, album := range s.sortedAlbums() {
+			results = append(results, searchMatch{album.Name, s.artistNames(album.ArtistIDs), s.simpleAlbum(album)})
+		}
+		body["albums"] = page(r, rankMatches(results, terms), offset, limit)
+	}
+	if slices.Contains(types, "playlist") {
+		var results []searchMatch
+		for _, id := range s.playlistOrder {
+			if playlist := s.playlists[id]; !playlist.Private {
+				item := s.simplePlaylist(playlist)
+				item["tracks"] = map[string]any{"total": len(playlist.TrackIDs)}
+				results = append(results, searchMatch{playlist.Name, cmp.Or(s.users[playlist.Owner].Name, playlist.Owner), item})
+			}
+		}
+		body["playlists"] = page(r, rankMatches(results, terms), offset, limit)
+	}
+	if slices.Contains(types, "artist") {
+		var results []searchMatch
+		for _, id := range s.artistOrder {
+			results = append(results, searchMatch{s.artists[id].Name, "", s.fullArtist(id)})
+		}
+		body["artists"] = page(r, rankMatches(results, terms), offset, limit)
+	}
+
+	writeJSON(w, http.StatusOK, body)
+}
+
+// searchMatch is a search candidate: its name, the other text it can be
+// found by and its response body
+type searchMatch struct {
+	name  string
+	extra string
+	body  map[string]any
+}
+
+// searchTerms splits a query into lowercase words, dropping field filters
+// like "artist:" and words without letters or digits, like a dash
+func searchTerms(query string) []string {
+	var terms []string
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if _, value, ok := strings.Cut(term, ":"); ok {
+			term = value
+		}
+		if strings.IndexFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// rankMatches returns the bodies of the candidates containing every term
+func rankMatches(candidates []searchMatch, terms []string) []map[string]any {
+	type ranked struct {
+		body  map[string]any
+		score int
+	}
+	var matches []ranked
+	for _, candidate := range candidates {
+		name := strings.ToLower(candidate.name)
+		text := name + " " + strings.ToLower(candidate.extra)
+		score := 0
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				score = -1
+				break
+			}
+			if strings.Contains(name, term) {
+				score++
+			}
+		}
+		if score >= 0 {
+			matches = append(matches, ranked{candidate.body, score})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b ranked) int {
+		return b.score - a.score
+	})
+
+	bodies := make([]map[string]any, 0, len(matches))
+	for _, match := range matches {
+		bodies = append(bodies, match.body)
+	}
+	return bodies
+}
+
+// artistNames joins the names of artists with spaces
+func (s *Server) artistNames(ids []string) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, s.artists[id].Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// sortedAlbums returns the albums ordered by release date and ID
+func (s *Server) sortedAlbums() []Album {
+	albums := make([]Album, 0, len(s.albums))
+	for _, album := range s.albums {
+		albums = append(albums, album)
+	}
+	slices.SortFunc(albums, func(a, b Album) int {
+		if c := strings.Compare(a.ReleaseDate, b.ReleaseDate); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return albums
+}
+
+// appearsOn reports whether an artist is on a track of someone else's album
+func (s *Server) appearsOn(album Album, artistID string) bool {
+	for _, id := range album.TrackIDs {
+		if slices.Contains(s.tracks[id].ArtistIDs, artistID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) playlistItems(r *http.Request, playlist Playlist, offset, limit int) map[string]any {
+	items := make([]map[string]any, 0, len(playlist.TrackIDs))
+	for _, id := range playlist.TrackIDs {
+		item := map[string]any{
+			"added_at": "2024-01-01T00:00:00Z",
+			"added_by": map[string]any{"id": playlist.Owner, "type": "user"},
+			"is_local": false,
+			"track":    nil,
+		}
+		if track, ok := s.tracks[id]; ok {
+			item["track"] = s.fullTrack(track)
+		}
+		items = append(items, item)
+	}
+	return page(r, items, offset, limit)
+}
+
+func (s *Server) albumTracks(r *http.Request, album Album, offset, limit int) map[string]any {
+	tracks := make([]map[string]any, 0, len(album.TrackIDs))
+	for _, id := range album.TrackIDs {
+		if track, ok := s.tracks[id]; ok {
+			tracks = append(tracks, s.simpleTrack(track))
+		}
+	}
+	return page(r, tracks, offset, limit)
+}
+
+func (s *Server) simplePlaylist(playlist Playlist) map[string]any {
+	return map[string]any{
+		"id":            playlist.ID,
+		"name":          playlist.Name,
+		"type":          "playlist",
+		"uri":           "spotify:playlist:" + playlist.ID,
+		"snapshot_id":   playlist.SnapshotID,
+		"collaborative": playlist.Collaborative,
+		"public":        !playlist.Private,
+		"description":   "",
+		"images":        []any{},
+		"owner":         map[string]any{"id": playlist.Owner, "display_name": cmp.Or(s.users[playlist.Owner].Name, playlist.Owner), "type": "user"},
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/playlist/" + playlist.ID},
+	}
+}
+
+func (s *Server) simpleAlbum(album Album) map[string]any {
+	artists := make([]map[string]any, 0, len(album.ArtistIDs))
+	for _, id := range album.ArtistIDs {
+		artists = append(artists, s.simpleArtist(id))
+	}
+	images := []map[string]any{}
+	if album.CoverURL != "" {
+		images = append(images, map[string]any{"url": album.CoverURL, "height": 640, "width": 640})
+	}
+
+	return map[string]any{
+		"id":                     album.ID,
+		"name":                   album.Name,
+		"type":                   "album",
+		"uri":                    "spotify:album:" + album.ID,
+		"album_type":             albumType(album),
+		"album_group":            albumGroup(album),
+		"artists":                artists,
+		"images":                 images,
+		"release_date":           album.ReleaseDate,
+		"release_date_precision": "day",
+		"total_tracks":           len(album.TrackIDs),
+		"external_urls":          map[string]string{"spotify": "https://open.spotify.com/album/" + album.ID},
+	}
+}
+
+func (s *Server) simpleTrack(track Track) map[string]any {
+	artists := make([]map[string]any, 0, len(track.ArtistIDs))
+	for _, id := range track.ArtistIDs {
+		artists = append(artists, s.simpleArtist(id))
+	}
+
+	discNumber, trackNumber := track.DiscNumber, track.TrackNumber
+	if discNumber == 0 {
+		discNumber = 1
+	}
+	if trackNumber == 0 {
+		trackNumber = slices.Index(s.albums[s.trackAlbums[track.ID]].TrackIDs, track.ID) + 1
+	}
+
+	return map[string]any{
+		"id":            track.ID,
+		"name":          track.Name,
+		"type":          "track",
+		"uri":           "spotify:track:" + track.ID,
+		"artists":       artists,
+		"duration_ms":   track.DurationMs,
+		"disc_number":   discNumber,
+		"track_number":  trackNumber,
+		"explicit":      track.Explicit,
+		"is_local":      false,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/track/" + track.ID},
+	}
+}
+
+func (s *Server) fullTrack(track Track) map[string]any {
+	body := s.simpleTrack(track)
+	body["popularity"] = 0
+	body["external_ids"] = map[string]string{}
+	if track.ISRC != "" {
+		body["external_ids"] = map[string]string{"isrc": track.ISRC}
+	}
+	if album, ok := s.albums[s.trackAlbums[track.ID]]; ok {
+		body["album"] = s.simpleAlbum(album)
+	}
+	return body
+}
+
+func (s *Server) simpleArtist(id string) map[string]any {
+	return map[string]any{
+		"id":            id,
+		"name":          s.artists[id].Name,
+		"type":          "artist",
+		"uri":           "spotify:artist:" + id,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/artist/" + id},
+	}
+}
+
+func (s *Server) fullArtist(id string) map[string]any {
+	body := s.simpleArtist(id)
+	body["genres"] = slices.Concat([]string{}, s.artists[id].Genres)
+	body["followers"] = map[string]any{"total": 0}
+	body["popularity"] = 0
+	body["images"] = []any{}
+	return body
+}
+
+func albumGroup(album Album) string {
+	if album.Group == "" {
+		return "album"
+	}
+	return album.Group
+}
+
+func albumType(album Album) string {
+	if group := albumGroup(album); group != "appears_on" {
+		return group
+	}
+	return "album"
+}
+
+// pageParams reads offset and limit, answering 400 for invalid values like Spotify
+func pageParams(w http.ResponseWriter, r *http.Request, maxLimit int) (offset, limit int, ok bool) {
+	offset, limit = 0, 20
+	query := r.URL.Query()
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid offset")
+			return 0, 0, false
+		}
+		offset = n
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return 0, 0, false
+		}
+		limit = n
+	}
+	return offset, limit, true
+}
+
+// page returns the items between offset and offset+limit as a paging object
+func page(r *http.Request, items []map[string]any, offset, limit int) map[string]any {
+	pageItems := items[min(offset, len(items)):min(offset+limit, len(items))]
+	if pageItems == nil {
+		pageItems = []map[string]any{}
+	}
+
+	pageURL := func(offset int) string {
+		u := *r.URL
+		u.Scheme, u.Host = "http", r.Host
+		query := u.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("limit", strconv.Itoa(limit))
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	var next, previous any
+	if offset+limit < len(items) {
+		next = pageURL(offset + limit)
+	}
+	if offset > 0 {
+		previous = pageURL(max(offset-limit, 0))
+	}
+
+	return map[string]any{
+		"href":     (&url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}).String(),
+		"items":    pageItems,
+		"limit":    limit,
+		"offset":   offset,
+		"total":    len(items),
+		"next":     next,
+		"previous": previous,
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]any{"status": status, "message": message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
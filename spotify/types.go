@@ -7,4 +7,25 @@ const (
 	SpotifyObjectTypeAlbum    SpotifyObjectType = "album"
 	SpotifyObjectTypeTrack    SpotifyObjectType = "track"
 	SpotifyObjectTypeArtist   SpotifyObjectType = "artist"
+
+	// A user's Liked Songs and saved albums, read with a user token (see ForUser)
+	SpotifyObjectTypeSavedTracks SpotifyObjectType = "saved_tracks"
+	SpotifyObjectTypeSavedAlbums SpotifyObjectType = "saved_albums"
+)
+
+// IsLibrary reports whether t is a collection in a user's library rather
+// than a catalog object. Library URLs have no ID and mean something
+// different for every user.
+func (t SpotifyObjectType) IsLibrary() bool {
+	return t == SpotifyObjectTypeSavedTracks || t == SpotifyObjectTypeSavedAlbums
+}
+
+// ArtistAlbumGroup is the relationship between an artist and one of their releases
+type ArtistAlbumGroup string
+
+const (
+	ArtistAlbumGroupAlbum       ArtistAlbumGroup = "album"
+	ArtistAlbumGroupSingle      ArtistAlbumGroup = "single"
+	ArtistAlbumGroupCompilation ArtistAlbumGroup = "compilation"
+	ArtistAlbumGroupAppearsOn   ArtistAlbumGroup = "appears_on"
 )
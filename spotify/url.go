@@ -0,0 +1,239 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+var (
+	ErrInvalidURL            = errors.New("invalid spotify url")
+	ErrInvalidID             = errors.New("invalid spotify id")
+	ErrUnsupportedObjectType = errors.New("unsupported spotify object type")
+	// ErrShortLink is returned for spotify.link URLs, which have to be
+	// resolved over the network before they can be parsed
+	ErrShortLink = errors.New("spotify short link must be resolved first")
+)
+
+const (
+	spotifyIDLength   = 22
+	maxShortLinkHops  = 5
+	openSpotifyPrefix = "https://open.spotify.com/"
+)
+
+var supportedObjectTypes = map[SpotifyObjectType]bool{
+	SpotifyObjectTypePlaylist: true,
+	SpotifyObjectTypeAlbum:    true,
+	SpotifyObjectTypeTrack:    true,
+	SpotifyObjectTypeArtist:   true,
+}
+
+// Canonical URLs of the user library collections, the same for every user
+const (
+	LikedSongsURL  = openSpotifyPrefix + "collection/tracks"
+	SavedAlbumsURL = openSpotifyPrefix + "collection/albums"
+)
+
+// LibraryURL returns the URL of a library collection type, or "" for
+// catalog types
+func LibraryURL(t SpotifyObjectType) string {
+	for name, objectType := range libraryCollections {
+		if objectType == t {
+			return openSpotifyPrefix + "collection/" + name
+		}
+	}
+	return ""
+}
+
+// libraryCollections maps the last segment of a collection URL to its type
+var libraryCollections = map[string]SpotifyObjectType{
+	"tracks": SpotifyObjectTypeSavedTracks,
+	"albums": SpotifyObjectTypeSavedAlbums,
+}
+
+// Ref identifies a single Spotify object
+type Ref struct {
+	Type SpotifyObjectType
+	// ID is empty for library collections
+	ID spotify.ID
+	// URL is the canonical https://open.spotify.com/<type>/<id> form, or
+	// LikedSongsURL or SavedAlbumsURL
+	URL string
+}
+
+// URI returns the spotify:<type>:<id> form of the reference, or
+// spotify:collection:<tracks|albums> for library collections
+func (r Ref) URI() string {
+	if r.Type.IsLibrary() {
+		return "spotify:collection:" + strings.TrimPrefix(r.URL, openSpotifyPrefix+"collection/")
+	}
+	return fmt.Sprintf("spotify:%s:%s", r.Type, r.ID)
+}
+
+// URLError describes why a URL could not be parsed
+type URLError struct {
+	URL string
+	Err error
+}
+
+func (e *URLError) Error() string {
+	return fmt.Sprintf("parse spotify url %q: %v", e.URL, e.Err)
+}
+
+func (e *URLError) Unwrap() error {
+	return e.Err
+}
+
+// ParseURL parses an open.spotify.com URL or a spotify: URI. Locale prefixes
+// (/intl-de/), embed URLs, query strings and trailing slashes are accepted.
+// The library URLs open.spotify.com/collection/tracks (Liked Songs) and
+// /collection/albums parse to a Ref without an ID.
+func ParseURL(raw string) (Ref, error) {
+	raw = strings.TrimSpace(raw)
+	fail := func(err error) (Ref, error) {
+		return Ref{}, &URLError{URL: raw, Err: err}
+	}
+
+	var segments []string
+	if strings.HasPrefix(raw, "spotify:") {
+		// spotify:album:<id>, or the legacy spotify:user:<user>:playlist:<id>
+		parts := strings.Split(raw, ":")
+		if len(parts) < 3 {
+			return fail(ErrInvalidURL)
+		}
+		segments = parts[len(parts)-2:]
+		// Liked Songs is spotify:user:<user>:collection
+		if parts[len(parts)-1] == "collection" {
+			segments = []string{"collection", "tracks"}
+		}
+	} else {
+		withScheme := raw
+		if !strings.Contains(raw, "://") {
+			withScheme = "https://" + raw
+		}
+		u, err := url.Parse(withScheme)
+		if err != nil {
+			return fail(ErrInvalidURL)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fail(ErrInvalidURL)
+		}
+
+		switch strings.ToLower(u.Hostname()) {
+		case "open.spotify.com", "play.spotify.com":
+		case "spotify.link", "spotify.app.link":
+			return fail(ErrShortLink)
+		default:
+			return fail(ErrInvalidURL)
+		}
+
+		for _, segment := range strings.Split(u.Path, "/") {
+			if segment != "" {
+				segments = append(segments, segment)
+			}
+		}
+		if len(segments) > 0 && strings.HasPrefix(segments[0], "intl-") {
+			segments = segments[1:]
+		}
+		if len(segments) > 0 && segments[0] == "embed" {
+			segments = segments[1:]
+		}
+		// legacy /user/<user>/playlist/<id>
+		if len(segments) == 4 && segments[0] == "user" && segments[2] == string(SpotifyObjectTypePlaylist) {
+			segments = segments[2:]
+		}
+	}
+
+	if len(segments) != 2 {
+		return fail(ErrInvalidURL)
+	}
+
+	if segments[0] == "collection" {
+		objectType, ok := libraryCollections[segments[1]]
+		if !ok {
+			return fail(ErrUnsupportedObjectType)
+		}
+		return Ref{Type: objectType, URL: openSpotifyPrefix + "collection/" + segments[1]}, nil
+	}
+
+	objectType := SpotifyObjectType(segments[0])
+	if !supportedObjectTypes[objectType] {
+		return fail(ErrUnsupportedObjectType)
+	}
+
+	id := segments[1]
+	if !isValidID(id) {
+		return fail(ErrInvalidID)
+	}
+
+	return Ref{
+		Type: objectType,
+		ID:   spotify.ID(id),
+		URL:  openSpotifyPrefix + string(objectType) + "/" + id,
+	}, nil
+}
+
+// isValidID reports whether id is a 22 character base62 Spotify ID
+func isValidID(id string) bool {
+	if len(id) != spotifyIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseURL parses url, resolving spotify.link short links by following their redirects
+func (s *spotifyService) parseURL(ctx context.Context, url string) (Ref, error) {
+	ref, err := ParseURL(url)
+	for hops := 0; errors.Is(err, ErrShortLink) && hops < maxShortLinkHops; hops++ {
+		url, err = s.resolveShortLink(ctx, url)
+		if err != nil {
+			return Ref{}, err
+		}
+		ref, err = ParseURL(url)
+	}
+	return ref, err
+}
+
+func (s *spotifyService) resolveShortLink(ctx context.Context, link string) (string, error) {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", &URLError{URL: link, Err: ErrInvalidURL}
+	}
+
+	// the configured transport without authentication or rate limiting,
+	// stopping at the first redirect to read its Location
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: s.timeout,
+	}
+	if s.opts.HTTPClient != nil {
+		client.Transport = s.opts.HTTPClient.Transport
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve short link: %w", err)
+	}
+	defer resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", &URLError{URL: link, Err: ErrInvalidURL}
+	}
+	return location, nil
+}
@@ -0,0 +1,157 @@
+package spotify
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	const id = "4aawyAB9vmqN3uQ7FjRGTy"
+
+	tests := []struct {
+		name     string
+		input    string
+		wantType SpotifyObjectType
+		wantErr  error
+	}{
+		{"album", "https://open.spotify.com/album/" + id, SpotifyObjectTypeAlbum, nil},
+		{"query string", "https://open.spotify.com/playlist/" + id + "?si=abc123", SpotifyObjectTypePlaylist, nil},
+		{"trailing slash", "https://open.spotify.com/track/" + id + "/", SpotifyObjectTypeTrack, nil},
+		{"locale prefix", "https://open.spotify.com/intl-de/album/" + id, SpotifyObjectTypeAlbum, nil},
+		{"embed", "https://open.spotify.com/embed/playlist/" + id, SpotifyObjectTypePlaylist, nil},
+		{"no scheme", "open.spotify.com/artist/" + id, SpotifyObjectTypeArtist, nil},
+		{"http", "http://open.spotify.com/album/" + id, SpotifyObjectTypeAlbum, nil},
+		{"surrounding spaces", "  https://open.spotify.com/album/" + id + " \n", SpotifyObjectTypeAlbum, nil},
+		{"legacy user playlist", "https://open.spotify.com/user/someone/playlist/" + id, SpotifyObjectTypePlaylist, nil},
+		{"uri", "spotify:album:" + id, SpotifyObjectTypeAlbum, nil},
+		{"legacy uri", "spotify:user:someone:playlist:" + id, SpotifyObjectTypePlaylist, nil},
+		// a playlist named "album" must not be taken for an album
+		{"type word in id position", "https://open.spotify.com/playlist/" + id + "?name=album", SpotifyObjectTypePlaylist, nil},
+
+		{"empty", "", "", ErrInvalidURL},
+		{"short url", "https://open.spotify.com/album", "", ErrInvalidURL},
+		{"host only", "https://open.spotify.com", "", ErrInvalidURL},
+		{"other host", "https://example.com/album/" + id, "", ErrInvalidURL},
+		{"other scheme", "ftp://open.spotify.com/album/" + id, "", ErrInvalidURL},
+		{"too many segments", "https://open.spotify.com/album/" + id + "/extra", "", ErrInvalidURL},
+		{"short uri", "spotify:album", "", ErrInvalidURL},
+		{"unsupported type", "https://open.spotify.com/show/" + id, "", ErrUnsupportedObjectType},
+		{"unsupported uri type", "spotify:episode:" + id, "", ErrUnsupportedObjectType},
+		{"short id", "https://open.spotify.com/album/abc", "", ErrInvalidID},
+		{"bad id characters", "https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRG-y", "", ErrInvalidID},
+		{"short link", "https://spotify.link/AbCdEf123", "", ErrShortLink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := ParseURL(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseURL(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+				}
+				var urlErr *URLError
+				if !errors.As(err, &urlErr) {
+					t.Errorf("ParseURL(%q) error %T is not a *URLError", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseURL(%q) unexpected error: %v", tt.input, err)
+			}
+			if ref.Type != tt.wantType {
+				t.Errorf("Type = %q, want %q", ref.Type, tt.wantType)
+			}
+			if string(ref.ID) != id {
+				t.Errorf("ID = %q, want %q", ref.ID, id)
+			}
+			wantURL := "https://open.spotify.com/" + string(tt.wantType) + "/" + id
+			if ref.URL != wantURL {
+				t.Errorf("URL = %q, want %q", ref.URL, wantURL)
+			}
+		})
+	}
+}
+
+func TestParseURLLibrary(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantType SpotifyObjectType
+		wantURL  string
+		wantURI  string
+	}{
+		{"https://open.spotify.com/collection/tracks", SpotifyObjectTypeSavedTracks, LikedSongsURL, "spotify:collection:tracks"},
+		{"open.spotify.com/collection/albums/", SpotifyObjectTypeSavedAlbums, SavedAlbumsURL, "spotify:collection:albums"},
+		{"https://open.spotify.com/intl-fr/collection/tracks?si=abc", SpotifyObjectTypeSavedTracks, LikedSongsURL, "spotify:collection:tracks"},
+		{"spotify:user:someone:collection", SpotifyObjectTypeSavedTracks, LikedSongsURL, "spotify:collection:tracks"},
+		{"spotify:collection:albums", SpotifyObjectTypeSavedAlbums, SavedAlbumsURL, "spotify:collection:albums"},
+	}
+
+	for _, tt := range tests {
+		ref, err := ParseURL(tt.input)
+		if err != nil {
+			t.Errorf("ParseURL(%q): %v", tt.input, err)
+			continue
+		}
+		if ref.Type != tt.wantType || ref.ID != "" || ref.URL != tt.wantURL || ref.URI() != tt.wantURI {
+			t.Errorf("ParseURL(%q) = %+v with URI %q, want %s %s %s", tt.input, ref, ref.URI(), tt.wantType, tt.wantURL, tt.wantURI)
+		}
+		if !ref.Type.IsLibrary() {
+			t.Errorf("%s is not a library type", ref.Type)
+		}
+	}
+
+	if _, err := ParseURL("https://open.spotify.com/collection/podcasts"); !errors.Is(err, ErrUnsupportedObjectType) {
+		t.Errorf("ParseURL of podcasts collection error = %v, want %v", err, ErrUnsupportedObjectType)
+	}
+}
+
+func TestRef_URI(t *testing.T) {
+	ref, err := ParseURL("https://open.spotify.com/track/4aawyAB9vmqN3uQ7FjRGTy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ref.URI(), "spotify:track:4aawyAB9vmqN3uQ7FjRGTy"; got != want {
+		t.Errorf("URI() = %q, want %q", got, want)
+	}
+}
+
+func FuzzParseURL(f *testing.F) {
+	for _, seed := range []string{
+		"https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy",
+		"https://open.spotify.com/intl-de/playlist/37i9dQZF1DXcBWIGoYBM5M?si=x",
+		"spotify:track:4aawyAB9vmqN3uQ7FjRGTy",
+		"spotify:collection:tracks",
+		"https://open.spotify.com/collection/albums",
+		"https://spotify.link/abc",
+		"open.spotify.com//",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		ref, err := ParseURL(input)
+		if err != nil {
+			return
+		}
+		if ref.Type.IsLibrary() {
+			// library collections have no id, only their fixed URL
+			if ref.ID != "" || ref.URL != LibraryURL(ref.Type) {
+				t.Fatalf("ParseURL(%q) = %+v, want no id and the library URL", input, ref)
+			}
+		} else if !isValidID(string(ref.ID)) {
+			t.Fatalf("ParseURL(%q) returned invalid id %q", input, ref.ID)
+		}
+
+		// the canonical URL and URI must parse back to the same reference
+		for _, canonical := range []string{ref.URL, ref.URI()} {
+			again, err := ParseURL(canonical)
+			if err != nil {
+				t.Fatalf("ParseURL(%q) of canonical form failed: %v", canonical, err)
+			}
+			if again != ref {
+				t.Fatalf("ParseURL(%q) = %+v, want %+v", canonical, again, ref)
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/zmb3/spotify/v2"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// UserPlaylist is a playlist in a user's library
+type UserPlaylist struct {
+	URL           string
+	Name          string
+	OwnerID       string
+	Collaborative bool
+	Public        bool
+	TrackCount    int
+	SnapshotID    string
+}
+
+// ForUser returns a copy of the service that authenticates with token, see
+// UserAuth.TokenSource. The copy shares the rate limit of s.
+func (s *spotifyService) ForUser(token oauth2.TokenSource) SpotifyService {
+	httpClient := &http.Client{
+		Transport: &oauth2.Transport{Source: token, Base: s.transport},
+		Timeout:   s.timeout,
+	}
+
+	user := *s
+	user.spotifyClient = spotify.New(httpClient, spotify.WithBaseURL(s.opts.BaseURL))
+	user.user = true
+	return &user
+}
+
+// GetUserPlaylists returns the playlists the user owns, follows or
+// collaborates on. It needs a service returned by ForUser.
+func (s *spotifyService) GetUserPlaylists(ctx context.Context) ([]UserPlaylist, error) {
+	if !s.user {
+		return nil, ErrNoUserToken
+	}
+
+	playlists := make([]UserPlaylist, 0)
+	offset := 0
+	limit := 50
+	for {
+		page, err := s.spotifyClient.CurrentUsersPlaylists(ctx, spotify.Limit(limit), spotify.Offset(offset))
+		if err != nil {
+			s.log.Error("failed to get user playlists", zap.Error(err), zap.Int("offset", offset))
+			return nil, fmt.Errorf("failed to get user playlists: %w", err)
+		}
+		for _, playlist := range page.Playlists {
+			playlists = append(playlists, UserPlaylist{
+				URL:           openSpotifyPrefix + string(SpotifyObjectTypePlaylist) + "/" + string(playlist.ID),
+				Name:          playlist.Name,
+				OwnerID:       playlist.Owner.ID,
+				Collaborative: playlist.Collaborative,
+				Public:        playlist.IsPublic,
+				TrackCount:    int(playlist.Tracks.Total),
+				SnapshotID:    playlist.SnapshotID,
+			})
+		}
+		if len(page.Playlists) < limit {
+			break
+		}
+		offset += limit
+	}
+
+	return playlists, nil
+}
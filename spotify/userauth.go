@@ -0,0 +1,139 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	spotifyauth "github.com/zmb3/spotify/v2/auth"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrNoUserToken is returned when a user has not granted access yet, or
+	// when a method that reads a user's data is called without ForUser
+	ErrNoUserToken = errors.New("no spotify user token")
+)
+
+// DefaultUserScopes are the scopes needed to sync a user's private and
+// collaborative playlists and library
+var DefaultUserScopes = []string{
+	spotifyauth.ScopePlaylistReadPrivate,
+	spotifyauth.ScopePlaylistReadCollaborative,
+	spotifyauth.ScopeUserLibraryRead,
+}
+
+// TokenStore keeps the tokens users granted, by CreatorID. LoadToken returns
+// ErrNoUserToken for users without a token. database.NewTokenStore stores
+// them in MongoDB.
+type TokenStore interface {
+	LoadToken(ctx context.Context, creatorID int64) (*oauth2.Token, error)
+	SaveToken(ctx context.Context, creatorID int64, token *oauth2.Token) error
+}
+
+// UserAuth runs the authorization code flow with PKCE, letting users grant
+// access to their private playlists and library
+type UserAuth struct {
+	config     oauth2.Config
+	httpClient *http.Client
+}
+
+// NewUserAuth returns a UserAuth redirecting users back to redirectURL.
+// clientSecret may be empty for a public client. Scopes default to
+// DefaultUserScopes; AuthURL, TokenURL and HTTPClient are taken from opts.
+func NewUserAuth(clientID, clientSecret, redirectURL string, scopes []string, opts Options) *UserAuth {
+	opts = opts.withDefaults()
+	if len(scopes) == 0 {
+		scopes = DefaultUserScopes
+	}
+
+	return &UserAuth{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  opts.AuthURL,
+				TokenURL: opts.TokenURL,
+			},
+		},
+		httpClient: opts.HTTPClient,
+	}
+}
+
+// AuthCodeURL returns the URL to send the user to, and the PKCE verifier to
+// keep until Exchange. state should be random and checked on the redirect.
+func (a *UserAuth) AuthCodeURL(state string) (url, verifier string) {
+	verifier = oauth2.GenerateVerifier()
+	return a.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), verifier
+}
+
+// Exchange trades the code from the redirect for a token
+func (a *UserAuth) Exchange(ctx context.Context, code, verifier string) (*oauth2.Token, error) {
+	token, err := a.config.Exchange(a.context(ctx), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	return token, nil
+}
+
+// TokenSource returns the token of a user from store. Expired tokens are
+// refreshed and the refreshed token is saved back to store. ctx is used for
+// the refresh requests, so it should outlive the token source.
+func (a *UserAuth) TokenSource(ctx context.Context, creatorID int64, store TokenStore) (oauth2.TokenSource, error) {
+	token, err := store.LoadToken(ctx, creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storingTokenSource{
+		ctx:       ctx,
+		creatorID: creatorID,
+		store:     store,
+		base:      a.config.TokenSource(a.context(ctx), token),
+		last:      token.AccessToken,
+	}, nil
+}
+
+// context makes token requests use the configured HTTP client
+func (a *UserAuth) context(ctx context.Context) context.Context {
+	if a.httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, a.httpClient)
+}
+
+// storingTokenSource saves tokens refreshed by base. Spotify may rotate the
+// refresh token, so losing a refreshed token can lock the user out.
+type storingTokenSource struct {
+	ctx       context.Context
+	creatorID int64
+	store     TokenStore
+	base      oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string
+}
+
+func (s *storingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == s.last {
+		return token, nil
+	}
+
+	if err := s.store.SaveToken(s.ctx, s.creatorID, token); err != nil {
+		return nil, fmt.Errorf("failed to save refreshed token: %w", err)
+	}
+	s.last = token.AccessToken
+
+	return token, nil
+}
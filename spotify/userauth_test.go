@@ -0,0 +1,254 @@
+package spotify_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/supperdoggy/spot-models/database"
+	"github.com/supperdoggy/spot-models/database/memdb"
+	"github.com/supperdoggy/spot-models/spotify"
+	"github.com/supperdoggy/spot-models/spotify/spotifytest"
+)
+
+const (
+	redirectURL     = "http://localhost:8080/callback"
+	roadTripURL     = "https://open.spotify.com/playlist/5AlicePrivateRoadTrip1"
+	partyMixURL     = "https://open.spotify.com/playlist/6BobCollabPartyMix0001"
+	testCreatorID   = int64(42)
+	authorizedState = "xyzzy"
+)
+
+// authorize follows the authorization URL like a browser would and returns
+// the code from the redirect
+func authorize(t *testing.T, server *spotifytest.Server, authURL string) string {
+	t.Helper()
+
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", authURL, err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect %q: %v", resp.Header.Get("Location"), err)
+	}
+	query := location.Query()
+	if query.Get("state") != authorizedState || query.Get("code") == "" {
+		t.Fatalf("redirect = %s, want a code and the state", location)
+	}
+	return query.Get("code")
+}
+
+func TestUserAuth(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+	store := database.NewTokenStore(memdb.New())
+	auth := spotify.NewUserAuth(spotifytest.ClientID, "", redirectURL, nil, server.Options())
+
+	authURL, verifier := auth.AuthCodeURL(authorizedState)
+	code := authorize(t, server, authURL)
+
+	if _, err := auth.Exchange(ctx, code, "wrong verifier"); err == nil {
+		t.Error("Exchange with a wrong PKCE verifier succeeded")
+	}
+	code = authorize(t, server, authURL)
+	token, err := auth.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if err := store.SaveToken(ctx, testCreatorID, token); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+
+	if _, err := auth.TokenSource(ctx, 7, store); !errors.Is(err, spotify.ErrNoUserToken) {
+		t.Errorf("TokenSource for unknown user error = %v, want %v", err, spotify.ErrNoUserToken)
+	}
+	source, err := auth.TokenSource(ctx, testCreatorID, store)
+	if err != nil {
+		t.Fatalf("TokenSource: %v", err)
+	}
+	user := svc.ForUser(source)
+
+	playlists, err := user.GetUserPlaylists(ctx)
+	if err != nil {
+		t.Fatalf("GetUserPlaylists: %v", err)
+	}
+	if len(playlists) != 2 || playlists[0].URL != roadTripURL || playlists[1].URL != partyMixURL {
+		t.Fatalf("GetUserPlaylists = %+v, want Road Trip and Party Mix", playlists)
+	}
+	if playlists[0].Public || !playlists[1].Collaborative || playlists[1].OwnerID != "bob" || playlists[1].TrackCount != 2 {
+		t.Errorf("GetUserPlaylists = %+v", playlists)
+	}
+
+	// private playlists need the user's token
+	if count, _, err := user.GetTrackCount(ctx, roadTripURL); err != nil || count != 1 {
+		t.Errorf("GetTrackCount as user = %d, %v, want 1", count, err)
+	}
+	if _, _, err := svc.GetTrackCount(ctx, roadTripURL); err == nil {
+		t.Error("GetTrackCount of a private playlist succeeded without a user token")
+	}
+	if _, err := svc.GetUserPlaylists(ctx); !errors.Is(err, spotify.ErrNoUserToken) {
+		t.Errorf("GetUserPlaylists without user error = %v, want %v", err, spotify.ErrNoUserToken)
+	}
+}
+
+func TestUserAuthRefresh(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+	db := memdb.New()
+	store := database.NewTokenStore(db)
+	auth := spotify.NewUserAuth(spotifytest.ClientID, spotifytest.ClientSecret, redirectURL, nil, server.Options())
+
+	authURL, verifier := auth.AuthCodeURL(authorizedState)
+	token, err := auth.Exchange(ctx, authorize(t, server, authURL), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	token.Expiry = time.Now().Add(-time.Minute)
+	if err := store.SaveToken(ctx, testCreatorID, token); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+
+	source, err := auth.TokenSource(ctx, testCreatorID, store)
+	if err != nil {
+		t.Fatalf("TokenSource: %v", err)
+	}
+	if _, err := svc.ForUser(source).GetUserPlaylists(ctx); err != nil {
+		t.Fatalf("GetUserPlaylists with expired token: %v", err)
+	}
+
+	stored, err := db.GetUserToken(ctx, testCreatorID)
+	if err != nil {
+		t.Fatalf("GetUserToken: %v", err)
+	}
+	if stored.AccessToken == token.AccessToken || stored.RefreshToken == token.RefreshToken {
+		t.Error("refreshed token was not saved")
+	}
+	if stored.Expiry <= time.Now().Unix() {
+		t.Errorf("stored expiry %d is not in the future", stored.Expiry)
+	}
+	if stored.Scope != "playlist-read-private playlist-read-collaborative user-library-read" {
+		t.Errorf("stored scope = %q, want the granted scopes", stored.Scope)
+	}
+
+	// the rotated refresh token is the only one that still works
+	stored.Expiry = time.Now().Add(-time.Minute).Unix()
+	if err := db.SaveUserToken(ctx, stored); err != nil {
+		t.Fatalf("SaveUserToken: %v", err)
+	}
+	source, err = auth.TokenSource(ctx, testCreatorID, store)
+	if err != nil {
+		t.Fatalf("TokenSource: %v", err)
+	}
+	if _, err := svc.ForUser(source).GetUserPlaylists(ctx); err != nil {
+		t.Errorf("GetUserPlaylists after rotation: %v", err)
+	}
+}
+
+// userService returns svc authenticated as the user the server logs in
+func userService(t *testing.T, server *spotifytest.Server, svc spotify.SpotifyService) spotify.SpotifyService {
+	t.Helper()
+
+	ctx := context.Background()
+	store := database.NewTokenStore(memdb.New())
+	auth := spotify.NewUserAuth(spotifytest.ClientID, "", redirectURL, nil, server.Options())
+	authURL, verifier := auth.AuthCodeURL(authorizedState)
+	token, err := auth.Exchange(ctx, authorize(t, server, authURL), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if err := store.SaveToken(ctx, testCreatorID, token); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+	source, err := auth.TokenSource(ctx, testCreatorID, store)
+	if err != nil {
+		t.Fatalf("TokenSource: %v", err)
+	}
+	return svc.ForUser(source)
+}
+
+func TestUserLibrary(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	svc := newTestService(server, server.Options())
+	user := userService(t, server, svc)
+
+	count, tracks, err := user.GetTrackCount(ctx, "https://open.spotify.com/collection/tracks")
+	if err != nil {
+		t.Fatalf("GetTrackCount liked songs: %v", err)
+	}
+	if count != 2 || len(tracks) != 2 || tracks[0] != getLucky || tracks[1] != aerodynamic {
+		t.Errorf("liked songs = %d, %+v, want Get Lucky and Aerodynamic", count, tracks)
+	}
+
+	count, tracks, err = user.GetTrackCount(ctx, "spotify:collection:albums")
+	if err != nil {
+		t.Fatalf("GetTrackCount saved albums: %v", err)
+	}
+	if count != 2 || len(tracks) != 2 || tracks[0] != oneMoreTime || tracks[1] != aerodynamic {
+		t.Errorf("saved albums = %d, %+v, want the tracks of Discovery", count, tracks)
+	}
+
+	if name, err := user.GetObjectName(ctx, spotify.LikedSongsURL); err != nil || name != "Liked Songs" {
+		t.Errorf("GetObjectName = %q, %v, want Liked Songs", name, err)
+	}
+	if _, _, err := svc.GetTrackCount(ctx, spotify.LikedSongsURL); !errors.Is(err, spotify.ErrNoUserToken) {
+		t.Errorf("GetTrackCount without user error = %v, want %v", err, spotify.ErrNoUserToken)
+	}
+
+	// the library of another user is their own
+	server.LoginAs("bob")
+	if count, _, err := userService(t, server, svc).GetTrackCount(ctx, spotify.LikedSongsURL); err != nil || count != 0 {
+		t.Errorf("bob's liked songs = %d, %v, want none", count, err)
+	}
+}
+
+func TestUserLibraryPagination(t *testing.T) {
+	fixtures := spotifytest.Fixtures{
+		Artists: []spotifytest.Artist{{ID: "artist0000000000000000", Name: "Artist"}},
+		Albums: []spotifytest.Album{
+			{ID: "album00000000000000000", Name: "Long Album", ArtistIDs: []string{"artist0000000000000000"}},
+			{ID: "album00000000000000001", Name: "Short Album", ArtistIDs: []string{"artist0000000000000000"}},
+		},
+		Users: []spotifytest.User{{ID: "carol", SavedAlbumIDs: []string{"album00000000000000000", "album00000000000000001"}}},
+	}
+	for i := range 120 {
+		id := fmt.Sprintf("track%017d", i)
+		fixtures.Tracks = append(fixtures.Tracks, spotifytest.Track{ID: id, Name: fmt.Sprintf("Track %d", i), ArtistIDs: []string{"artist0000000000000000"}})
+		fixtures.Users[0].SavedTrackIDs = append(fixtures.Users[0].SavedTrackIDs, id)
+		album := &fixtures.Albums[min(i/110, 1)]
+		album.TrackIDs = append(album.TrackIDs, id)
+	}
+	server := spotifytest.NewServer(fixtures)
+	defer server.Close()
+	user := userService(t, server, newTestService(server, server.Options()))
+
+	count, tracks, err := user.GetTrackCount(context.Background(), spotify.LikedSongsURL)
+	if err != nil {
+		t.Fatalf("GetTrackCount liked songs: %v", err)
+	}
+	if count != 120 || len(tracks) != 120 || tracks[119].Title != "track 119" {
+		t.Errorf("liked songs count = %d with %d tracks, want 120", count, len(tracks))
+	}
+
+	// the long album needs its tracks fetched separately
+	count, tracks, err = user.GetTrackCount(context.Background(), spotify.SavedAlbumsURL)
+	if err != nil {
+		t.Fatalf("GetTrackCount saved albums: %v", err)
+	}
+	if count != 120 || len(tracks) != 120 || tracks[109].Title != "track 109" || tracks[110].Title != "track 110" {
+		t.Errorf("saved albums count = %d with %d tracks, want 120", count, len(tracks))
+	}
+}
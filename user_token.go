@@ -0,0 +1,18 @@
+package models
+
+// UserToken is the Spotify OAuth token a user granted through the
+// authorization code flow, stored per CreatorID. The secrets are not
+// marshalled to JSON so they cannot leak through API responses.
+type UserToken struct {
+	CreatorID    int64  `json:"creator_id" bson:"_id"`
+	AccessToken  string `json:"-" bson:"access_token"`
+	RefreshToken string `json:"-" bson:"refresh_token"`
+	TokenType    string `json:"token_type" bson:"token_type"`
+	// Expiry of the access token, unix seconds
+	Expiry int64 `json:"expiry" bson:"expiry"`
+	// Scope is the space separated list of granted scopes
+	Scope string `json:"scope,omitempty" bson:"scope,omitempty"`
+
+	CreatedAt int64 `json:"created_at" bson:"created_at"`
+	UpdatedAt int64 `json:"updated_at" bson:"updated_at"`
+}